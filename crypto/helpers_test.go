@@ -0,0 +1,112 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var testKey = func() *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}()
+
+func publicKeyPEM(t *testing.T, pub any) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+// keyServer serves body with status and the Cache-Control value in header,
+// counting the requests it receives.
+type keyServer struct {
+	*httptest.Server
+	status   atomic.Int32
+	body     atomic.Value
+	header   atomic.Value
+	requests atomic.Int32
+}
+
+func newKeyServer(t *testing.T, body []byte) *keyServer {
+	t.Helper()
+	s := &keyServer{}
+	s.status.Store(http.StatusOK)
+	s.body.Store(body)
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests.Add(1)
+		if cc, _ := s.header.Load().(string); cc != "" {
+			w.Header().Set("Cache-Control", cc)
+		}
+		w.WriteHeader(int(s.status.Load()))
+		w.Write(s.body.Load().([]byte))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+var otherKey = func() *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}()
+
+// jwksJSON returns a JWKS holding pub as an RSA signing key with kid.
+func jwksJSON(t *testing.T, kid string, pub *rsa.PublicKey) []byte {
+	t.Helper()
+	return jwksOf(t, rsaJWK(kid, pub))
+}
+
+func rsaJWK(kid string, pub *rsa.PublicKey) map[string]any {
+	return map[string]any{
+		"kty": "RSA",
+		"kid": kid,
+		"use": "sig",
+		"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}
+}
+
+func jwksOf(t *testing.T, keys ...map[string]any) []byte {
+	t.Helper()
+	raw, err := json.Marshal(map[string]any{"keys": keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func tokenWithKID(kid string) *jwt.Token {
+	return &jwt.Token{Header: map[string]any{"kid": kid}, Method: jwt.SigningMethodRS256}
+}
+
+func newJWKS(t *testing.T, url string, opts JWKSOptions) *RemoteJWKS {
+	t.Helper()
+	if opts.RefreshEvery == 0 {
+		opts.RefreshEvery = time.Hour
+	}
+	jwks, err := NewRemoteJWKS(url, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { jwks.Close() })
+	return jwks
+}
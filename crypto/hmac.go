@@ -0,0 +1,53 @@
+package crypto
+
+import (
+	"errors"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// HMACSecrets provides the shared secrets for HS256/HS384/HS512 tokens and
+// accepts several of them while a secret is being rotated.
+type HMACSecrets struct {
+	byKID   map[string][]byte
+	secrets [][]byte
+}
+
+// NewHMACSecrets accepts tokens signed with any of secrets, e.g. the current
+// and the previous one. Each secret is tried in turn; the comparison itself
+// is constant-time.
+func NewHMACSecrets(secrets ...[]byte) *HMACSecrets {
+	return &HMACSecrets{secrets: secrets}
+}
+
+// NewHMACSecretsByKID selects the secret by the token kid header. Tokens
+// without a kid are checked against every secret.
+func NewHMACSecretsByKID(secrets map[string][]byte) *HMACSecrets {
+	h := &HMACSecrets{byKID: secrets}
+	for _, secret := range secrets {
+		h.secrets = append(h.secrets, secret)
+	}
+	return h
+}
+
+func (h *HMACSecrets) Key(t *jwt.Token) (interface{}, error) {
+	if kid, _ := t.Header["kid"].(string); kid != "" && h.byKID != nil {
+		secret, ok := h.byKID[kid]
+		if !ok {
+			return nil, errors.New("unknown kid")
+		}
+		return secret, nil
+	}
+
+	switch len(h.secrets) {
+	case 0:
+		return nil, errors.New("no HMAC secrets configured")
+	case 1:
+		return h.secrets[0], nil
+	}
+	set := jwt.VerificationKeySet{Keys: make([]jwt.VerificationKey, len(h.secrets))}
+	for i, secret := range h.secrets {
+		set.Keys[i] = secret
+	}
+	return set, nil
+}
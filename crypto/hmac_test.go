@@ -0,0 +1,75 @@
+package crypto
+
+import (
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func signHMAC(t *testing.T, secret []byte, kid string) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "alice"})
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	tokenStr, err := token.SignedString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tokenStr
+}
+
+func verifies(provider KeyProvider, tokenStr string) bool {
+	_, err := jwt.Parse(tokenStr, provider.Key, jwt.WithValidMethods([]string{"HS256"}))
+	return err == nil
+}
+
+func TestHMACSecretsRotation(t *testing.T) {
+	current, previous, retired := []byte("current-secret"), []byte("previous-secret"), []byte("retired-secret")
+
+	single := NewHMACSecrets(current)
+	if !verifies(single, signHMAC(t, current, "")) || verifies(single, signHMAC(t, previous, "")) {
+		t.Error("single secret")
+	}
+
+	rotating := NewHMACSecrets(current, previous)
+	for _, tc := range []struct {
+		name   string
+		secret []byte
+		want   bool
+	}{
+		{"current", current, true},
+		{"previous", previous, true},
+		{"retired", retired, false},
+	} {
+		if got := verifies(rotating, signHMAC(t, tc.secret, "")); got != tc.want {
+			t.Errorf("%s secret: verified = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestHMACSecretsByKID(t *testing.T) {
+	a, b := []byte("secret-a"), []byte("secret-b")
+	h := NewHMACSecretsByKID(map[string][]byte{"a": a, "b": b})
+
+	for _, tc := range []struct {
+		name     string
+		tokenStr string
+		want     bool
+	}{
+		{"matching kid", signHMAC(t, a, "a"), true},
+		{"other kid", signHMAC(t, a, "b"), false},
+		{"unknown kid", signHMAC(t, a, "c"), false},
+		{"no kid", signHMAC(t, b, ""), true},
+	} {
+		if got := verifies(h, tc.tokenStr); got != tc.want {
+			t.Errorf("%s: verified = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestHMACSecretsEmpty(t *testing.T) {
+	if verifies(NewHMACSecrets(), signHMAC(t, []byte("secret"), "")) {
+		t.Fatal("token verified without secrets")
+	}
+}
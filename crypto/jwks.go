@@ -0,0 +1,484 @@
+package crypto
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type JWKSOptions struct {
+	RefreshEvery time.Duration
+	// StrictKID drops kids missing from the latest JWKS right away instead
+	// of keeping them for DefaultRemovedKeyGrace during overlapping rotation.
+	StrictKID bool
+	// RemovedKeyGrace keeps a kid usable for this long after it disappears
+	// from the JWKS, then drops it. Takes precedence over StrictKID.
+	// Defaults to DefaultRemovedKeyGrace unless StrictKID is set.
+	RemovedKeyGrace time.Duration
+	// StaleAfter is how long after the last successful refresh the key set
+	// counts as stale. Defaults to three refresh intervals.
+	StaleAfter time.Duration
+	// RespectCacheControl schedules the next refresh from the max-age of the
+	// JWKS response Cache-Control header instead of RefreshEvery, clamped to
+	// MinRefreshEvery (default 1 minute) and MaxRefreshEvery (default 24
+	// hours). RefreshEvery applies when the response has no max-age.
+	RespectCacheControl bool
+	MinRefreshEvery     time.Duration
+	MaxRefreshEvery     time.Duration
+	// Background, FailureThreshold and MaxBackoff work as in
+	// RemotePublicKeyOptions. MaxBackoff defaults to the current refresh
+	// interval, so set it when RespectCacheControl allows long intervals.
+	Background       bool
+	FailureThreshold int
+	MaxBackoff       time.Duration
+	// PinnedFingerprints works as in RemotePublicKeyOptions: a JWKS with any
+	// signing key outside the list is rejected as a whole and the previous
+	// keys stay in use. Pin the next key before publishing it.
+	PinnedFingerprints []string
+	// OnRefreshSuccess and OnRefreshFailure are called after every JWKS
+	// fetch, including the initial one.
+	OnRefreshSuccess func(stats RefreshStats)
+	OnRefreshFailure func(stats RefreshStats, err error)
+}
+
+// DefaultRemovedKeyGrace is how long a kid missing from the JWKS stays
+// usable when neither StrictKID nor RemovedKeyGrace is set, so tokens
+// signed just before a rotation still verify.
+const DefaultRemovedKeyGrace = time.Hour
+
+type RemoteJWKS struct {
+	url         string
+	opts        JWKSOptions
+	keys        map[string]jwksKey
+	lastUpdated time.Time
+	failures    int
+	maxAge      time.Duration
+	mu          sync.RWMutex
+	done        chan struct{}
+	closeOnce   sync.Once
+	initial     initialFetch
+}
+
+// jwksKey is a parsed JWKS entry. Entries are indexed by kid, or by their
+// certificate thumbprint when the JWK has no kid.
+type jwksKey struct {
+	pub     interface{}
+	x5t     string
+	x5tS256 string
+	// removedAt is when the key was last seen missing from the JWKS.
+	removedAt time.Time
+}
+
+type jwk struct {
+	Kid     string   `json:"kid"`
+	Kty     string   `json:"kty"`
+	Use     string   `json:"use"`
+	KeyOps  []string `json:"key_ops"`
+	Crv     string   `json:"crv"`
+	N       string   `json:"n"`
+	E       string   `json:"e"`
+	X       string   `json:"x"`
+	Y       string   `json:"y"`
+	D       string   `json:"d"`
+	X5t     string   `json:"x5t"`
+	X5tS256 string   `json:"x5t#S256"`
+	X5c     []string `json:"x5c"`
+}
+
+func NewRemoteJWKS(url string, opts JWKSOptions) (*RemoteJWKS, error) {
+	if opts.RefreshEvery <= 0 {
+		opts.RefreshEvery = 5 * time.Minute
+	}
+	if opts.MinRefreshEvery <= 0 {
+		opts.MinRefreshEvery = time.Minute
+	}
+	if opts.MaxRefreshEvery <= 0 {
+		opts.MaxRefreshEvery = 24 * time.Hour
+	}
+	if opts.RemovedKeyGrace <= 0 && !opts.StrictKID {
+		opts.RemovedKeyGrace = DefaultRemovedKeyGrace
+	}
+	r := &RemoteJWKS{
+		url:  url,
+		opts: opts,
+		keys: map[string]jwksKey{},
+		done: make(chan struct{}),
+	}
+	r.initial.done = make(chan struct{})
+	if !opts.Background {
+		if err := r.refresh(); err != nil {
+			return nil, err
+		}
+	}
+	go r.autoRefresh()
+	return r, nil
+}
+
+func (r *RemoteJWKS) autoRefresh() {
+	if r.opts.Background {
+		_ = r.initial.run(context.Background(), r.refreshContext)
+	}
+	timer := time.NewTimer(r.nextRefresh())
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			_ = r.refresh()
+			timer.Reset(r.nextRefresh())
+		case <-r.done:
+			return
+		}
+	}
+}
+
+func (r *RemoteJWKS) nextRefresh() time.Duration {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return nextRefresh(r.failures, r.refreshIntervalLocked(), r.opts.MaxBackoff)
+}
+
+func (r *RemoteJWKS) refreshIntervalLocked() time.Duration {
+	if !r.opts.RespectCacheControl || r.maxAge <= 0 {
+		return r.opts.RefreshEvery
+	}
+	return min(max(r.maxAge, r.opts.MinRefreshEvery), r.opts.MaxRefreshEvery)
+}
+
+// Close stops the refresh loop. The last fetched keys stay usable.
+func (r *RemoteJWKS) Close() error {
+	r.closeOnce.Do(func() { close(r.done) })
+	return nil
+}
+
+func (r *RemoteJWKS) refresh() error {
+	return r.refreshContext(context.Background())
+}
+
+func (r *RemoteJWKS) refreshContext(ctx context.Context) error {
+	start := time.Now()
+	n, err := r.fetch(ctx)
+	r.mu.Lock()
+	if err != nil {
+		r.failures++
+	} else {
+		r.failures = 0
+	}
+	r.mu.Unlock()
+	reportRefresh(RefreshStats{URL: r.url, Duration: time.Since(start), Bytes: n}, err,
+		r.opts.OnRefreshSuccess, r.opts.OnRefreshFailure)
+	return err
+}
+
+func (r *RemoteJWKS) fetch(ctx context.Context) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return 0, fmt.Errorf("JWKS server responded %s", resp.Status)
+	}
+
+	raw, err := readLimited(resp.Body)
+	if err != nil {
+		return len(raw), err
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(raw, &set); err != nil {
+		return len(raw), err
+	}
+
+	keys := map[string]jwksKey{}
+	for _, k := range set.Keys {
+		if !k.verifiesSignatures() {
+			continue
+		}
+		pub, err := k.publicKey()
+		if err != nil {
+			continue
+		}
+		if err := checkPinned(pub, r.opts.PinnedFingerprints); err != nil {
+			return len(raw), fmt.Errorf("kid %q: %w", k.Kid, err)
+		}
+		entry := k.entry(pub)
+		keys[entry.id(k.Kid)] = entry
+	}
+	if len(keys) == 0 {
+		return len(raw), errors.New("no usable keys in JWKS")
+	}
+
+	r.mu.Lock()
+	now := time.Now()
+	for kid, old := range r.keys {
+		if _, ok := keys[kid]; ok {
+			continue
+		}
+		if old.removedAt.IsZero() {
+			old.removedAt = now
+		}
+		if old.usable(r.opts.RemovedKeyGrace) {
+			keys[kid] = old
+		}
+	}
+	r.keys = keys
+	r.lastUpdated = time.Now()
+	r.maxAge = cacheMaxAge(resp.Header.Get("Cache-Control"))
+	r.mu.Unlock()
+
+	return len(raw), nil
+}
+
+// Key selects by kid, falling back to the x5t#S256 or x5t header when the
+// token has no kid.
+func (r *RemoteJWKS) Key(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.lastUpdated.IsZero() {
+		return nil, ErrNotReady
+	}
+
+	if kid == "" {
+		if entry, ok := r.byThumbprint(t); ok {
+			return entry.pub, nil
+		}
+	}
+
+	entry, ok := r.keys[kid]
+	if !ok || !entry.usable(r.opts.RemovedKeyGrace) {
+		if kid == "" {
+			return nil, errors.New("no key matches token x5t")
+		}
+		return nil, errors.New("unknown kid")
+	}
+	return entry.pub, nil
+}
+
+func (r *RemoteJWKS) byThumbprint(t *jwt.Token) (jwksKey, bool) {
+	x5tS256, _ := t.Header["x5t#S256"].(string)
+	x5t, _ := t.Header["x5t"].(string)
+
+	for _, entry := range r.keys {
+		if !entry.usable(r.opts.RemovedKeyGrace) {
+			continue
+		}
+		switch {
+		case x5tS256 != "":
+			if entry.x5tS256 == x5tS256 {
+				return entry, true
+			}
+		case x5t != "":
+			if entry.x5t == x5t {
+				return entry, true
+			}
+		}
+	}
+	return jwksKey{}, false
+}
+
+// cacheMaxAge returns the max-age directive of a Cache-Control header, or 0.
+func cacheMaxAge(header string) time.Duration {
+	for _, directive := range strings.Split(header, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		if !strings.EqualFold(name, "max-age") {
+			continue
+		}
+		seconds, err := strconv.Atoi(strings.Trim(value, `"`))
+		if err != nil || seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	return 0
+}
+
+// entry builds the lookup entry for k, deriving thumbprints from the leaf
+// certificate when x5c is present but x5t/x5t#S256 are not.
+func (k jwk) entry(pub interface{}) jwksKey {
+	entry := jwksKey{pub: pub, x5t: k.X5t, x5tS256: k.X5tS256}
+	if len(k.X5c) > 0 && (entry.x5t == "" || entry.x5tS256 == "") {
+		if der, err := base64.StdEncoding.DecodeString(k.X5c[0]); err == nil {
+			if entry.x5t == "" {
+				sum := sha1.Sum(der)
+				entry.x5t = base64.RawURLEncoding.EncodeToString(sum[:])
+			}
+			if entry.x5tS256 == "" {
+				sum := sha256.Sum256(der)
+				entry.x5tS256 = base64.RawURLEncoding.EncodeToString(sum[:])
+			}
+		}
+	}
+	return entry
+}
+
+// verifiesSignatures excludes encryption keys: use must be "sig" and key_ops
+// must contain "verify" when present. Keys declaring neither are accepted.
+func (k jwk) verifiesSignatures() bool {
+	if k.Use != "" && k.Use != "sig" {
+		return false
+	}
+	if len(k.KeyOps) == 0 {
+		return true
+	}
+	for _, op := range k.KeyOps {
+		if op == "verify" {
+			return true
+		}
+	}
+	return false
+}
+
+func (e jwksKey) usable(grace time.Duration) bool {
+	return e.removedAt.IsZero() || time.Since(e.removedAt) < grace
+}
+
+func (e jwksKey) id(kid string) string {
+	switch {
+	case kid != "":
+		return kid
+	case e.x5tS256 != "":
+		return "x5t#S256:" + e.x5tS256
+	case e.x5t != "":
+		return "x5t:" + e.x5t
+	}
+	return ""
+}
+
+func (k jwk) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, errors.New("unsupported curve")
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("invalid EC point")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, errors.New("unsupported curve")
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key size")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, errors.New("unsupported key type")
+}
+
+// ParseJWK parses a single public JWK. Keys carrying private material are
+// rejected.
+func ParseJWK(data []byte) (interface{}, error) {
+	var k jwk
+	if err := json.Unmarshal(data, &k); err != nil {
+		return nil, err
+	}
+	if k.D != "" {
+		return nil, errors.New("JWK contains private key material")
+	}
+	return k.publicKey()
+}
+
+// JWKThumbprint returns the base64url SHA-256 JWK thumbprint of RFC 7638.
+func JWKThumbprint(data []byte) (string, error) {
+	var k jwk
+	if err := json.Unmarshal(data, &k); err != nil {
+		return "", err
+	}
+
+	var members []string
+	switch k.Kty {
+	case "RSA":
+		members = []string{"e", k.E, "kty", k.Kty, "n", k.N}
+	case "EC":
+		members = []string{"crv", k.Crv, "kty", k.Kty, "x", k.X, "y", k.Y}
+	case "OKP":
+		members = []string{"crv", k.Crv, "kty", k.Kty, "x", k.X}
+	default:
+		return "", errors.New("unsupported key type")
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i := 0; i < len(members); i += 2 {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, _ := json.Marshal(members[i])
+		value, _ := json.Marshal(members[i+1])
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+
+	sum := sha256.Sum256(buf.Bytes())
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,423 @@
+package crypto
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestRemoteJWKSKey(t *testing.T) {
+	srv := newKeyServer(t, jwksJSON(t, "k1", &testKey.PublicKey))
+	jwks, err := NewRemoteJWKS(srv.URL, JWKSOptions{RefreshEvery: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jwks.Close()
+
+	if _, err := jwks.Key(tokenWithKID("k1")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jwks.Key(tokenWithKID("k2")); err == nil {
+		t.Fatal("unknown kid accepted")
+	}
+}
+
+func TestRemoteJWKSRejectsErrorStatus(t *testing.T) {
+	srv := newKeyServer(t, jwksJSON(t, "k1", &testKey.PublicKey))
+	srv.status.Store(http.StatusNotFound)
+
+	_, err := NewRemoteJWKS(srv.URL, JWKSOptions{RefreshEvery: time.Hour})
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Fatalf("err = %v, want the 404 status", err)
+	}
+}
+
+func TestRemoteJWKSKeepsKeysOnErrorStatus(t *testing.T) {
+	srv := newKeyServer(t, jwksJSON(t, "k1", &testKey.PublicKey))
+	jwks, err := NewRemoteJWKS(srv.URL, JWKSOptions{RefreshEvery: time.Hour, StrictKID: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jwks.Close()
+
+	// An error page whose body happens to be valid JSON must not replace
+	// the key set.
+	srv.status.Store(http.StatusBadGateway)
+	srv.body.Store([]byte(`{"keys": []}`))
+	if err := jwks.ForceRefresh(); err == nil {
+		t.Fatal("refresh of a 502 response succeeded")
+	}
+	if _, err := jwks.Key(tokenWithKID("k1")); err != nil {
+		t.Fatalf("key dropped after a failed refresh: %v", err)
+	}
+}
+
+func TestRemoteJWKSPinned(t *testing.T) {
+	srv := newKeyServer(t, jwksJSON(t, "k1", &testKey.PublicKey))
+
+	_, err := NewRemoteJWKS(srv.URL, JWKSOptions{RefreshEvery: time.Hour, PinnedFingerprints: []string{"00"}})
+	if err == nil {
+		t.Fatal("unpinned JWKS accepted")
+	}
+
+	jwks, err := NewRemoteJWKS(srv.URL, JWKSOptions{RefreshEvery: time.Hour, PinnedFingerprints: []string{Fingerprint(&testKey.PublicKey)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jwks.Close()
+	if fps := jwks.Metadata().Fingerprints; len(fps) != 1 || fps[0] != Fingerprint(&testKey.PublicKey) {
+		t.Fatalf("Fingerprints = %v", fps)
+	}
+}
+
+func TestRemoteJWKSRotation(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		strict   bool
+		keepsOld bool
+	}{
+		{"overlapping", false, true},
+		{"strict", true, false},
+	} {
+		srv := newKeyServer(t, jwksJSON(t, "k1", &testKey.PublicKey))
+		jwks, err := NewRemoteJWKS(srv.URL, JWKSOptions{RefreshEvery: time.Hour, StrictKID: tc.strict})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer jwks.Close()
+
+		srv.body.Store(jwksJSON(t, "k2", &otherKey.PublicKey))
+		if err := jwks.ForceRefresh(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := jwks.Key(tokenWithKID("k2")); err != nil {
+			t.Errorf("%s: new kid: %v", tc.name, err)
+		}
+		if _, err := jwks.Key(tokenWithKID("k1")); (err == nil) != tc.keepsOld {
+			t.Errorf("%s: rotated out kid: err = %v, want kept %v", tc.name, err, tc.keepsOld)
+		}
+	}
+}
+
+func TestRemoteJWKSStrictKIDKeepsListedKeys(t *testing.T) {
+	srv := newKeyServer(t, jwksOf(t, rsaJWK("k1", &testKey.PublicKey), rsaJWK("k2", &otherKey.PublicKey)))
+	jwks, err := NewRemoteJWKS(srv.URL, JWKSOptions{RefreshEvery: time.Hour, StrictKID: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jwks.Close()
+
+	srv.body.Store(jwksJSON(t, "k2", &otherKey.PublicKey))
+	_ = jwks.ForceRefresh()
+	if key, err := jwks.Key(tokenWithKID("k2")); err != nil || !otherKey.PublicKey.Equal(key) {
+		t.Fatalf("Key(k2) = %v, %v", key, err)
+	}
+}
+
+func selfSigned(t *testing.T) []byte {
+	t.Helper()
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "signing"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &testKey.PublicKey, testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func tokenWithHeader(name, value string) *jwt.Token {
+	return &jwt.Token{Header: map[string]any{name: value}, Method: jwt.SigningMethodRS256}
+}
+
+func TestRemoteJWKSThumbprint(t *testing.T) {
+	der := selfSigned(t)
+	sha1Sum, sha256Sum := sha1.Sum(der), sha256.Sum256(der)
+	x5t := base64.RawURLEncoding.EncodeToString(sha1Sum[:])
+	x5tS256 := base64.RawURLEncoding.EncodeToString(sha256Sum[:])
+
+	declared := rsaJWK("", &testKey.PublicKey)
+	declared["x5t#S256"] = x5tS256
+	derived := rsaJWK("", &otherKey.PublicKey)
+	derived["x5c"] = []string{base64.StdEncoding.EncodeToString(der)}
+
+	for name, tc := range map[string]struct {
+		jwk   map[string]any
+		token *jwt.Token
+		want  *rsa.PublicKey
+	}{
+		"declared x5t#S256": {declared, tokenWithHeader("x5t#S256", x5tS256), &testKey.PublicKey},
+		"x5t from x5c":      {derived, tokenWithHeader("x5t", x5t), &otherKey.PublicKey},
+		"x5t#S256 from x5c": {derived, tokenWithHeader("x5t#S256", x5tS256), &otherKey.PublicKey},
+	} {
+		jwks := newJWKS(t, newKeyServer(t, jwksOf(t, tc.jwk)).URL, JWKSOptions{})
+		key, err := jwks.Key(tc.token)
+		if err != nil || !tc.want.Equal(key) {
+			t.Errorf("%s: key = %v, err = %v", name, key, err)
+		}
+	}
+}
+
+func TestRemoteJWKSThumbprintMismatch(t *testing.T) {
+	jwk := rsaJWK("", &testKey.PublicKey)
+	jwk["x5t"] = "AAAA"
+	jwks := newJWKS(t, newKeyServer(t, jwksOf(t, jwk)).URL, JWKSOptions{})
+
+	if _, err := jwks.Key(tokenWithHeader("x5t", "BBBB")); err == nil {
+		t.Fatal("unknown x5t accepted")
+	}
+}
+
+func TestRemoteJWKSPrefersKID(t *testing.T) {
+	withThumbprint := rsaJWK("", &otherKey.PublicKey)
+	withThumbprint["x5t"] = "AAAA"
+	jwks := newJWKS(t, newKeyServer(t, jwksOf(t, rsaJWK("k1", &testKey.PublicKey), withThumbprint)).URL, JWKSOptions{})
+
+	token := tokenWithKID("k1")
+	token.Header["x5t"] = "AAAA"
+	if key, err := jwks.Key(token); err != nil || !testKey.PublicKey.Equal(key) {
+		t.Fatalf("key = %v, err = %v, want the kid match", key, err)
+	}
+}
+
+func TestRemoteJWKSIsStale(t *testing.T) {
+	jwks := newJWKS(t, newKeyServer(t, jwksJSON(t, "k1", &testKey.PublicKey)).URL, JWKSOptions{StaleAfter: 20 * time.Millisecond})
+	if jwks.IsStale() {
+		t.Fatal("stale right after loading")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if !jwks.IsStale() {
+		t.Fatal("not stale after StaleAfter")
+	}
+	_ = jwks.ForceRefresh()
+	if jwks.IsStale() {
+		t.Fatal("stale after a refresh")
+	}
+}
+
+func TestRemoteJWKSRefreshStats(t *testing.T) {
+	body := jwksJSON(t, "k1", &testKey.PublicKey)
+	srv := newKeyServer(t, body)
+	var successes, failures atomic.Int32
+	var last atomic.Value
+	jwks := newJWKS(t, srv.URL, JWKSOptions{
+		OnRefreshSuccess: func(stats RefreshStats) { successes.Add(1); last.Store(stats) },
+		OnRefreshFailure: func(stats RefreshStats, err error) { failures.Add(1) },
+	})
+
+	stats := last.Load().(RefreshStats)
+	if successes.Load() != 1 || stats.URL != srv.URL || stats.Bytes != len(body) || stats.Duration <= 0 {
+		t.Fatalf("initial fetch: %d successes, stats %+v", successes.Load(), stats)
+	}
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() { defer wg.Done(); _ = jwks.ForceRefresh() }()
+	}
+	wg.Wait()
+	srv.status.Store(http.StatusInternalServerError)
+	_ = jwks.ForceRefresh()
+
+	if successes.Load() != 9 || failures.Load() != 1 {
+		t.Fatalf("%d successes, %d failures, want 9 and 1", successes.Load(), failures.Load())
+	}
+}
+
+func TestRemoteJWKSSigningKeysOnly(t *testing.T) {
+	jwkWith := func(kid string, set func(map[string]any)) map[string]any {
+		k := rsaJWK(kid, &testKey.PublicKey)
+		set(k)
+		return k
+	}
+	jwks := newJWKS(t, newKeyServer(t, jwksOf(t,
+		jwkWith("sig", func(k map[string]any) {}),
+		jwkWith("no-use", func(k map[string]any) { delete(k, "use") }),
+		jwkWith("verify-op", func(k map[string]any) { delete(k, "use"); k["key_ops"] = []string{"verify"} }),
+		jwkWith("enc", func(k map[string]any) { k["use"] = "enc" }),
+		jwkWith("encrypt-op", func(k map[string]any) { delete(k, "use"); k["key_ops"] = []string{"encrypt", "wrapKey"} }),
+		jwkWith("sig-encrypt-op", func(k map[string]any) { k["key_ops"] = []string{"encrypt"} }),
+	)).URL, JWKSOptions{})
+
+	for kid, want := range map[string]bool{
+		"sig":            true,
+		"no-use":         true,
+		"verify-op":      true,
+		"enc":            false,
+		"encrypt-op":     false,
+		"sig-encrypt-op": false,
+	} {
+		if _, err := jwks.Key(tokenWithKID(kid)); (err == nil) != want {
+			t.Errorf("%s: err = %v, want usable %v", kid, err, want)
+		}
+	}
+}
+
+func TestRemoteJWKSOnlyEncryptionKeys(t *testing.T) {
+	k := rsaJWK("enc", &testKey.PublicKey)
+	k["use"] = "enc"
+	if _, err := NewRemoteJWKS(newKeyServer(t, jwksOf(t, k)).URL, JWKSOptions{}); err == nil {
+		t.Fatal("JWKS without signing keys accepted")
+	}
+}
+
+func TestRemoteJWKSRemovedKeyGrace(t *testing.T) {
+	srv := newKeyServer(t, jwksOf(t, rsaJWK("k1", &testKey.PublicKey), rsaJWK("k2", &otherKey.PublicKey)))
+	jwks := newJWKS(t, srv.URL, JWKSOptions{RemovedKeyGrace: 50 * time.Millisecond, StrictKID: true})
+
+	srv.body.Store(jwksJSON(t, "k2", &otherKey.PublicKey))
+	_ = jwks.ForceRefresh()
+	if _, err := jwks.Key(tokenWithKID("k1")); err != nil {
+		t.Fatalf("removed kid dropped within grace: %v", err)
+	}
+
+	// Later refreshes keep the time the key was first seen missing.
+	time.Sleep(30 * time.Millisecond)
+	_ = jwks.ForceRefresh()
+	time.Sleep(30 * time.Millisecond)
+	if _, err := jwks.Key(tokenWithKID("k1")); err == nil {
+		t.Fatal("removed kid still usable after grace")
+	}
+	_ = jwks.ForceRefresh()
+	if _, err := jwks.Key(tokenWithKID("k1")); err == nil {
+		t.Fatal("removed kid still usable after a refresh past grace")
+	}
+}
+
+func TestRemoteJWKSDefaultGraceExpires(t *testing.T) {
+	srv := newKeyServer(t, jwksJSON(t, "k1", &testKey.PublicKey))
+	jwks := newJWKS(t, srv.URL, JWKSOptions{})
+
+	srv.body.Store(jwksJSON(t, "k2", &otherKey.PublicKey))
+	_ = jwks.ForceRefresh()
+	if _, err := jwks.Key(tokenWithKID("k1")); err != nil {
+		t.Fatalf("removed kid dropped within the default grace: %v", err)
+	}
+
+	jwks.mu.Lock()
+	entry := jwks.keys["k1"]
+	entry.removedAt = entry.removedAt.Add(-DefaultRemovedKeyGrace)
+	jwks.keys["k1"] = entry
+	jwks.mu.Unlock()
+	if _, err := jwks.Key(tokenWithKID("k1")); err == nil {
+		t.Fatal("removed kid still usable after the default grace")
+	}
+	_ = jwks.ForceRefresh()
+	if _, ok := jwks.keys["k1"]; ok {
+		t.Fatal("removed kid kept after a refresh past the default grace")
+	}
+}
+
+func TestRemoteJWKSRemovedKeyReturns(t *testing.T) {
+	srv := newKeyServer(t, jwksJSON(t, "k1", &testKey.PublicKey))
+	jwks := newJWKS(t, srv.URL, JWKSOptions{RemovedKeyGrace: 20 * time.Millisecond})
+
+	srv.body.Store(jwksJSON(t, "k2", &otherKey.PublicKey))
+	_ = jwks.ForceRefresh()
+	srv.body.Store(jwksOf(t, rsaJWK("k1", &testKey.PublicKey), rsaJWK("k2", &otherKey.PublicKey)))
+	_ = jwks.ForceRefresh()
+
+	time.Sleep(30 * time.Millisecond)
+	if _, err := jwks.Key(tokenWithKID("k1")); err != nil {
+		t.Fatalf("republished kid expired: %v", err)
+	}
+}
+
+func TestCacheMaxAge(t *testing.T) {
+	for header, want := range map[string]time.Duration{
+		"":                                0,
+		"max-age=300":                     5 * time.Minute,
+		"public, MAX-AGE=60, s-maxage=10": time.Minute,
+		`max-age="120"`:                   2 * time.Minute,
+		"no-cache":                        0,
+		"max-age=-1":                      0,
+		"max-age=soon":                    0,
+	} {
+		if got := cacheMaxAge(header); got != want {
+			t.Errorf("%q: got %v, want %v", header, got, want)
+		}
+	}
+}
+
+func TestRemoteJWKSRespectCacheControl(t *testing.T) {
+	srv := newKeyServer(t, jwksJSON(t, "k1", &testKey.PublicKey))
+
+	for _, tc := range []struct {
+		header string
+		want   time.Duration
+	}{
+		{"max-age=600", 10 * time.Minute},
+		{"max-age=5", time.Minute},
+		{"max-age=604800", 24 * time.Hour},
+		{"no-store", time.Hour},
+	} {
+		srv.header.Store(tc.header)
+		jwks := newJWKS(t, srv.URL, JWKSOptions{RespectCacheControl: true})
+		if got := jwks.nextRefresh(); got != tc.want {
+			t.Errorf("%q: next refresh in %v, want %v", tc.header, got, tc.want)
+		}
+	}
+
+	srv.header.Store("max-age=600")
+	if got := newJWKS(t, srv.URL, JWKSOptions{}).nextRefresh(); got != time.Hour {
+		t.Errorf("without RespectCacheControl: next refresh in %v, want 1h", got)
+	}
+}
+
+func TestRemoteJWKSEd25519(t *testing.T) {
+	pub, _, _ := ed25519.GenerateKey(rand.Reader)
+	okp := map[string]any{"kty": "OKP", "crv": "Ed25519", "kid": "ed", "x": base64.RawURLEncoding.EncodeToString(pub)}
+	badCurve := map[string]any{"kty": "OKP", "crv": "X25519", "kid": "x", "x": base64.RawURLEncoding.EncodeToString(pub)}
+	jwks := newJWKS(t, newKeyServer(t, jwksOf(t, okp, badCurve)).URL, JWKSOptions{})
+
+	if key, err := jwks.Key(tokenWithKID("ed")); err != nil || !pub.Equal(key) {
+		t.Fatalf("Key(ed) = %v, %v", key, err)
+	}
+	if _, err := jwks.Key(tokenWithKID("x")); err == nil {
+		t.Fatal("X25519 key accepted for signatures")
+	}
+}
+
+func TestRemoteJWKSFailureThreshold(t *testing.T) {
+	srv := newKeyServer(t, jwksJSON(t, "k1", &testKey.PublicKey))
+	jwks := newJWKS(t, srv.URL, JWKSOptions{FailureThreshold: 2, MaxBackoff: 10 * time.Second})
+
+	srv.status.Store(http.StatusBadGateway)
+	for i, want := range []bool{true, false, false} {
+		_ = jwks.ForceRefresh()
+		if jwks.Ready() != want {
+			t.Fatalf("after %d failures: Ready = %v, want %v", i+1, !want, want)
+		}
+	}
+	if n := jwks.Metadata().ConsecutiveFailures; n != 3 {
+		t.Fatalf("ConsecutiveFailures = %d, want 3", n)
+	}
+	if wait := jwks.nextRefresh(); wait != 10*time.Second {
+		t.Fatalf("backoff = %v, want the 10s ceiling", wait)
+	}
+	if _, err := jwks.Key(tokenWithKID("k1")); err != nil {
+		t.Fatalf("keys dropped while unhealthy: %v", err)
+	}
+
+	srv.status.Store(http.StatusOK)
+	if err := jwks.ForceRefresh(); err != nil || !jwks.Ready() {
+		t.Fatalf("not recovered: %v", err)
+	}
+}
@@ -1,80 +1,218 @@
 package crypto
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rsa"
-	"crypto/x509"
-	"encoding/pem"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"sync"
 	"time"
 )
 
+// KeyFormat is the encoding of the key served at a RemotePublicKey URL.
+type KeyFormat int
+
+const (
+	// KeyFormatPEM is a PEM encoded RSA, EC or Ed25519 public key or certificate.
+	KeyFormatPEM KeyFormat = iota
+	// KeyFormatEd25519Raw is the raw 32-byte Ed25519 public key in base64,
+	// standard or URL alphabet, with or without padding.
+	KeyFormatEd25519Raw
+)
+
+type RemotePublicKeyOptions struct {
+	RefreshEvery time.Duration
+	// Format defaults to KeyFormatPEM.
+	Format KeyFormat
+	// Background returns from the constructor without waiting for the first
+	// fetch, which is retried with backoff until it succeeds. Until then
+	// Ready is false and Key returns ErrNotReady.
+	Background bool
+	// FailureThreshold is the number of consecutive refresh failures after
+	// which Ready reports false, until the next success. Zero never marks
+	// the provider unhealthy; the last key keeps verifying either way.
+	FailureThreshold int
+	// MaxBackoff caps the wait between retries of a failing fetch, which
+	// starts at InitialRetryEvery and doubles. Defaults to RefreshEvery.
+	MaxBackoff time.Duration
+	// PinnedFingerprints, when set, lists the accepted Fingerprint values.
+	// A fetched key outside the list fails the refresh with ErrUnpinnedKey
+	// and the previous key stays in use, so a compromised key server cannot
+	// swap in its own key.
+	PinnedFingerprints []string
+	// OnRefreshSuccess and OnRefreshFailure are called after every key fetch,
+	// including the initial one.
+	OnRefreshSuccess func(stats RefreshStats)
+	OnRefreshFailure func(stats RefreshStats, err error)
+}
+
 type RemotePublicKey struct {
-	url          string
-	publicKey    *rsa.PublicKey
-	lastUpdated  time.Time
-	refreshEvery time.Duration
-	mu           sync.RWMutex
+	url         string
+	opts        RemotePublicKeyOptions
+	publicKey   interface{}
+	lastUpdated time.Time
+	failures    int
+	mu          sync.RWMutex
+	done        chan struct{}
+	closeOnce   sync.Once
+	initial     initialFetch
 }
 
 func NewRemotePublicKey(url string, refreshEvery time.Duration) (*RemotePublicKey, error) {
+	return NewRemotePublicKeyWithOptions(url, RemotePublicKeyOptions{RefreshEvery: refreshEvery})
+}
+
+func NewRemotePublicKeyWithOptions(url string, opts RemotePublicKeyOptions) (*RemotePublicKey, error) {
+	return NewRemotePublicKeyWithContext(context.Background(), url, opts)
+}
+
+// NewRemotePublicKeyWithContext bounds the initial fetch by ctx, so startup
+// code can enforce a time budget: when ctx is done first the fetch is
+// abandoned and its error, wrapping ctx.Err(), is returned. Later background
+// refreshes do not use ctx. With opts.Background ctx is not used.
+func NewRemotePublicKeyWithContext(ctx context.Context, url string, opts RemotePublicKeyOptions) (*RemotePublicKey, error) {
+	if opts.RefreshEvery <= 0 {
+		opts.RefreshEvery = 5 * time.Minute
+	}
 	r := &RemotePublicKey{
-		url:          url,
-		refreshEvery: refreshEvery,
+		url:  url,
+		opts: opts,
+		done: make(chan struct{}),
 	}
-	if err := r.refresh(); err != nil {
-		return nil, err
+	r.initial.done = make(chan struct{})
+	if !opts.Background {
+		if err := r.refreshContext(ctx); err != nil {
+			return nil, err
+		}
 	}
 	go r.autoRefresh()
 	return r, nil
 }
 
 func (r *RemotePublicKey) autoRefresh() {
-	ticker := time.NewTicker(r.refreshEvery)
-	for range ticker.C {
-		_ = r.refresh()
+	if r.opts.Background {
+		_ = r.initial.run(context.Background(), r.refreshContext)
 	}
+	timer := time.NewTimer(r.nextRefresh())
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			_ = r.refresh()
+			timer.Reset(r.nextRefresh())
+		case <-r.done:
+			return
+		}
+	}
+}
+
+func (r *RemotePublicKey) nextRefresh() time.Duration {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return nextRefresh(r.failures, r.opts.RefreshEvery, r.opts.MaxBackoff)
+}
+
+// Close stops the refresh loop. The last fetched key stays usable.
+func (r *RemotePublicKey) Close() error {
+	r.closeOnce.Do(func() { close(r.done) })
+	return nil
 }
 
 func (r *RemotePublicKey) refresh() error {
-	resp, err := http.Get(r.url)
+	return r.refreshContext(context.Background())
+}
+
+func (r *RemotePublicKey) refreshContext(ctx context.Context) error {
+	start := time.Now()
+	n, err := r.fetch(ctx)
+	r.mu.Lock()
 	if err != nil {
-		return err
+		r.failures++
+	} else {
+		r.failures = 0
 	}
-	defer resp.Body.Close()
+	r.mu.Unlock()
+	reportRefresh(RefreshStats{URL: r.url, Duration: time.Since(start), Bytes: n}, err,
+		r.opts.OnRefreshSuccess, r.opts.OnRefreshFailure)
+	return err
+}
 
-	raw, err := io.ReadAll(resp.Body)
+func (r *RemotePublicKey) fetch(ctx context.Context) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.url, nil)
 	if err != nil {
-		return err
+		return 0, err
 	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
 
-	block, _ := pem.Decode(raw)
-	if block == nil {
-		return errors.New("invalid PEM")
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return 0, fmt.Errorf("key server responded %s", resp.Status)
 	}
 
-	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	raw, err := readLimited(resp.Body)
 	if err != nil {
-		return err
+		return len(raw), err
 	}
 
-	rsaPub, ok := pub.(*rsa.PublicKey)
-	if !ok {
-		return errors.New("not RSA public key")
+	var pub interface{}
+	switch r.opts.Format {
+	case KeyFormatEd25519Raw:
+		pub, err = parseEd25519Raw(raw)
+	default:
+		pub, err = parsePublicKeyPEM(raw)
+	}
+	if err != nil {
+		return len(raw), err
+	}
+
+	switch pub.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey:
+	default:
+		return len(raw), fmt.Errorf("unsupported public key type %T", pub)
+	}
+	if err := checkPinned(pub, r.opts.PinnedFingerprints); err != nil {
+		return len(raw), err
 	}
 
 	r.mu.Lock()
-	r.publicKey = rsaPub
+	r.publicKey = pub
 	r.lastUpdated = time.Now()
 	r.mu.Unlock()
 
-	return nil
+	return len(raw), nil
 }
 
+// Get returns the RSA public key, or nil when the served key is not RSA.
 func (r *RemotePublicKey) Get() *rsa.PublicKey {
+	rsaPub, _ := r.PublicKey().(*rsa.PublicKey)
+	return rsaPub
+}
+
+// PublicKey returns the current key: *rsa.PublicKey, *ecdsa.PublicKey or
+// ed25519.PublicKey.
+func (r *RemotePublicKey) PublicKey() interface{} {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 	return r.publicKey
 }
+
+// MaxKeyResponseBytes caps the size of a key or JWKS response body.
+const MaxKeyResponseBytes = 1 << 20
+
+func readLimited(r io.Reader) ([]byte, error) {
+	raw, err := io.ReadAll(io.LimitReader(r, MaxKeyResponseBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) > MaxKeyResponseBytes {
+		return nil, errors.New("key response too large")
+	}
+	return raw, nil
+}
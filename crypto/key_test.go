@@ -0,0 +1,184 @@
+package crypto
+
+import (
+	"context"
+	"crypto/rsa"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRemotePublicKeyFetch(t *testing.T) {
+	srv := newKeyServer(t, publicKeyPEM(t, &testKey.PublicKey))
+
+	key, err := NewRemotePublicKeyWithOptions(srv.URL, RemotePublicKeyOptions{RefreshEvery: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer key.Close()
+
+	if pub := key.Get(); pub == nil || !pub.Equal(&testKey.PublicKey) {
+		t.Fatal("served key not loaded")
+	}
+	if !key.Ready() {
+		t.Fatal("key not ready after the initial fetch")
+	}
+}
+
+func TestRemotePublicKeyRejectsErrorStatus(t *testing.T) {
+	srv := newKeyServer(t, publicKeyPEM(t, &testKey.PublicKey))
+	srv.status.Store(http.StatusServiceUnavailable)
+
+	_, err := NewRemotePublicKeyWithOptions(srv.URL, RemotePublicKeyOptions{RefreshEvery: time.Hour})
+	if err == nil || !strings.Contains(err.Error(), "503") {
+		t.Fatalf("err = %v, want the 503 status", err)
+	}
+}
+
+func TestRemotePublicKeyKeepsKeyOnFailedRefresh(t *testing.T) {
+	srv := newKeyServer(t, publicKeyPEM(t, &testKey.PublicKey))
+	key, err := NewRemotePublicKeyWithOptions(srv.URL, RemotePublicKeyOptions{RefreshEvery: time.Hour, FailureThreshold: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer key.Close()
+
+	srv.status.Store(http.StatusInternalServerError)
+	if err := key.ForceRefresh(); err == nil {
+		t.Fatal("refresh of a 500 response succeeded")
+	}
+	if pub, _ := key.PublicKey().(*rsa.PublicKey); pub == nil || !pub.Equal(&testKey.PublicKey) {
+		t.Fatal("previous key dropped")
+	}
+	if key.Ready() {
+		t.Fatal("still ready after FailureThreshold failures")
+	}
+	if n := key.Metadata().ConsecutiveFailures; n != 1 {
+		t.Fatalf("ConsecutiveFailures = %d, want 1", n)
+	}
+}
+
+func TestRemotePublicKeyPinned(t *testing.T) {
+	srv := newKeyServer(t, publicKeyPEM(t, &testKey.PublicKey))
+	fp := Fingerprint(&testKey.PublicKey)
+
+	key, err := NewRemotePublicKeyWithOptions(srv.URL, RemotePublicKeyOptions{RefreshEvery: time.Hour, PinnedFingerprints: []string{strings.ToUpper(fp)}})
+	if err != nil {
+		t.Fatalf("pinned key rejected: %v", err)
+	}
+	key.Close()
+}
+
+func TestNextRefresh(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		failures int
+		interval time.Duration
+		ceiling  time.Duration
+		want     time.Duration
+	}{
+		{"healthy", 0, time.Hour, time.Minute, time.Hour},
+		{"first failure", 1, time.Hour, 0, InitialRetryEvery},
+		{"doubles", 3, time.Hour, 0, 4 * InitialRetryEvery},
+		{"capped by interval", 20, time.Minute, 0, time.Minute},
+		{"capped by ceiling", 20, time.Hour, 30 * time.Second, 30 * time.Second},
+		{"ceiling above interval", 20, time.Minute, time.Hour, time.Hour},
+	} {
+		if got := nextRefresh(tc.failures, tc.interval, tc.ceiling); got != tc.want {
+			t.Errorf("%s: %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestRemotePublicKeyFailureThreshold(t *testing.T) {
+	srv := newKeyServer(t, publicKeyPEM(t, &testKey.PublicKey))
+	key, err := NewRemotePublicKeyWithOptions(srv.URL, RemotePublicKeyOptions{
+		RefreshEvery:     time.Hour,
+		FailureThreshold: 3,
+		MaxBackoff:       time.Minute,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer key.Close()
+
+	srv.status.Store(http.StatusInternalServerError)
+	for i := 1; i <= 3; i++ {
+		_ = key.ForceRefresh()
+		if ready, want := key.Ready(), i < 3; ready != want {
+			t.Fatalf("after %d failures: Ready = %v, want %v", i, ready, want)
+		}
+		if n := key.Metadata().ConsecutiveFailures; n != i {
+			t.Fatalf("ConsecutiveFailures = %d, want %d", n, i)
+		}
+	}
+	if wait := key.nextRefresh(); wait != 4*InitialRetryEvery {
+		t.Fatalf("backoff = %v, want %v", wait, 4*InitialRetryEvery)
+	}
+
+	srv.status.Store(http.StatusOK)
+	if err := key.ForceRefresh(); err != nil {
+		t.Fatal(err)
+	}
+	if !key.Ready() || key.Metadata().ConsecutiveFailures != 0 || key.nextRefresh() != time.Hour {
+		t.Fatal("not recovered after a successful refresh")
+	}
+}
+
+func TestRemotePublicKeyWithContextDeadline(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	key, err := NewRemotePublicKeyWithContext(ctx, srv.URL, RemotePublicKeyOptions{RefreshEvery: time.Hour})
+	if !errors.Is(err, context.DeadlineExceeded) || key != nil {
+		t.Fatalf("err = %v, want a deadline error", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("constructor blocked for %v", elapsed)
+	}
+}
+
+func TestRemotePublicKeyWithContextOutlivesContext(t *testing.T) {
+	srv := newKeyServer(t, publicKeyPEM(t, &testKey.PublicKey))
+	ctx, cancel := context.WithCancel(context.Background())
+	key, err := NewRemotePublicKeyWithContext(ctx, srv.URL, RemotePublicKeyOptions{RefreshEvery: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer key.Close()
+	cancel()
+
+	if err := key.ForceRefresh(); err != nil {
+		t.Fatalf("refresh after the startup context ended: %v", err)
+	}
+	if srv.requests.Load() != 2 {
+		t.Fatalf("requests = %d, want 2", srv.requests.Load())
+	}
+}
+
+func TestRemotePublicKeyParsedOnce(t *testing.T) {
+	srv := newKeyServer(t, publicKeyPEM(t, &testKey.PublicKey))
+	key, err := NewRemotePublicKeyWithOptions(srv.URL, RemotePublicKeyOptions{RefreshEvery: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer key.Close()
+
+	token := tokenWithKID("")
+	if allocs := testing.AllocsPerRun(100, func() { _, _ = key.Key(token) }); allocs != 0 {
+		t.Fatalf("Key allocates %v times per call, want the cached key", allocs)
+	}
+}
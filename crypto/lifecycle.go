@@ -0,0 +1,107 @@
+package crypto
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// Lifecycle is implemented by providers that can be driven by the start and
+// stop hooks of a DI container, e.g. with Uber Fx:
+//
+//	lc.Append(fx.Hook{OnStart: jwks.Start, OnStop: jwks.Stop})
+//
+// Construct the provider with Background set so that the constructor does
+// no I/O, then Start blocks until the first fetch has succeeded.
+type Lifecycle interface {
+	// Start fetches the keys bounded by ctx unless they are already loaded.
+	// It returns the fetch error, so a failing source aborts startup. When
+	// the refresh loop of a Background provider is already making its first
+	// fetch, Start waits for that one instead of fetching again.
+	Start(ctx context.Context) error
+	// Stop stops the refresh loop, like Close.
+	Stop(ctx context.Context) error
+}
+
+func (r *RemotePublicKey) Start(ctx context.Context) error {
+	if r.PublicKey() != nil {
+		return nil
+	}
+	return r.initial.run(ctx, r.refreshContext)
+}
+
+func (r *RemotePublicKey) Stop(context.Context) error {
+	return r.Close()
+}
+
+func (r *RemoteJWKS) Start(ctx context.Context) error {
+	r.mu.RLock()
+	loaded := !r.lastUpdated.IsZero()
+	r.mu.RUnlock()
+	if loaded {
+		return nil
+	}
+	return r.initial.run(ctx, r.refreshContext)
+}
+
+func (r *RemoteJWKS) Stop(context.Context) error {
+	return r.Close()
+}
+
+// Start preloads every URL and joins their errors.
+func (m *MultiJWKS) Start(ctx context.Context) error {
+	var errs []error
+	for _, source := range m.list() {
+		errs = append(errs, source.Start(ctx))
+	}
+	return errors.Join(errs...)
+}
+
+func (m *MultiJWKS) Stop(context.Context) error {
+	return m.Close()
+}
+
+func (r *RevocationList) Start(ctx context.Context) error {
+	r.mu.RLock()
+	loaded := r.revoked != nil
+	r.mu.RUnlock()
+	if loaded {
+		return nil
+	}
+	return r.initial.run(ctx, r.refreshContext)
+}
+
+func (r *RevocationList) Stop(context.Context) error {
+	return r.Close()
+}
+
+// initialFetch lets Start and the refresh loop of a Background provider
+// share the first fetch, so that they do not race and count one failure
+// twice.
+type initialFetch struct {
+	started atomic.Bool
+	done    chan struct{}
+	err     error
+}
+
+// run performs the first fetch, or waits for the one in flight and returns
+// its result. Once the first fetch has completed, run fetches again.
+func (f *initialFetch) run(ctx context.Context, fetch func(context.Context) error) error {
+	if f.started.CompareAndSwap(false, true) {
+		f.err = fetch(ctx)
+		close(f.done)
+		return f.err
+	}
+	select {
+	case <-f.done:
+		return fetch(ctx)
+	default:
+	}
+	select {
+	case <-f.done:
+		return f.err
+	case <-ctx.Done():
+		return fmt.Errorf("waiting for the initial fetch: %w", ctx.Err())
+	}
+}
@@ -0,0 +1,117 @@
+package crypto
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var (
+	_ Lifecycle = (*RemotePublicKey)(nil)
+	_ Lifecycle = (*RemoteJWKS)(nil)
+	_ Lifecycle = (*MultiJWKS)(nil)
+	_ Lifecycle = (*RevocationList)(nil)
+)
+
+func TestLifecycleStart(t *testing.T) {
+	pem := newKeyServer(t, publicKeyPEM(t, &testKey.PublicKey))
+	jwks := newKeyServer(t, jwksJSON(t, "k1", &testKey.PublicKey))
+
+	key, err := NewRemotePublicKeyWithOptions(pem.URL, RemotePublicKeyOptions{RefreshEvery: time.Hour, Background: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer key.Close()
+	set := newJWKS(t, jwks.URL, JWKSOptions{Background: true})
+
+	for name, lc := range map[string]interface {
+		Lifecycle
+		Ready() bool
+	}{"key": key, "jwks": set} {
+		if err := lc.Start(context.Background()); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !lc.Ready() {
+			t.Fatalf("%s: not ready after Start", name)
+		}
+	}
+}
+
+func TestLifecycleStartSkipsLoaded(t *testing.T) {
+	srv := newKeyServer(t, jwksJSON(t, "k1", &testKey.PublicKey))
+	jwks := newJWKS(t, srv.URL, JWKSOptions{})
+
+	if err := jwks.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := srv.requests.Load(); n != 1 {
+		t.Fatalf("requests = %d, want only the constructor fetch", n)
+	}
+}
+
+func TestLifecycleStartFails(t *testing.T) {
+	srv := newKeyServer(t, nil)
+	srv.status.Store(http.StatusServiceUnavailable)
+	key, err := NewRemotePublicKeyWithOptions(srv.URL, RemotePublicKeyOptions{RefreshEvery: time.Hour, Background: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer key.Close()
+
+	if err := key.Start(context.Background()); err == nil {
+		t.Fatal("Start succeeded against a failing server")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	srv.status.Store(http.StatusOK)
+	if err := key.Start(ctx); err == nil {
+		t.Fatal("Start ignored its canceled context")
+	}
+}
+
+func TestLifecycleStartSharesInitialFetch(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		time.Sleep(50 * time.Millisecond)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	key, err := NewRemotePublicKeyWithOptions(srv.URL, RemotePublicKeyOptions{RefreshEvery: time.Hour, Background: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer key.Close()
+
+	if err := key.Start(context.Background()); err == nil {
+		t.Fatal("Start succeeded against a failing server")
+	}
+	key.mu.RLock()
+	failures := key.failures
+	key.mu.RUnlock()
+	if n := requests.Load(); n != 1 || failures != 1 {
+		t.Fatalf("requests = %d, failures = %d, want one shared fetch", n, failures)
+	}
+}
+
+func TestLifecycleStop(t *testing.T) {
+	srv := newKeyServer(t, jwksJSON(t, "k1", &testKey.PublicKey))
+	jwks := newJWKS(t, srv.URL, JWKSOptions{RefreshEvery: 10 * time.Millisecond})
+
+	if err := jwks.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	stopped := srv.requests.Load()
+	time.Sleep(50 * time.Millisecond)
+	if n := srv.requests.Load(); n != stopped {
+		t.Fatalf("refreshed %d times after Stop", n-stopped)
+	}
+	if _, err := jwks.Key(tokenWithKID("k1")); err != nil {
+		t.Fatalf("keys dropped by Stop: %v", err)
+	}
+}
@@ -0,0 +1,147 @@
+package crypto
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// MultiJWKS merges several JWKS endpoints, e.g. a primary IdP and a partner,
+// into one key set. Each URL is refreshed independently. When a kid is
+// published by more than one URL the first URL wins and the collision is
+// logged.
+type MultiJWKS struct {
+	sources  []*RemoteJWKS
+	mu       sync.Mutex
+	reported map[string]bool
+}
+
+func NewMultiJWKS(urls []string, opts JWKSOptions) (*MultiJWKS, error) {
+	if len(urls) == 0 {
+		return nil, errors.New("at least one JWKS URL is required")
+	}
+
+	m := &MultiJWKS{reported: map[string]bool{}}
+	onSuccess := opts.OnRefreshSuccess
+	opts.OnRefreshSuccess = func(stats RefreshStats) {
+		m.checkCollisions()
+		if onSuccess != nil {
+			onSuccess(stats)
+		}
+	}
+
+	for _, url := range urls {
+		source, err := NewRemoteJWKS(url, opts)
+		if err != nil {
+			_ = m.Close()
+			return nil, err
+		}
+		m.mu.Lock()
+		m.sources = append(m.sources, source)
+		m.mu.Unlock()
+	}
+	m.checkCollisions()
+	return m, nil
+}
+
+func (m *MultiJWKS) list() []*RemoteJWKS {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.sources
+}
+
+func (m *MultiJWKS) checkCollisions() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	owner := map[string]string{}
+	for _, source := range m.sources {
+		for _, kid := range source.Metadata().KeyIDs {
+			first, seen := owner[kid]
+			if !seen {
+				owner[kid] = source.url
+				continue
+			}
+			if !m.reported[kid] {
+				m.reported[kid] = true
+				log.Printf("[go-middle] WARNING: kid %q is published by both %s and %s, using %s\n", kid, first, source.url, first)
+			}
+		}
+	}
+}
+
+// Key resolves the token against each URL in order.
+func (m *MultiJWKS) Key(t *jwt.Token) (interface{}, error) {
+	var err error
+	for _, source := range m.list() {
+		var key interface{}
+		if key, err = source.Key(t); err == nil {
+			return key, nil
+		}
+	}
+	return nil, err
+}
+
+func (m *MultiJWKS) ForceRefresh() error {
+	var errs []error
+	for _, source := range m.list() {
+		errs = append(errs, source.ForceRefresh())
+	}
+	return errors.Join(errs...)
+}
+
+// Metadata merges the key IDs of every URL. LastUpdated and
+// ConsecutiveFailures are those of the least healthy URL.
+func (m *MultiJWKS) Metadata() KeyMetadata {
+	var meta KeyMetadata
+	var urls []string
+	seen := map[string]bool{}
+	for _, source := range m.list() {
+		sm := source.Metadata()
+		urls = append(urls, sm.URL)
+		meta.ConsecutiveFailures = max(meta.ConsecutiveFailures, sm.ConsecutiveFailures)
+		if meta.LastUpdated.IsZero() || sm.LastUpdated.Before(meta.LastUpdated) {
+			meta.LastUpdated = sm.LastUpdated
+		}
+		for _, kid := range sm.KeyIDs {
+			if !seen[kid] {
+				seen[kid] = true
+				meta.KeyIDs = append(meta.KeyIDs, kid)
+			}
+		}
+	}
+	meta.URL = strings.Join(urls, ",")
+	sort.Strings(meta.KeyIDs)
+	return meta
+}
+
+// IsStale reports whether any URL is stale.
+func (m *MultiJWKS) IsStale() bool {
+	for _, source := range m.list() {
+		if source.IsStale() {
+			return true
+		}
+	}
+	return false
+}
+
+// Ready reports whether every URL has completed its first fetch.
+func (m *MultiJWKS) Ready() bool {
+	for _, source := range m.list() {
+		if !source.Ready() {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *MultiJWKS) Close() error {
+	for _, source := range m.list() {
+		_ = source.Close()
+	}
+	return nil
+}
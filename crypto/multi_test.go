@@ -0,0 +1,76 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newMulti(t *testing.T, urls ...string) *MultiJWKS {
+	t.Helper()
+	m, err := NewMultiJWKS(urls, JWKSOptions{RefreshEvery: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { m.Close() })
+	return m
+}
+
+func TestMultiJWKSMergesKeys(t *testing.T) {
+	primary := newKeyServer(t, jwksJSON(t, "primary", &testKey.PublicKey))
+	partner := newKeyServer(t, jwksJSON(t, "partner", &otherKey.PublicKey))
+	m := newMulti(t, primary.URL, partner.URL)
+
+	for kid, want := range map[string]*rsa.PublicKey{"primary": &testKey.PublicKey, "partner": &otherKey.PublicKey} {
+		if key, err := m.Key(tokenWithKID(kid)); err != nil || !want.Equal(key) {
+			t.Errorf("Key(%s) = %v, %v", kid, key, err)
+		}
+	}
+	if _, err := m.Key(tokenWithKID("other")); err == nil {
+		t.Error("unknown kid accepted")
+	}
+
+	meta := m.Metadata()
+	if meta.URL != primary.URL+","+partner.URL || len(meta.KeyIDs) != 2 || meta.KeyIDs[0] != "partner" {
+		t.Errorf("Metadata = %+v", meta)
+	}
+	if !m.Ready() || m.IsStale() {
+		t.Errorf("Ready = %v, IsStale = %v", m.Ready(), m.IsStale())
+	}
+}
+
+func TestMultiJWKSCollision(t *testing.T) {
+	var buf bytes.Buffer
+	prev := log.Writer()
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(prev) })
+
+	primary := newKeyServer(t, jwksJSON(t, "shared", &testKey.PublicKey))
+	partner := newKeyServer(t, jwksJSON(t, "shared", &otherKey.PublicKey))
+	m := newMulti(t, primary.URL, partner.URL)
+
+	if key, err := m.Key(tokenWithKID("shared")); err != nil || !testKey.PublicKey.Equal(key) {
+		t.Fatalf("Key(shared) = %v, %v, want the first URL's key", key, err)
+	}
+	_ = m.ForceRefresh()
+	if n := strings.Count(buf.String(), `kid "shared" is published by both`); n != 1 {
+		t.Fatalf("collision logged %d times:\n%s", n, buf.String())
+	}
+}
+
+func TestMultiJWKSFailingURL(t *testing.T) {
+	ok := newKeyServer(t, jwksJSON(t, "k1", &testKey.PublicKey))
+	down := newKeyServer(t, nil)
+	down.status.Store(http.StatusInternalServerError)
+
+	if _, err := NewMultiJWKS([]string{ok.URL, down.URL}, JWKSOptions{RefreshEvery: time.Hour}); err == nil {
+		t.Fatal("failing URL accepted")
+	}
+	if _, err := NewMultiJWKS(nil, JWKSOptions{}); err == nil {
+		t.Fatal("empty URL list accepted")
+	}
+}
@@ -0,0 +1,75 @@
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var pemParsers = []struct {
+	blockType string
+	parse     func(der []byte) (interface{}, error)
+}{
+	{"PUBLIC KEY", x509.ParsePKIXPublicKey},
+	{"RSA PUBLIC KEY", func(der []byte) (interface{}, error) {
+		return x509.ParsePKCS1PublicKey(der)
+	}},
+	{"CERTIFICATE", func(der []byte) (interface{}, error) {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, err
+		}
+		return cert.PublicKey, nil
+	}},
+	{"EC PUBLIC KEY", func(der []byte) (interface{}, error) {
+		pub, err := x509.ParsePKIXPublicKey(der)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := pub.(*ecdsa.PublicKey); !ok {
+			return nil, errors.New("EC PUBLIC KEY block does not hold an EC key")
+		}
+		return pub, nil
+	}},
+}
+
+// parseEd25519Raw decodes a base64 encoded raw Ed25519 public key.
+func parseEd25519Raw(raw []byte) (interface{}, error) {
+	text := strings.TrimRight(strings.TrimSpace(string(raw)), "=")
+	encoding := base64.RawStdEncoding
+	if strings.ContainsAny(text, "-_") {
+		encoding = base64.RawURLEncoding
+	}
+	key, err := encoding.DecodeString(text)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("raw Ed25519 key must be %d bytes, got %d", ed25519.PublicKeySize, len(key))
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// parsePublicKeyPEM decodes the first PEM block of raw and parses it
+// according to its block type.
+func parsePublicKeyPEM(raw []byte) (interface{}, error) {
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, errors.New("invalid PEM")
+	}
+
+	tried := make([]string, 0, len(pemParsers))
+	for _, p := range pemParsers {
+		if p.blockType == block.Type {
+			return p.parse(block.Bytes)
+		}
+		tried = append(tried, p.blockType)
+	}
+
+	return nil, fmt.Errorf("unsupported PEM block type %q, expected one of: %s", block.Type, strings.Join(tried, ", "))
+}
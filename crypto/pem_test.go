@@ -0,0 +1,121 @@
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func pemBlock(blockType string, der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+}
+
+func TestParsePublicKeyPEM(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ecDER, _ := x509.MarshalPKIXPublicKey(&ecKey.PublicKey)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "auth.example.com"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &testKey.PublicKey, testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, raw := range map[string][]byte{
+		"PUBLIC KEY":     publicKeyPEM(t, &testKey.PublicKey),
+		"RSA PUBLIC KEY": pemBlock("RSA PUBLIC KEY", x509.MarshalPKCS1PublicKey(&testKey.PublicKey)),
+		"CERTIFICATE":    pemBlock("CERTIFICATE", certDER),
+	} {
+		key, err := parsePublicKeyPEM(raw)
+		if pub, ok := key.(*rsa.PublicKey); err != nil || !ok || !pub.Equal(&testKey.PublicKey) {
+			t.Errorf("%s: key = %T, err = %v", name, key, err)
+		}
+	}
+
+	key, err := parsePublicKeyPEM(pemBlock("EC PUBLIC KEY", ecDER))
+	if pub, ok := key.(*ecdsa.PublicKey); err != nil || !ok || !pub.Equal(&ecKey.PublicKey) {
+		t.Errorf("EC PUBLIC KEY: key = %T, err = %v", key, err)
+	}
+}
+
+func TestParsePublicKeyPEMErrors(t *testing.T) {
+	rsaDER, _ := x509.MarshalPKIXPublicKey(&testKey.PublicKey)
+
+	if _, err := parsePublicKeyPEM([]byte("not pem")); err == nil {
+		t.Error("non-PEM input accepted")
+	}
+	if _, err := parsePublicKeyPEM(pemBlock("EC PUBLIC KEY", rsaDER)); err == nil {
+		t.Error("RSA key in an EC PUBLIC KEY block accepted")
+	}
+	_, err := parsePublicKeyPEM(pemBlock("OPENSSH PUBLIC KEY", rsaDER))
+	if err == nil || !strings.Contains(err.Error(), `"OPENSSH PUBLIC KEY"`) || !strings.Contains(err.Error(), "RSA PUBLIC KEY") {
+		t.Errorf("err = %v, want the block type and the supported types", err)
+	}
+}
+
+func TestParseEd25519Raw(t *testing.T) {
+	pub, _, _ := ed25519.GenerateKey(rand.Reader)
+
+	for name, raw := range map[string]string{
+		"std":            base64.StdEncoding.EncodeToString(pub),
+		"raw std":        base64.RawStdEncoding.EncodeToString(pub),
+		"url":            base64.URLEncoding.EncodeToString(pub),
+		"with a newline": base64.StdEncoding.EncodeToString(pub) + "\n",
+	} {
+		key, err := parseEd25519Raw([]byte(raw))
+		if got, ok := key.(ed25519.PublicKey); err != nil || !ok || !got.Equal(pub) {
+			t.Errorf("%s: key = %v, err = %v", name, key, err)
+		}
+	}
+
+	if _, err := parseEd25519Raw([]byte(base64.StdEncoding.EncodeToString(pub[:16]))); err == nil {
+		t.Error("short key accepted")
+	}
+	if _, err := parseEd25519Raw([]byte("not base64!")); err == nil {
+		t.Error("invalid base64 accepted")
+	}
+}
+
+func TestRemotePublicKeyEd25519(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	tokenStr, err := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{"sub": "alice"}).SignedString(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, tc := range map[string]struct {
+		body   []byte
+		format KeyFormat
+	}{
+		"PEM": {publicKeyPEM(t, pub), KeyFormatPEM},
+		"raw": {[]byte(base64.StdEncoding.EncodeToString(pub)), KeyFormatEd25519Raw},
+	} {
+		key, err := NewRemotePublicKeyWithOptions(newKeyServer(t, tc.body).URL, RemotePublicKeyOptions{RefreshEvery: time.Hour, Format: tc.format})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		defer key.Close()
+
+		if _, err := jwt.Parse(tokenStr, key.Key, jwt.WithValidMethods([]string{"EdDSA"})); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		if key.Get() != nil {
+			t.Errorf("%s: Get returned an RSA key", name)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type KeyProvider interface {
+	Key(t *jwt.Token) (interface{}, error)
+}
+
+// Refresher is implemented by providers that can reload their keys on demand.
+type Refresher interface {
+	ForceRefresh() error
+	Metadata() KeyMetadata
+}
+
+// StaleChecker is implemented by providers that can tell when their keys
+// have not been refreshed for too long.
+type StaleChecker interface {
+	IsStale() bool
+}
+
+// ReadyChecker is implemented by providers that can report readiness, for
+// use in readiness probes. A provider is not ready before its first key
+// fetch completes (see RemotePublicKeyOptions.Background) or after
+// FailureThreshold consecutive refresh failures.
+type ReadyChecker interface {
+	Ready() bool
+}
+
+// ErrNotReady is returned by Key until the first key fetch succeeds.
+var ErrNotReady = errors.New("keys not loaded yet")
+
+// InitialRetryEvery is the wait before retrying a failed fetch. It doubles
+// on every consecutive failure up to the MaxBackoff option.
+const InitialRetryEvery = 5 * time.Second
+
+type KeyMetadata struct {
+	URL          string    `json:"url"`
+	LastUpdated  time.Time `json:"last_updated"`
+	KeyIDs       []string  `json:"key_ids,omitempty"`
+	Fingerprints []string  `json:"fingerprints,omitempty"`
+	// ConsecutiveFailures counts the refreshes that failed since the last
+	// successful one.
+	ConsecutiveFailures int `json:"consecutive_failures"`
+}
+
+// RefreshStats describes a single key fetch, measured from the start of the
+// request until the response is parsed.
+type RefreshStats struct {
+	URL      string
+	Duration time.Duration
+	Bytes    int
+}
+
+func reportRefresh(stats RefreshStats, err error, onSuccess func(RefreshStats), onFailure func(RefreshStats, error)) {
+	if err != nil {
+		if onFailure != nil {
+			onFailure(stats, err)
+		}
+		return
+	}
+	if onSuccess != nil {
+		onSuccess(stats)
+	}
+}
+
+// nextRefresh returns the wait before the next fetch: interval after a
+// success, otherwise InitialRetryEvery doubled per consecutive failure and
+// capped at ceiling, which defaults to interval.
+func nextRefresh(failures int, interval, ceiling time.Duration) time.Duration {
+	if failures == 0 {
+		return interval
+	}
+	if ceiling <= 0 {
+		ceiling = interval
+	}
+	wait := InitialRetryEvery
+	for i := 1; i < failures && wait < ceiling; i++ {
+		wait *= 2
+	}
+	return min(wait, ceiling)
+}
+
+func healthy(failures, threshold int) bool {
+	return threshold <= 0 || failures < threshold
+}
+
+func (r *RemotePublicKey) Key(t *jwt.Token) (interface{}, error) {
+	if pub := r.PublicKey(); pub != nil {
+		return pub, nil
+	}
+	return nil, ErrNotReady
+}
+
+// Ready reports whether a key is loaded and fewer than FailureThreshold
+// refreshes have failed in a row.
+func (r *RemotePublicKey) Ready() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.publicKey != nil && healthy(r.failures, r.opts.FailureThreshold)
+}
+
+func (r *RemotePublicKey) ForceRefresh() error {
+	return r.refresh()
+}
+
+func (r *RemotePublicKey) Metadata() KeyMetadata {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return KeyMetadata{
+		URL:                 r.url,
+		LastUpdated:         r.lastUpdated,
+		Fingerprints:        []string{Fingerprint(r.publicKey)},
+		ConsecutiveFailures: r.failures,
+	}
+}
+
+// IsStale reports whether the key has not been refreshed for three refresh
+// intervals.
+func (r *RemotePublicKey) IsStale() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return !r.lastUpdated.IsZero() && time.Since(r.lastUpdated) > 3*r.opts.RefreshEvery
+}
+
+func (r *RemoteJWKS) IsStale() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	staleAfter := r.opts.StaleAfter
+	if staleAfter <= 0 {
+		staleAfter = 3 * r.refreshIntervalLocked()
+	}
+	return !r.lastUpdated.IsZero() && time.Since(r.lastUpdated) > staleAfter
+}
+
+// Ready reports whether the JWKS is loaded and fewer than FailureThreshold
+// refreshes have failed in a row.
+func (r *RemoteJWKS) Ready() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return !r.lastUpdated.IsZero() && healthy(r.failures, r.opts.FailureThreshold)
+}
+
+func (r *RemoteJWKS) ForceRefresh() error {
+	return r.refresh()
+}
+
+func (r *RemoteJWKS) Metadata() KeyMetadata {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	meta := KeyMetadata{URL: r.url, LastUpdated: r.lastUpdated, ConsecutiveFailures: r.failures}
+	for kid := range r.keys {
+		meta.KeyIDs = append(meta.KeyIDs, kid)
+	}
+	sort.Strings(meta.KeyIDs)
+	for _, kid := range meta.KeyIDs {
+		meta.Fingerprints = append(meta.Fingerprints, Fingerprint(r.keys[kid].pub))
+	}
+	return meta
+}
+
+// ErrUnpinnedKey is returned by a refresh that fetched a key whose
+// Fingerprint is not one of the PinnedFingerprints option.
+var ErrUnpinnedKey = errors.New("key fingerprint is not pinned")
+
+// checkPinned returns ErrUnpinnedKey unless pins is empty or contains the
+// fingerprint of pub. Pins are compared ignoring case and colons, so both
+// Fingerprint output and the AB:CD:... notation work.
+func checkPinned(pub interface{}, pins []string) error {
+	if len(pins) == 0 {
+		return nil
+	}
+	fp := Fingerprint(pub)
+	for _, pin := range pins {
+		if fp != "" && strings.EqualFold(strings.ReplaceAll(pin, ":", ""), fp) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrUnpinnedKey, fp)
+}
+
+// Fingerprint returns the hex SHA-256 of the PKIX DER encoding of pub.
+func Fingerprint(pub interface{}) string {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
+}
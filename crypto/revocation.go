@@ -0,0 +1,224 @@
+package crypto
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type RevocationListOptions struct {
+	RefreshEvery time.Duration
+	// Background, FailureThreshold and MaxBackoff work as in
+	// RemotePublicKeyOptions.
+	Background       bool
+	FailureThreshold int
+	MaxBackoff       time.Duration
+	// OnRefreshSuccess and OnRefreshFailure are called after every list
+	// fetch, including the initial one and those answered 304 Not Modified.
+	OnRefreshSuccess func(stats RefreshStats)
+	OnRefreshFailure func(stats RefreshStats, err error)
+}
+
+// RevocationList is a periodically refreshed copy of a published list of
+// revoked jti values. It satisfies middleware.RevocationChecker with an
+// in-memory lookup, so checking a token does no I/O. The list is served
+// either as a JSON array of strings or as an object with a "revoked" array,
+// and is fetched conditionally with If-None-Match when the server sends an
+// ETag.
+type RevocationList struct {
+	url         string
+	opts        RevocationListOptions
+	revoked     map[string]struct{}
+	etag        string
+	lastUpdated time.Time
+	failures    int
+	mu          sync.RWMutex
+	done        chan struct{}
+	closeOnce   sync.Once
+	initial     initialFetch
+}
+
+func NewRevocationList(url string, opts RevocationListOptions) (*RevocationList, error) {
+	if opts.RefreshEvery <= 0 {
+		opts.RefreshEvery = time.Minute
+	}
+	r := &RevocationList{
+		url:  url,
+		opts: opts,
+		done: make(chan struct{}),
+	}
+	r.initial.done = make(chan struct{})
+	if !opts.Background {
+		if err := r.refresh(); err != nil {
+			return nil, err
+		}
+	}
+	go r.autoRefresh()
+	return r, nil
+}
+
+func (r *RevocationList) autoRefresh() {
+	if r.opts.Background {
+		_ = r.initial.run(context.Background(), r.refreshContext)
+	}
+	timer := time.NewTimer(r.nextRefresh())
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			_ = r.refresh()
+			timer.Reset(r.nextRefresh())
+		case <-r.done:
+			return
+		}
+	}
+}
+
+func (r *RevocationList) nextRefresh() time.Duration {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return nextRefresh(r.failures, r.opts.RefreshEvery, r.opts.MaxBackoff)
+}
+
+// Close stops the refresh loop. The last fetched list stays in use.
+func (r *RevocationList) Close() error {
+	r.closeOnce.Do(func() { close(r.done) })
+	return nil
+}
+
+func (r *RevocationList) refresh() error {
+	return r.refreshContext(context.Background())
+}
+
+func (r *RevocationList) refreshContext(ctx context.Context) error {
+	start := time.Now()
+	n, err := r.fetch(ctx)
+	r.mu.Lock()
+	if err != nil {
+		r.failures++
+	} else {
+		r.failures = 0
+	}
+	r.mu.Unlock()
+	reportRefresh(RefreshStats{URL: r.url, Duration: time.Since(start), Bytes: n}, err,
+		r.opts.OnRefreshSuccess, r.opts.OnRefreshFailure)
+	return err
+}
+
+func (r *RevocationList) fetch(ctx context.Context) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return 0, err
+	}
+	r.mu.RLock()
+	if r.etag != "" && r.revoked != nil {
+		req.Header.Set("If-None-Match", r.etag)
+	}
+	r.mu.RUnlock()
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		r.mu.Lock()
+		r.lastUpdated = time.Now()
+		r.mu.Unlock()
+		return 0, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("revocation list responded %s", resp.Status)
+	}
+
+	raw, err := readLimited(resp.Body)
+	if err != nil {
+		return len(raw), err
+	}
+	jtis, err := parseRevocationList(raw)
+	if err != nil {
+		return len(raw), err
+	}
+
+	revoked := make(map[string]struct{}, len(jtis))
+	for _, jti := range jtis {
+		revoked[jti] = struct{}{}
+	}
+
+	r.mu.Lock()
+	r.revoked = revoked
+	r.etag = resp.Header.Get("ETag")
+	r.lastUpdated = time.Now()
+	r.mu.Unlock()
+
+	return len(raw), nil
+}
+
+func parseRevocationList(raw []byte) ([]string, error) {
+	var jtis []string
+	if err := json.Unmarshal(raw, &jtis); err == nil {
+		return jtis, nil
+	}
+	var doc struct {
+		Revoked *[]string `json:"revoked"`
+	}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	if doc.Revoked == nil {
+		return nil, errors.New("revocation list has no revoked array")
+	}
+	return *doc.Revoked, nil
+}
+
+// IsRevoked reports whether the token's jti is on the list. Tokens without
+// a jti are never revoked. Until the first fetch succeeds it returns
+// ErrNotReady, which the middleware reports as revocation_unavailable.
+func (r *RevocationList) IsRevoked(_ context.Context, claims jwt.MapClaims) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.revoked == nil {
+		return false, ErrNotReady
+	}
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return false, nil
+	}
+	_, revoked := r.revoked[jti]
+	return revoked, nil
+}
+
+// Ready reports whether the list is loaded and fewer than FailureThreshold
+// refreshes have failed in a row.
+func (r *RevocationList) Ready() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.revoked != nil && healthy(r.failures, r.opts.FailureThreshold)
+}
+
+// IsStale reports whether the list has not been refreshed for three refresh
+// intervals.
+func (r *RevocationList) IsStale() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return !r.lastUpdated.IsZero() && time.Since(r.lastUpdated) > 3*r.opts.RefreshEvery
+}
+
+func (r *RevocationList) ForceRefresh() error {
+	return r.refresh()
+}
+
+// Len returns the number of revoked jti values in the current list.
+func (r *RevocationList) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.revoked)
+}
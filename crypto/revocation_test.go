@@ -0,0 +1,157 @@
+package crypto
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// revocationServer serves body with an ETag derived from its version and
+// answers If-None-Match for the current version with 304, counting them.
+type revocationServer struct {
+	*httptest.Server
+	body        atomic.Value
+	version     atomic.Int32
+	notModified atomic.Int32
+}
+
+func newRevocationServer(t *testing.T, body string) *revocationServer {
+	t.Helper()
+	s := &revocationServer{}
+	s.body.Store(body)
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		etag := strconv.Quote("v" + strconv.Itoa(int(s.version.Load())))
+		if r.Header.Get("If-None-Match") == etag {
+			s.notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Write([]byte(s.body.Load().(string)))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *revocationServer) publish(body string) {
+	s.body.Store(body)
+	s.version.Add(1)
+}
+
+func revoked(t *testing.T, list *RevocationList, jti string) bool {
+	t.Helper()
+	claims := jwt.MapClaims{"sub": "alice"}
+	if jti != "" {
+		claims["jti"] = jti
+	}
+	ok, err := list.IsRevoked(context.Background(), claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ok
+}
+
+func TestRevocationList(t *testing.T) {
+	for name, body := range map[string]string{
+		"array":  `["j1","j2"]`,
+		"object": `{"revoked":["j1","j2"]}`,
+	} {
+		srv := newRevocationServer(t, body)
+		list, err := NewRevocationList(srv.URL, RevocationListOptions{RefreshEvery: time.Hour})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		for jti, want := range map[string]bool{"j1": true, "j2": true, "j3": false, "": false} {
+			if got := revoked(t, list, jti); got != want {
+				t.Errorf("%s: %q revoked = %v, want %v", name, jti, got, want)
+			}
+		}
+		if list.Len() != 2 || !list.Ready() {
+			t.Errorf("%s: Len = %d, Ready = %v", name, list.Len(), list.Ready())
+		}
+		list.Close()
+	}
+}
+
+func TestRevocationListInvalid(t *testing.T) {
+	for name, body := range map[string]string{
+		"not JSON":    `revoked: j1`,
+		"no revoked":  `{"jtis":["j1"]}`,
+		"wrong shape": `{"revoked":"j1"}`,
+		"non-string":  `[1,2]`,
+	} {
+		srv := newRevocationServer(t, body)
+		if _, err := NewRevocationList(srv.URL, RevocationListOptions{RefreshEvery: time.Hour}); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
+
+func TestRevocationListRefreshesOnInterval(t *testing.T) {
+	srv := newRevocationServer(t, `["j1"]`)
+	list, err := NewRevocationList(srv.URL, RevocationListOptions{RefreshEvery: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer list.Close()
+
+	if revoked(t, list, "j2") {
+		t.Fatal("j2 revoked before it was published")
+	}
+	srv.publish(`["j1","j2"]`)
+	for deadline := time.Now().Add(5 * time.Second); !revoked(t, list, "j2"); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("list never refreshed")
+		}
+	}
+}
+
+func TestRevocationListETag(t *testing.T) {
+	srv := newRevocationServer(t, `["j1"]`)
+	list, err := NewRevocationList(srv.URL, RevocationListOptions{RefreshEvery: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer list.Close()
+
+	if err := list.ForceRefresh(); err != nil {
+		t.Fatal(err)
+	}
+	if srv.notModified.Load() != 1 || !revoked(t, list, "j1") {
+		t.Fatalf("304 responses = %d, want 1 with the list kept", srv.notModified.Load())
+	}
+
+	srv.publish(`[]`)
+	if err := list.ForceRefresh(); err != nil {
+		t.Fatal(err)
+	}
+	if revoked(t, list, "j1") || srv.notModified.Load() != 1 {
+		t.Fatal("changed list not fetched")
+	}
+}
+
+func TestRevocationListNotReady(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write([]byte(`[]`))
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	list, err := NewRevocationList(srv.URL, RevocationListOptions{RefreshEvery: time.Hour, Background: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer list.Close()
+	if _, err := list.IsRevoked(context.Background(), jwt.MapClaims{"jti": "j1"}); !errors.Is(err, ErrNotReady) || list.Ready() {
+		t.Fatalf("err = %v, want ErrNotReady", err)
+	}
+}
@@ -0,0 +1,160 @@
+package crypto
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type sharedFetcher interface {
+	KeyProvider
+	Refresher
+	StaleChecker
+	ReadyChecker
+	Lifecycle
+	Close() error
+}
+
+// sharedEntry is created empty under shared.mu and filled in by the first
+// acquirer, so the initial fetch runs without holding the lock. ready is
+// closed once fetcher or err is set.
+type sharedEntry struct {
+	ready   chan struct{}
+	fetcher sharedFetcher
+	err     error
+	refs    int
+}
+
+var shared = struct {
+	mu      sync.Mutex
+	entries map[string]*sharedEntry
+}{entries: map[string]*sharedEntry{}}
+
+// hookedSeq numbers the dedicated fetchers of handles with refresh hooks.
+var hookedSeq atomic.Uint64
+
+// SharedKey is a handle on a fetcher shared by every provider created for
+// the same URL and options. The fetcher and its refresh loop stop when the
+// last handle is closed.
+type SharedKey struct {
+	name      string
+	entry     *sharedEntry
+	fetcher   sharedFetcher
+	closeOnce sync.Once
+}
+
+// SharedRemotePublicKey is like NewRemotePublicKeyWithOptions, but reuses
+// the fetcher of an open handle for the same url and options. Handles with
+// different options, e.g. other PinnedFingerprints, get their own fetcher,
+// and so does every handle with OnRefreshSuccess or OnRefreshFailure set.
+func SharedRemotePublicKey(url string, opts RemotePublicKeyOptions) (*SharedKey, error) {
+	hooked := opts.OnRefreshSuccess != nil || opts.OnRefreshFailure != nil
+	return acquireShared(sharedName("pem", url, opts, hooked), func() (sharedFetcher, error) {
+		return NewRemotePublicKeyWithOptions(url, opts)
+	})
+}
+
+// SharedRemoteJWKS is like NewRemoteJWKS, but reuses the fetcher of an open
+// handle for the same url and options. Handles with refresh hooks get their
+// own fetcher.
+func SharedRemoteJWKS(url string, opts JWKSOptions) (*SharedKey, error) {
+	hooked := opts.OnRefreshSuccess != nil || opts.OnRefreshFailure != nil
+	return acquireShared(sharedName("jwks", url, opts, hooked), func() (sharedFetcher, error) {
+		return NewRemoteJWKS(url, opts)
+	})
+}
+
+// sharedName keys a fetcher by kind, url and a digest of its options.
+// Hooks print as code pointers, so closures of one function literal would
+// digest alike; hooked options get a name of their own so every handle's
+// hooks fire.
+func sharedName(kind, url string, opts any, hooked bool) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%#v", opts)))
+	name := kind + ":" + url + "#" + hex.EncodeToString(sum[:8])
+	if hooked {
+		name += fmt.Sprintf("#%d", hookedSeq.Add(1))
+	}
+	return name
+}
+
+func acquireShared(name string, create func() (sharedFetcher, error)) (*SharedKey, error) {
+	shared.mu.Lock()
+	entry, ok := shared.entries[name]
+	if !ok {
+		entry = &sharedEntry{ready: make(chan struct{})}
+		shared.entries[name] = entry
+	}
+	entry.refs++
+	shared.mu.Unlock()
+
+	if !ok {
+		entry.fetcher, entry.err = create()
+		if entry.err != nil {
+			shared.mu.Lock()
+			if shared.entries[name] == entry {
+				delete(shared.entries, name)
+			}
+			shared.mu.Unlock()
+		}
+		close(entry.ready)
+	}
+
+	<-entry.ready
+	if entry.err != nil {
+		return nil, entry.err
+	}
+	return &SharedKey{name: name, entry: entry, fetcher: entry.fetcher}, nil
+}
+
+func (s *SharedKey) Key(t *jwt.Token) (interface{}, error) {
+	return s.fetcher.Key(t)
+}
+
+func (s *SharedKey) ForceRefresh() error {
+	return s.fetcher.ForceRefresh()
+}
+
+func (s *SharedKey) Metadata() KeyMetadata {
+	return s.fetcher.Metadata()
+}
+
+func (s *SharedKey) IsStale() bool {
+	return s.fetcher.IsStale()
+}
+
+func (s *SharedKey) Ready() bool {
+	return s.fetcher.Ready()
+}
+
+// Start preloads the shared fetcher, see Lifecycle.
+func (s *SharedKey) Start(ctx context.Context) error {
+	return s.fetcher.Start(ctx)
+}
+
+// Stop releases the handle like Close.
+func (s *SharedKey) Stop(context.Context) error {
+	return s.Close()
+}
+
+// Close releases the handle. Closing a handle more than once is a no-op.
+func (s *SharedKey) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		shared.mu.Lock()
+		defer shared.mu.Unlock()
+
+		if shared.entries[s.name] != s.entry {
+			return
+		}
+		if s.entry.refs--; s.entry.refs == 0 {
+			delete(shared.entries, s.name)
+			err = s.fetcher.Close()
+		}
+	})
+	return err
+}
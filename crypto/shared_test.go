@@ -0,0 +1,165 @@
+package crypto
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSharedRemotePublicKeyReusesFetcher(t *testing.T) {
+	srv := newKeyServer(t, publicKeyPEM(t, &testKey.PublicKey))
+	opts := RemotePublicKeyOptions{RefreshEvery: time.Hour}
+
+	a, err := SharedRemotePublicKey(srv.URL, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	b, err := SharedRemotePublicKey(srv.URL, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	if a.fetcher != b.fetcher {
+		t.Fatal("handles with equal options do not share a fetcher")
+	}
+	if n := srv.requests.Load(); n != 1 {
+		t.Fatalf("%d fetches, want 1", n)
+	}
+}
+
+func TestSharedRemotePublicKeySeparatesPins(t *testing.T) {
+	srv := newKeyServer(t, publicKeyPEM(t, &testKey.PublicKey))
+
+	open, err := SharedRemotePublicKey(srv.URL, RemotePublicKeyOptions{RefreshEvery: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer open.Close()
+
+	_, err = SharedRemotePublicKey(srv.URL, RemotePublicKeyOptions{RefreshEvery: time.Hour, PinnedFingerprints: []string{"00"}})
+	if !errors.Is(err, ErrUnpinnedKey) {
+		t.Fatalf("err = %v, want ErrUnpinnedKey", err)
+	}
+}
+
+func TestSharedKeyCloseStopsFetcher(t *testing.T) {
+	srv := newKeyServer(t, publicKeyPEM(t, &testKey.PublicKey))
+	opts := RemotePublicKeyOptions{RefreshEvery: time.Hour}
+
+	a, _ := SharedRemotePublicKey(srv.URL, opts)
+	b, _ := SharedRemotePublicKey(srv.URL, opts)
+	a.Close()
+	a.Close()
+
+	shared.mu.Lock()
+	_, open := shared.entries[b.name]
+	shared.mu.Unlock()
+	if !open {
+		t.Fatal("fetcher closed while a handle is open")
+	}
+
+	b.Close()
+	shared.mu.Lock()
+	_, open = shared.entries[b.name]
+	shared.mu.Unlock()
+	if open {
+		t.Fatal("fetcher still registered after the last Close")
+	}
+}
+
+func TestSharedFetchDoesNotBlockOtherURLs(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Write(publicKeyPEM(t, &testKey.PublicKey))
+	}))
+	defer slow.Close()
+	fast := newKeyServer(t, publicKeyPEM(t, &testKey.PublicKey))
+
+	slowDone := make(chan struct{})
+	go func() {
+		defer close(slowDone)
+		if key, err := SharedRemotePublicKey(slow.URL, RemotePublicKeyOptions{}); err == nil {
+			key.Close()
+		}
+	}()
+	<-started
+
+	done := make(chan error, 1)
+	go func() {
+		key, err := SharedRemotePublicKey(fast.URL, RemotePublicKeyOptions{})
+		if err == nil {
+			key.Close()
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("acquiring a fast URL waited for a slow initial fetch")
+	}
+	close(release)
+	<-slowDone
+}
+
+func TestSharedConcurrentAcquire(t *testing.T) {
+	srv := newKeyServer(t, publicKeyPEM(t, &testKey.PublicKey))
+
+	keys := make([]*SharedKey, 8)
+	var wg sync.WaitGroup
+	for i := range keys {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			key, err := SharedRemotePublicKey(srv.URL, RemotePublicKeyOptions{})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			keys[i] = key
+		}()
+	}
+	wg.Wait()
+
+	for _, key := range keys {
+		if key != nil {
+			defer key.Close()
+		}
+	}
+	if n := srv.requests.Load(); n != 1 {
+		t.Fatalf("%d fetches, want 1", n)
+	}
+}
+
+func TestSharedHooksFireForEveryHandle(t *testing.T) {
+	srv := newKeyServer(t, publicKeyPEM(t, &testKey.PublicKey))
+
+	var calls [2]atomic.Int32
+	for i := range calls {
+		opts := RemotePublicKeyOptions{
+			RefreshEvery:     time.Hour,
+			OnRefreshSuccess: func(RefreshStats) { calls[i].Add(1) },
+		}
+		key, err := SharedRemotePublicKey(srv.URL, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer key.Close()
+	}
+
+	for i := range calls {
+		if n := calls[i].Load(); n != 1 {
+			t.Errorf("handle %d: hook called %d times, want 1", i, n)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package grpcmiddleware
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"maps"
+	"net/http"
+
+	"github.com/digitcodestudiotech/go-middle/middleware"
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+type claimsKey struct{}
+
+// UnaryServerInterceptor verifies the bearer token in the authorization
+// metadata with middleware.Validate, the same core used by the Gin
+// middleware. opts.Provider must be set; share it with the Gin middleware to
+// verify both transports against the same keys. MTLSBound is checked against
+// the client certificate of the TLS peer. Options that need an HTTP request,
+// such as DPoP, CSRFClaim, AllowedCIDRs, MinTLSVersion, StaleMode and
+// UserResolver, are not supported and panic.
+func UnaryServerInterceptor(opts middleware.Options) grpc.UnaryServerInterceptor {
+	mustSupport(opts)
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := authenticate(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor is the streaming counterpart of
+// UnaryServerInterceptor.
+func StreamServerInterceptor(opts middleware.Options) grpc.StreamServerInterceptor {
+	mustSupport(opts)
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticate(ss.Context(), opts)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// ClaimsFromIncomingContext returns the claims stored by the interceptors.
+// They are the same jwt.MapClaims that middleware.Claims returns in Gin for
+// the same token.
+func ClaimsFromIncomingContext(ctx context.Context) (jwt.MapClaims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(jwt.MapClaims)
+	return claims, ok
+}
+
+func mustSupport(opts middleware.Options) {
+	if opts.Provider == nil {
+		panic("[go-middle] grpcmiddleware requires Options.Provider")
+	}
+	for _, o := range []struct {
+		name string
+		set  bool
+	}{
+		{"DPoP", opts.DPoP},
+		{"CSRFClaim", opts.CSRFClaim != ""},
+		{"AllowedCIDRs", len(opts.AllowedCIDRs) > 0},
+		{"MinTLSVersion", opts.MinTLSVersion != 0},
+		{"RejectInsecureCiphers", opts.RejectInsecureCiphers},
+		{"StaleMode", opts.StaleMode != middleware.StaleAllow},
+		{"UserResolver", opts.UserResolver != nil},
+	} {
+		if o.set {
+			panic("[go-middle] Options." + o.name + " is not supported by grpcmiddleware")
+		}
+	}
+}
+
+func authenticate(ctx context.Context, opts middleware.Options) (context.Context, error) {
+	tokenStr, err := bearerToken(ctx)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	claims, err := middleware.Validate(ctx, tokenStr, opts)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	if opts.MTLSBound {
+		if err := middleware.CheckCertificateBinding(peerTLS(ctx), claims); err != nil {
+			return nil, statusError(err)
+		}
+	}
+	if opts.ClaimsTransform != nil {
+		if claims = opts.ClaimsTransform(maps.Clone(claims)); claims == nil {
+			return nil, statusError(middleware.ErrClaimsRejected)
+		}
+	}
+	return context.WithValue(ctx, claimsKey{}, claims), nil
+}
+
+// bearerToken reads the authorization metadata, which gRPC-Web proxies
+// forward from the Authorization header.
+func bearerToken(ctx context.Context) (string, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var auth string
+	if values := md.Get("authorization"); len(values) > 0 {
+		auth = values[0]
+	}
+	return middleware.BearerToken(auth)
+}
+
+// peerTLS returns the TLS state of the connection, or nil when the server
+// has no TLS transport credentials.
+func peerTLS(ctx context.Context) *tls.ConnectionState {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return nil
+	}
+	return &info.State
+}
+
+// statusError maps the HTTP status of an AuthError to the matching gRPC code.
+func statusError(err error) error {
+	var authErr *middleware.AuthError
+	if !errors.As(err, &authErr) {
+		return status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	code := codes.Unauthenticated
+	switch authErr.Status {
+	case http.StatusBadRequest:
+		code = codes.InvalidArgument
+	case http.StatusForbidden:
+		code = codes.PermissionDenied
+	case http.StatusTooManyRequests:
+		code = codes.ResourceExhausted
+	case http.StatusServiceUnavailable:
+		code = codes.Unavailable
+	case http.StatusInternalServerError:
+		code = codes.Internal
+	}
+	return status.Error(code, authErr.Message)
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,259 @@
+package grpcmiddleware
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/digitcodestudiotech/go-middle/middleware"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+var testKey = func() *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}()
+
+type staticKey struct{}
+
+func (staticKey) Key(*jwt.Token) (interface{}, error) { return &testKey.PublicKey, nil }
+
+func sign(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	claims["exp"] = time.Now().Add(time.Hour).Unix()
+	tokenStr, err := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tokenStr
+}
+
+// healthServer records the claims seen by its unary and streaming handlers.
+type healthServer struct {
+	grpc_health_v1.UnimplementedHealthServer
+	unary, stream jwt.MapClaims
+}
+
+func (s *healthServer) Check(ctx context.Context, _ *grpc_health_v1.HealthCheckRequest) (*grpc_health_v1.HealthCheckResponse, error) {
+	s.unary, _ = ClaimsFromIncomingContext(ctx)
+	return &grpc_health_v1.HealthCheckResponse{Status: grpc_health_v1.HealthCheckResponse_SERVING}, nil
+}
+
+func (s *healthServer) Watch(_ *grpc_health_v1.HealthCheckRequest, ss grpc_health_v1.Health_WatchServer) error {
+	s.stream, _ = ClaimsFromIncomingContext(ss.Context())
+	return ss.Send(&grpc_health_v1.HealthCheckResponse{Status: grpc_health_v1.HealthCheckResponse_SERVING})
+}
+
+// dial starts a server with both interceptors over an in-memory listener.
+func dial(t *testing.T, opts middleware.Options) (grpc_health_v1.HealthClient, *healthServer) {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer(
+		grpc.UnaryInterceptor(UnaryServerInterceptor(opts)),
+		grpc.StreamInterceptor(StreamServerInterceptor(opts)),
+	)
+	health := &healthServer{}
+	grpc_health_v1.RegisterHealthServer(srv, health)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return grpc_health_v1.NewHealthClient(conn), health
+}
+
+func withToken(auth string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", auth)
+}
+
+// ginClaims returns the claims the Gin middleware exposes for tokenStr.
+func ginClaims(t *testing.T, tokenStr string, opts middleware.Options) jwt.MapClaims {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	var claims jwt.MapClaims
+	r := gin.New()
+	r.GET("/", middleware.VerifyTokenWithOptions(opts), func(c *gin.Context) {
+		claims, _ = middleware.Claims(c)
+	})
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+tokenStr)
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	return claims
+}
+
+func TestClaimsMatchGin(t *testing.T) {
+	opts := middleware.Options{Provider: staticKey{}}
+	tokenStr := sign(t, jwt.MapClaims{
+		"sub":          "alice",
+		"aud":          []string{"api"},
+		"realm_access": map[string]any{"roles": []string{"admin"}},
+	})
+	client, health := dial(t, opts)
+
+	if _, err := client.Check(withToken("Bearer "+tokenStr), &grpc_health_v1.HealthCheckRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	stream, err := client.Watch(withToken("Bearer "+tokenStr), &grpc_health_v1.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := ginClaims(t, tokenStr, opts)
+	if want == nil {
+		t.Fatal("no claims from Gin")
+	}
+	if !reflect.DeepEqual(health.unary, want) {
+		t.Errorf("unary claims = %#v, want %#v", health.unary, want)
+	}
+	if !reflect.DeepEqual(health.stream, want) {
+		t.Errorf("stream claims = %#v, want %#v", health.stream, want)
+	}
+}
+
+func TestClaimsTransformMatchesGin(t *testing.T) {
+	opts := middleware.Options{
+		Provider: staticKey{},
+		ClaimsTransform: func(claims jwt.MapClaims) jwt.MapClaims {
+			claims["sub"] = strings.ToUpper(claims["sub"].(string))
+			return claims
+		},
+	}
+	tokenStr := sign(t, jwt.MapClaims{"sub": "alice"})
+	client, health := dial(t, opts)
+
+	if _, err := client.Check(withToken("Bearer "+tokenStr), &grpc_health_v1.HealthCheckRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	if want := ginClaims(t, tokenStr, opts); !reflect.DeepEqual(health.unary, want) || want["sub"] != "ALICE" {
+		t.Fatalf("claims = %#v, want %#v", health.unary, want)
+	}
+}
+
+func TestRejectedCodes(t *testing.T) {
+	client, _ := dial(t, middleware.Options{Provider: staticKey{}, MaxTokenBytes: 64})
+
+	for _, tc := range []struct {
+		name string
+		ctx  context.Context
+		want codes.Code
+	}{
+		{"missing", context.Background(), codes.Unauthenticated},
+		{"basic", withToken("Basic dXNlcjpwYXNz"), codes.Unauthenticated},
+		{"garbage", withToken("Bearer not-a-token"), codes.Unauthenticated},
+		{"too large", withToken("Bearer " + sign(t, jwt.MapClaims{"sub": "alice"})), codes.InvalidArgument},
+	} {
+		_, err := client.Check(tc.ctx, &grpc_health_v1.HealthCheckRequest{})
+		if got := status.Code(err); got != tc.want {
+			t.Errorf("%s: code %s, want %s", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestRejectedStream(t *testing.T) {
+	client, health := dial(t, middleware.Options{Provider: staticKey{}})
+
+	stream, err := client.Watch(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.Unauthenticated || health.stream != nil {
+		t.Fatalf("err = %v, want Unauthenticated", err)
+	}
+}
+
+func TestInterceptorsRequireProvider(t *testing.T) {
+	for name, build := range map[string]func(){
+		"unary":  func() { UnaryServerInterceptor(middleware.Options{}) },
+		"stream": func() { StreamServerInterceptor(middleware.Options{}) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: missing provider accepted", name)
+				}
+			}()
+			build()
+		}()
+	}
+}
+
+func TestInterceptorsRejectUnsupportedOptions(t *testing.T) {
+	for name, opts := range map[string]middleware.Options{
+		"DPoP":         {DPoP: true},
+		"CSRFClaim":    {CSRFClaim: "csrf"},
+		"AllowedCIDRs": {AllowedCIDRs: []string{"10.0.0.0/8"}},
+		"TLS":          {MinTLSVersion: tls.VersionTLS12},
+		"ciphers":      {RejectInsecureCiphers: true},
+		"StaleMode":    {StaleMode: middleware.StaleReject},
+		"UserResolver": {UserResolver: func(jwt.MapClaims) (any, error) { return nil, nil }},
+	} {
+		opts.Provider = staticKey{}
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: unsupported option accepted", name)
+				}
+			}()
+			UnaryServerInterceptor(opts)
+		}()
+	}
+}
+
+func TestMTLSBound(t *testing.T) {
+	cert := &x509.Certificate{Raw: []byte("client certificate DER")}
+	sum := sha256.Sum256(cert.Raw)
+	tokenStr := sign(t, jwt.MapClaims{"sub": "alice", "cnf": map[string]any{"x5t#S256": base64.RawURLEncoding.EncodeToString(sum[:])}})
+	opts := middleware.Options{Provider: staticKey{}, MTLSBound: true}
+
+	incoming := func(authInfo credentials.AuthInfo) context.Context {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+tokenStr))
+		return peer.NewContext(ctx, &peer.Peer{AuthInfo: authInfo})
+	}
+	for _, tc := range []struct {
+		name     string
+		authInfo credentials.AuthInfo
+		want     codes.Code
+	}{
+		{"bound", credentials.TLSInfo{State: tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}}, codes.OK},
+		{"other certificate", credentials.TLSInfo{State: tls.ConnectionState{PeerCertificates: []*x509.Certificate{{Raw: []byte("other")}}}}, codes.Unauthenticated},
+		{"insecure", nil, codes.Unauthenticated},
+	} {
+		_, err := authenticate(incoming(tc.authInfo), opts)
+		if got := status.Code(err); got != tc.want {
+			t.Errorf("%s: code %s, want %s", tc.name, got, tc.want)
+		}
+	}
+}
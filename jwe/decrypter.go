@@ -0,0 +1,39 @@
+package jwe
+
+import (
+	"crypto/rsa"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	jwxjwe "github.com/lestrrat-go/jwx/v2/jwe"
+)
+
+// Decrypter unwraps compact JWE tokens so the inner JWS can be verified by
+// middleware.Options.Decrypter.
+type Decrypter struct {
+	alg jwa.KeyEncryptionAlgorithm
+	key interface{}
+}
+
+func New(alg jwa.KeyEncryptionAlgorithm, key interface{}) *Decrypter {
+	return &Decrypter{alg: alg, key: key}
+}
+
+func NewRSAOAEP(key *rsa.PrivateKey) *Decrypter {
+	return New(jwa.RSA_OAEP, key)
+}
+
+func NewRSAOAEP256(key *rsa.PrivateKey) *Decrypter {
+	return New(jwa.RSA_OAEP_256, key)
+}
+
+func NewDirect(key []byte) *Decrypter {
+	return New(jwa.DIRECT, key)
+}
+
+func (d *Decrypter) Decrypt(token string) (string, error) {
+	payload, err := jwxjwe.Decrypt([]byte(token), jwxjwe.WithKey(d.alg, d.key))
+	if err != nil {
+		return "", err
+	}
+	return string(payload), nil
+}
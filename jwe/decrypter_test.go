@@ -0,0 +1,109 @@
+package jwe
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/digitcodestudiotech/go-middle/middleware"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	jwxjwe "github.com/lestrrat-go/jwx/v2/jwe"
+)
+
+type staticKey struct{ key *rsa.PublicKey }
+
+func (k staticKey) Key(*jwt.Token) (interface{}, error) { return k.key, nil }
+
+func generateKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// nested signs claims with signer and encrypts the JWS to encKey.
+func nested(t *testing.T, signer *rsa.PrivateKey, alg jwa.KeyEncryptionAlgorithm, encKey interface{}) string {
+	t.Helper()
+	jws, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"sub": "alice",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}).SignedString(signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := jwxjwe.Encrypt([]byte(jws), jwxjwe.WithKey(alg, encKey), jwxjwe.WithContentEncryption(jwa.A256GCM))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(raw)
+}
+
+func TestDecrypt(t *testing.T) {
+	signer, encKey := generateKey(t), generateKey(t)
+	secret := make([]byte, 32)
+	_, _ = rand.Read(secret)
+
+	for name, tc := range map[string]struct {
+		decrypter *Decrypter
+		alg       jwa.KeyEncryptionAlgorithm
+		encKey    interface{}
+	}{
+		"RSA-OAEP":     {NewRSAOAEP(encKey), jwa.RSA_OAEP, &encKey.PublicKey},
+		"RSA-OAEP-256": {NewRSAOAEP256(encKey), jwa.RSA_OAEP_256, &encKey.PublicKey},
+		"dir":          {NewDirect(secret), jwa.DIRECT, secret},
+	} {
+		tokenStr := nested(t, signer, tc.alg, tc.encKey)
+		claims, err := middleware.Validate(context.Background(), tokenStr, middleware.Options{
+			Provider:  staticKey{&signer.PublicKey},
+			Decrypter: tc.decrypter,
+		})
+		if err != nil || claims["sub"] != "alice" {
+			t.Errorf("%s: claims = %v, err = %v", name, claims, err)
+		}
+	}
+}
+
+func TestDecryptWrongKey(t *testing.T) {
+	signer, encKey := generateKey(t), generateKey(t)
+	tokenStr := nested(t, signer, jwa.RSA_OAEP, &encKey.PublicKey)
+
+	_, err := middleware.Validate(context.Background(), tokenStr, middleware.Options{
+		Provider:  staticKey{&signer.PublicKey},
+		Decrypter: NewRSAOAEP(generateKey(t)),
+	})
+	if !errors.Is(err, middleware.ErrDecryptFailed) {
+		t.Fatalf("err = %v, want ErrDecryptFailed", err)
+	}
+}
+
+func TestDecryptVerifiesInnerSignature(t *testing.T) {
+	encKey := generateKey(t)
+	tokenStr := nested(t, generateKey(t), jwa.RSA_OAEP, &encKey.PublicKey)
+
+	_, err := middleware.Validate(context.Background(), tokenStr, middleware.Options{
+		Provider:  staticKey{&generateKey(t).PublicKey},
+		Decrypter: NewRSAOAEP(encKey),
+	})
+	if !errors.Is(err, middleware.ErrInvalidSignature) {
+		t.Fatalf("err = %v, want ErrInvalidSignature", err)
+	}
+}
+
+func TestPlainJWSPassesThrough(t *testing.T) {
+	signer := generateKey(t)
+	jws, _ := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{"sub": "alice"}).SignedString(signer)
+
+	_, err := middleware.Validate(context.Background(), jws, middleware.Options{
+		Provider:  staticKey{&signer.PublicKey},
+		Decrypter: NewRSAOAEP(generateKey(t)),
+	})
+	if err != nil {
+		t.Fatalf("plain JWS rejected: %v", err)
+	}
+}
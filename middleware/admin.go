@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/digitcodestudiotech/go-middle/crypto"
+	"github.com/gin-gonic/gin"
+)
+
+// AdminRefreshHandler forces provider to reload its keys and responds with
+// the new key metadata. guard runs first and rejects the call by aborting the
+// context, e.g. with an admin token check or an internal network check. A nil
+// guard panics; pass a no-op guard to leave the route open on purpose.
+func AdminRefreshHandler(provider crypto.KeyProvider, guard gin.HandlerFunc) gin.HandlerFunc {
+	if guard == nil {
+		panic("[go-middle] AdminRefreshHandler requires a guard")
+	}
+	return func(c *gin.Context) {
+		guard(c)
+		if c.IsAborted() {
+			return
+		}
+
+		refresher, ok := provider.(crypto.Refresher)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusNotImplemented, gin.H{"error": "provider does not support refresh"})
+			return
+		}
+
+		if err := refresher.ForceRefresh(); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadGateway, gin.H{"error": "refresh failed: " + err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, refresher.Metadata())
+	}
+}
+
+// FailureLogHandler responds with the recent failures of log as a JSON
+// array, oldest first. guard runs first and is required, as for
+// AdminRefreshHandler.
+func FailureLogHandler(log *FailureLog, guard gin.HandlerFunc) gin.HandlerFunc {
+	if guard == nil {
+		panic("[go-middle] FailureLogHandler requires a guard")
+	}
+	return func(c *gin.Context) {
+		guard(c)
+		if c.IsAborted() {
+			return
+		}
+
+		c.JSON(http.StatusOK, log.Recent())
+	}
+}
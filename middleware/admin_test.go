@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/digitcodestudiotech/go-middle/crypto"
+	"github.com/gin-gonic/gin"
+)
+
+type refreshingKeys struct {
+	*testKeys
+	refreshes int
+	err       error
+}
+
+func (r *refreshingKeys) ForceRefresh() error {
+	r.refreshes++
+	return r.err
+}
+
+func (r *refreshingKeys) Metadata() crypto.KeyMetadata {
+	return crypto.KeyMetadata{URL: "https://auth.example.com/jwks", KeyIDs: []string{"k1"}}
+}
+
+func allow(*gin.Context) {}
+
+func deny(c *gin.Context) {
+	c.AbortWithStatus(http.StatusForbidden)
+}
+
+func call(h gin.HandlerFunc) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+	h(c)
+	return w
+}
+
+func TestAdminRefreshHandler(t *testing.T) {
+	keys := &refreshingKeys{testKeys: newTestKeys()}
+
+	w := call(AdminRefreshHandler(keys, allow))
+	if w.Code != http.StatusOK || keys.refreshes != 1 {
+		t.Fatalf("status %d after %d refreshes", w.Code, keys.refreshes)
+	}
+	var meta crypto.KeyMetadata
+	if err := json.Unmarshal(w.Body.Bytes(), &meta); err != nil || meta.URL != "https://auth.example.com/jwks" {
+		t.Fatalf("metadata = %+v, %v", meta, err)
+	}
+}
+
+func TestAdminRefreshHandlerGuard(t *testing.T) {
+	keys := &refreshingKeys{testKeys: newTestKeys()}
+	if w := call(AdminRefreshHandler(keys, deny)); w.Code != http.StatusForbidden || keys.refreshes != 0 {
+		t.Fatalf("status %d after %d refreshes, want 403 and none", w.Code, keys.refreshes)
+	}
+}
+
+func TestAdminRefreshHandlerErrors(t *testing.T) {
+	if w := call(AdminRefreshHandler(newTestKeys(), allow)); w.Code != http.StatusNotImplemented {
+		t.Fatalf("non-refresher: status %d, want 501", w.Code)
+	}
+	failing := &refreshingKeys{testKeys: newTestKeys(), err: errors.New("down")}
+	if w := call(AdminRefreshHandler(failing, allow)); w.Code != http.StatusBadGateway {
+		t.Fatalf("failed refresh: status %d, want 502", w.Code)
+	}
+}
+
+func TestAdminRefreshHandlerNilGuardPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("nil guard accepted")
+		}
+	}()
+	AdminRefreshHandler(newTestKeys(), nil)
+}
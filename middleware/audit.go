@@ -0,0 +1,118 @@
+package middleware
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	AuditRejected            = "rejected"
+	AuditWouldReject         = "would_reject"
+	AuditDeprecatedAlgorithm = "deprecated_algorithm"
+)
+
+type AuditEvent struct {
+	Type     string    `json:"type"`
+	Time     time.Time `json:"time"`
+	Code     string    `json:"code,omitempty"`
+	Reason   string    `json:"reason,omitempty"`
+	Subject  string    `json:"subject,omitempty"`
+	Issuer   string    `json:"issuer,omitempty"`
+	Method   string    `json:"method"`
+	Path     string    `json:"path"`
+	ClientIP string    `json:"client_ip"`
+}
+
+func audit(c *gin.Context, opts Options, typ string, err *AuthError, claims jwt.MapClaims) {
+	if opts.AuditLogger == nil {
+		return
+	}
+
+	e := AuditEvent{
+		Type:     typ,
+		Time:     time.Now(),
+		Method:   c.Request.Method,
+		Path:     c.Request.URL.Path,
+		ClientIP: clientIP(c, opts),
+	}
+	if err != nil {
+		e.Code = err.Code
+		e.Reason = err.Error()
+	}
+	if claims != nil {
+		e.Subject = subjectOf(claims, opts)
+		e.Issuer, _ = claims.GetIssuer()
+	}
+	opts.AuditLogger(e)
+}
+
+// auditDeprecated records an accepted token signed with one of
+// opts.DeprecatedAlgorithms.
+func auditDeprecated(c *gin.Context, tokenStr string, claims jwt.MapClaims, opts Options) {
+	if len(opts.DeprecatedAlgorithms) == 0 || opts.AuditLogger == nil {
+		return
+	}
+
+	jws, authErr := decrypt(tokenStr, opts)
+	if authErr != nil {
+		return
+	}
+	if alg := tokenAlg(jws); containsAny([]string{alg}, opts.DeprecatedAlgorithms) {
+		audit(c, opts, AuditDeprecatedAlgorithm, ErrDeprecatedAlgorithm.wrap(errors.New(alg)), claims)
+	}
+}
+
+func tokenAlg(jws string) string {
+	segment, _, _ := strings.Cut(jws, ".")
+	raw, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return ""
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	_ = json.Unmarshal(raw, &header)
+	return header.Alg
+}
+
+// dryRunClaims returns the claims of a token that failed validation with err
+// when opts.DryRun is set and err is one of dryRunCodes. The token goes
+// through parseToken again with the claim checks off, so size, signature,
+// header and revocation checks and ValidationTimeout still apply. Otherwise
+// it returns the error the request must be rejected with.
+func dryRunClaims(ctx context.Context, tokenStr string, err *AuthError, opts Options) (jwt.MapClaims, *AuthError) {
+	if !opts.DryRun || !containsAny([]string{err.Code}, dryRunCodes) {
+		return nil, err
+	}
+
+	opts.claimsUnchecked = true
+	claims := jwt.MapClaims{}
+	if err := withValidationTimeout(ctx, opts, func(ctx context.Context) *AuthError {
+		if err := parseToken(tokenStr, claims, opts); err != nil {
+			return err
+		}
+		return checkRevocation(ctx, claims, opts)
+	}); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// dryRunCodes are the claim and policy failures DryRun lets through.
+var dryRunCodes = []string{
+	ErrTokenExpired.Code,
+	ErrTokenNotValidYet.Code,
+	ErrInvalidIssuer.Code,
+	ErrInvalidAudience.Code,
+	ErrMissingIssuedAt.Code,
+	ErrTokenTooOld.Code,
+	ErrMissingRequiredClaim.Code,
+	ErrClaimsRejected.Code,
+}
@@ -0,0 +1,126 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestDryRunPassesClaimFailures(t *testing.T) {
+	var events []AuditEvent
+	verify := VerifyTokenWithOptions(Options{
+		Provider:    newTestKeys(),
+		Audience:    []string{"orders-api"},
+		DryRun:      true,
+		AuditLogger: func(e AuditEvent) { events = append(events, e) },
+	})
+
+	w := serve(sign(t, jwt.MapClaims{"sub": "alice", "aud": "billing-api"}), verify)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200", w.Code)
+	}
+	if len(events) != 1 || events[0].Type != AuditWouldReject || events[0].Code != ErrInvalidAudience.Code {
+		t.Fatalf("events = %+v, want one would_reject invalid_audience", events)
+	}
+}
+
+func TestDryRunKeepsHeaderChecks(t *testing.T) {
+	var events []AuditEvent
+	verify := VerifyTokenWithOptions(Options{
+		Provider:    newTestKeys(),
+		Algorithms:  []string{"ES256"},
+		DryRun:      true,
+		AuditLogger: func(e AuditEvent) { events = append(events, e) },
+	})
+
+	w := serve(sign(t, jwt.MapClaims{"sub": "alice", "exp": time.Now().Add(-time.Minute).Unix()}), verify)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status %d, want 401", w.Code)
+	}
+	if len(events) != 1 || events[0].Type != AuditRejected {
+		t.Fatalf("events = %+v, want one rejected", events)
+	}
+}
+
+func TestDryRunRejectsBadSignature(t *testing.T) {
+	verify := VerifyTokenWithOptions(Options{Provider: newTestKeys(), DryRun: true})
+	tokenStr := sign(t, jwt.MapClaims{"sub": "alice"})
+
+	if w := serve(tokenStr[:len(tokenStr)-4]+"AAAA", verify); w.Code != http.StatusUnauthorized {
+		t.Fatalf("status %d, want 401", w.Code)
+	}
+}
+
+func TestDryRunKeepsTransportChecks(t *testing.T) {
+	expired := sign(t, jwt.MapClaims{"sub": "alice", "exp": time.Now().Add(-time.Minute).Unix()})
+	revoked := RevocationFunc(func(context.Context, jwt.MapClaims) (bool, error) { return true, nil })
+
+	for _, tc := range []struct {
+		name string
+		opts Options
+		want *AuthError
+	}{
+		{"revoked", Options{Revocation: revoked}, ErrTokenRevoked},
+		{"client address", Options{AllowedCIDRs: []string{"198.51.100.0/24"}}, ErrIPNotAllowed},
+		{"token size", Options{MaxTokenBytes: 16}, ErrTokenTooLarge},
+	} {
+		var events []AuditEvent
+		tc.opts.Provider = newTestKeys()
+		tc.opts.DryRun = true
+		tc.opts.AuditLogger = func(e AuditEvent) { events = append(events, e) }
+
+		w := serve(expired, VerifyTokenWithOptions(tc.opts))
+		if w.Code != tc.want.Status {
+			t.Errorf("%s: status %d, want %d", tc.name, w.Code, tc.want.Status)
+		}
+		if len(events) != 1 || events[0].Type != AuditRejected || events[0].Code != tc.want.Code {
+			t.Errorf("%s: events = %+v, want one rejected %s", tc.name, events, tc.want.Code)
+		}
+	}
+}
+
+func TestDeprecatedAlgorithms(t *testing.T) {
+	tokenStr := sign(t, jwt.MapClaims{"sub": "alice", "iss": "https://auth.example.com"})
+
+	for _, tc := range []struct {
+		name       string
+		deprecated []string
+		reject     bool
+		want       int
+		events     int
+	}{
+		{"reported", []string{"RS256"}, false, http.StatusOK, 1},
+		{"rejected", []string{"RS256"}, true, http.StatusUnauthorized, 1},
+		{"other algorithm", []string{"HS256"}, true, http.StatusOK, 0},
+	} {
+		var events []AuditEvent
+		verify := VerifyTokenWithOptions(Options{
+			Provider:             newTestKeys(),
+			DeprecatedAlgorithms: tc.deprecated,
+			RejectDeprecated:     tc.reject,
+			AuditLogger:          func(e AuditEvent) { events = append(events, e) },
+		})
+
+		w := serve(tokenStr, verify)
+		if w.Code != tc.want || len(events) != tc.events {
+			t.Errorf("%s: status %d with events %+v", tc.name, w.Code, events)
+			continue
+		}
+		if tc.events == 0 {
+			continue
+		}
+		want := AuditDeprecatedAlgorithm
+		if tc.reject {
+			want = AuditRejected
+		}
+		if e := events[0]; e.Type != want || e.Code != ErrDeprecatedAlgorithm.Code {
+			t.Errorf("%s: event %+v, want %s", tc.name, e, want)
+		}
+		if !tc.reject && (events[0].Subject != "alice" || events[0].Issuer != "https://auth.example.com") {
+			t.Errorf("%s: event %+v, want subject and issuer", tc.name, events[0])
+		}
+	}
+}
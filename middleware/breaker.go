@@ -0,0 +1,181 @@
+package middleware
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// FailurePolicy decides what happens to a request when an external
+// dependency such as the revocation checker fails.
+type FailurePolicy int
+
+const (
+	// FailClosed rejects the request on every failure.
+	FailClosed FailurePolicy = iota
+	// FailOpen accepts the token as if the check had passed.
+	FailOpen
+	// FailClosedAfterN tolerates failures until Threshold consecutive ones
+	// open the circuit, then rejects until the dependency recovers.
+	FailClosedAfterN
+)
+
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half_open"
+	}
+	return "closed"
+}
+
+type BreakerOptions struct {
+	Policy FailurePolicy
+	// Threshold is the number of consecutive failures that opens the
+	// circuit. Defaults to 5.
+	Threshold int
+	// Cooldown is how long an open circuit skips the dependency before a
+	// single trial call. Defaults to 30 seconds.
+	Cooldown time.Duration
+	// OnStateChange is a metrics hook called on every transition, in the
+	// order the transitions happened. Calls do not overlap, but may run on
+	// the goroutine of another request than the one that caused them.
+	OnStateChange func(from, to BreakerState)
+}
+
+// CircuitBreaker guards calls to an external dependency. While open, the
+// dependency is not called and the request is handled as a failure.
+type CircuitBreaker struct {
+	opts     BreakerOptions
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+
+	// pending holds the transitions not yet passed to OnStateChange, and
+	// delivering is held by the goroutine passing them.
+	pending    []breakerTransition
+	delivering sync.Mutex
+}
+
+type breakerTransition struct {
+	from, to BreakerState
+}
+
+var errCircuitOpen = errors.New("circuit open")
+
+func NewCircuitBreaker(opts BreakerOptions) *CircuitBreaker {
+	if opts.Threshold <= 0 {
+		opts.Threshold = 5
+	}
+	if opts.Cooldown <= 0 {
+		opts.Cooldown = 30 * time.Second
+	}
+	return &CircuitBreaker{opts: opts}
+}
+
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// do runs fn through the breaker. It returns nil when fn succeeds or the
+// policy tolerates its failure, and the failure otherwise. A nil breaker
+// fails closed.
+func (b *CircuitBreaker) do(fn func() error) error {
+	if b == nil {
+		return fn()
+	}
+
+	b.mu.Lock()
+	from := b.state
+	if b.state == BreakerOpen && time.Since(b.openedAt) >= b.opts.Cooldown {
+		b.state = BreakerHalfOpen
+	} else if b.state != BreakerClosed {
+		b.mu.Unlock()
+		return b.policy(errCircuitOpen, true)
+	}
+	b.changed(from, b.state)
+	b.mu.Unlock()
+	b.notify()
+
+	err := fn()
+
+	b.mu.Lock()
+	from = b.state
+	if err == nil {
+		b.failures = 0
+		b.state = BreakerClosed
+	} else {
+		b.failures++
+		if b.state == BreakerHalfOpen || b.failures >= b.opts.Threshold {
+			b.state = BreakerOpen
+			b.openedAt = time.Now()
+		}
+	}
+	to := b.state
+	b.changed(from, to)
+	b.mu.Unlock()
+	b.notify()
+
+	if err == nil {
+		return nil
+	}
+	return b.policy(err, to == BreakerOpen)
+}
+
+func (b *CircuitBreaker) policy(err error, open bool) error {
+	switch b.opts.Policy {
+	case FailOpen:
+		return nil
+	case FailClosedAfterN:
+		if !open {
+			return nil
+		}
+	}
+	return err
+}
+
+// changed queues a transition for notify. b.mu must be held, so the queue
+// is in the order of the transitions.
+func (b *CircuitBreaker) changed(from, to BreakerState) {
+	if from != to && b.opts.OnStateChange != nil {
+		b.pending = append(b.pending, breakerTransition{from, to})
+	}
+}
+
+// notify passes the queued transitions to OnStateChange outside b.mu. When
+// another goroutine is already delivering, it leaves them to that one,
+// which checks the queue again before it stops.
+func (b *CircuitBreaker) notify() {
+	for {
+		if !b.delivering.TryLock() {
+			return
+		}
+		b.mu.Lock()
+		pending := b.pending
+		b.pending = nil
+		b.mu.Unlock()
+		for _, t := range pending {
+			b.opts.OnStateChange(t.from, t.to)
+		}
+		b.delivering.Unlock()
+
+		b.mu.Lock()
+		done := len(b.pending) == 0
+		b.mu.Unlock()
+		if done {
+			return
+		}
+	}
+}
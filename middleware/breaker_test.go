@@ -0,0 +1,155 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var errDown = errors.New("dependency down")
+
+func failing() error { return errDown }
+
+func succeeding() error { return nil }
+
+func TestCircuitBreakerPolicies(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		policy FailurePolicy
+		want   []bool // whether each of four failing calls is reported
+	}{
+		{"fail closed", FailClosed, []bool{true, true, true, true}},
+		{"fail open", FailOpen, []bool{false, false, false, false}},
+		{"fail closed after 2", FailClosedAfterN, []bool{false, true, true, true}},
+	} {
+		b := NewCircuitBreaker(BreakerOptions{Policy: tc.policy, Threshold: 2, Cooldown: time.Hour})
+		for i, want := range tc.want {
+			if err := b.do(failing); (err != nil) != want {
+				t.Errorf("%s: call %d: err = %v, want reported %v", tc.name, i, err, want)
+			}
+		}
+	}
+}
+
+func TestCircuitBreakerOpenSkipsDependency(t *testing.T) {
+	b := NewCircuitBreaker(BreakerOptions{Threshold: 2, Cooldown: time.Hour})
+	_ = b.do(failing)
+	_ = b.do(failing)
+	if b.State() != BreakerOpen {
+		t.Fatalf("state %s, want open", b.State())
+	}
+
+	calls := 0
+	err := b.do(func() error { calls++; return nil })
+	if calls != 0 || !errors.Is(err, errCircuitOpen) {
+		t.Fatalf("open circuit: %d calls, err = %v", calls, err)
+	}
+}
+
+func TestCircuitBreakerHalfOpen(t *testing.T) {
+	var transitions []string
+	b := NewCircuitBreaker(BreakerOptions{
+		Threshold:     1,
+		Cooldown:      10 * time.Millisecond,
+		OnStateChange: func(from, to BreakerState) { transitions = append(transitions, from.String()+">"+to.String()) },
+	})
+
+	_ = b.do(failing)
+	time.Sleep(15 * time.Millisecond)
+	_ = b.do(failing)
+	if b.State() != BreakerOpen {
+		t.Fatalf("failed trial: state %s, want open", b.State())
+	}
+	time.Sleep(15 * time.Millisecond)
+	if err := b.do(succeeding); err != nil || b.State() != BreakerClosed {
+		t.Fatalf("successful trial: err = %v, state %s", err, b.State())
+	}
+
+	want := []string{"closed>open", "open>half_open", "half_open>open", "open>half_open", "half_open>closed"}
+	if len(transitions) != len(want) {
+		t.Fatalf("transitions = %v, want %v", transitions, want)
+	}
+	for i := range want {
+		if transitions[i] != want[i] {
+			t.Fatalf("transitions = %v, want %v", transitions, want)
+		}
+	}
+}
+
+func TestCircuitBreakerSuccessResetsFailures(t *testing.T) {
+	b := NewCircuitBreaker(BreakerOptions{Threshold: 2})
+	_ = b.do(failing)
+	_ = b.do(succeeding)
+	_ = b.do(failing)
+	if b.State() != BreakerClosed {
+		t.Fatalf("state %s, want closed", b.State())
+	}
+}
+
+func TestNilCircuitBreakerFailsClosed(t *testing.T) {
+	var b *CircuitBreaker
+	if err := b.do(failing); err != errDown {
+		t.Fatalf("err = %v, want the dependency error", err)
+	}
+}
+
+func TestRevocationBreaker(t *testing.T) {
+	down := RevocationFunc(func(context.Context, jwt.MapClaims) (bool, error) { return true, errDown })
+	tokenStr := sign(t, jwt.MapClaims{"sub": "alice"})
+
+	expectErr(t, "no breaker", tokenStr, Options{Provider: newTestKeys(), Revocation: down}, ErrRevocationFailed)
+	expectErr(t, "fail open", tokenStr, Options{
+		Provider:          newTestKeys(),
+		Revocation:        down,
+		RevocationBreaker: NewCircuitBreaker(BreakerOptions{Policy: FailOpen}),
+	}, nil)
+}
+
+func TestCircuitBreakerTransitionOrder(t *testing.T) {
+	var mu sync.Mutex
+	var transitions [][2]BreakerState
+	b := NewCircuitBreaker(BreakerOptions{
+		Threshold: 1,
+		Cooldown:  time.Nanosecond,
+		OnStateChange: func(from, to BreakerState) {
+			if to == BreakerOpen {
+				// A slow hook lets later transitions overtake this one.
+				time.Sleep(50 * time.Microsecond)
+			}
+			mu.Lock()
+			transitions = append(transitions, [2]BreakerState{from, to})
+			mu.Unlock()
+		},
+	})
+
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 50 {
+				if (i+j)%2 == 0 {
+					_ = b.do(failing)
+				} else {
+					_ = b.do(succeeding)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	state := BreakerClosed
+	for i, tr := range transitions {
+		if tr[0] != state {
+			t.Fatalf("transition %d is %s>%s after reaching %s", i, tr[0], tr[1], state)
+		}
+		state = tr[1]
+	}
+	if state != b.State() {
+		t.Fatalf("last transition reached %s, state is %s", state, b.State())
+	}
+}
@@ -0,0 +1,226 @@
+package middleware
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/digitcodestudiotech/go-middle/crypto"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// TokenCache stores claims of already validated tokens. Keys are
+// CacheKey(token), a colon and a digest of the verifying options (audience,
+// issuer, algorithms, key provider and decoding options), so middlewares
+// sharing one cache never accept each other's tokens. Get must return claims
+// the caller may modify.
+type TokenCache interface {
+	Get(ctx context.Context, key string) (jwt.MapClaims, bool, error)
+	Set(ctx context.Context, key string, claims jwt.MapClaims, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+}
+
+// CacheInvalidator is implemented by caches that can purge entries on
+// logout, so the next request re-parses the token and runs revocation on
+// fresh claims. MemoryCache and rediscache.Cache implement it.
+type CacheInvalidator interface {
+	InvalidateToken(ctx context.Context, tokenStr string) error
+	// InvalidateSubject purges every cached token whose subject is sub.
+	InvalidateSubject(ctx context.Context, sub string) error
+}
+
+// SubjectIndexer is implemented by caches that index entries by subject for
+// InvalidateSubject. The middleware stores entries with SetSubject, passing
+// the subject read from Options.SubjectClaim, so the index matches Subject
+// even when the user ID is not in sub. Set indexes by the sub claim.
+type SubjectIndexer interface {
+	SetSubject(ctx context.Context, key, sub string, claims jwt.MapClaims, ttl time.Duration) error
+}
+
+// CacheKey returns the token part of the TokenCache keys of tokenStr.
+func CacheKey(tokenStr string) string {
+	sum := sha256.Sum256([]byte(tokenStr))
+	return hex.EncodeToString(sum[:])
+}
+
+// CacheKeyToken returns the CacheKey part of a TokenCache key, for caches
+// that index entries by token.
+func CacheKeyToken(key string) string {
+	token, _, _ := strings.Cut(key, ":")
+	return token
+}
+
+func cacheKey(tokenStr string, opts Options) string {
+	scope := opts.cacheScope
+	if scope == "" {
+		scope = cacheScope(opts)
+	}
+	return CacheKey(tokenStr) + ":" + scope
+}
+
+// cacheScope digests the options that decide whether a token verifies.
+func cacheScope(opts Options) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%q %q %q %q %t %q %t %d %t %t %t %s",
+		opts.Audience, opts.Issuer, opts.Algorithms, opts.DeprecatedAlgorithms, opts.RejectDeprecated,
+		opts.AllowedCriticalHeaders, opts.AllowUnencodedPayload, opts.ClaimPrecedence, opts.LenientNumericDates,
+		opts.Decrypter != nil, opts.SignatureVerifier != nil, keySource(opts.Provider))
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+// keySource identifies a key provider. Remote providers are identified by
+// URL, so replicas sharing a Redis cache share entries too; other providers
+// by their address, so two local key sets never do.
+func keySource(provider crypto.KeyProvider) string {
+	if reflect.ValueOf(provider).Kind() != reflect.Pointer {
+		return lookupKeySource(provider)
+	}
+	if src, ok := keySources.Load(provider); ok {
+		return src.(string)
+	}
+	src := lookupKeySource(provider)
+	keySources.Store(provider, src)
+	return src
+}
+
+// keySources memoizes keySource per pointer provider: Validate gets options
+// that skipped prepareOptions and computes the cache scope on every call,
+// while Metadata of a remote provider fingerprints every key.
+var keySources sync.Map
+
+func lookupKeySource(provider crypto.KeyProvider) string {
+	if r, ok := provider.(crypto.Refresher); ok {
+		if url := r.Metadata().URL; url != "" {
+			return url
+		}
+	}
+	switch reflect.ValueOf(provider).Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Func, reflect.Chan:
+		return fmt.Sprintf("%T@%p", provider, provider)
+	}
+	return fmt.Sprintf("%T", provider)
+}
+
+type MemoryCache struct {
+	size  int
+	items map[string]*list.Element
+	order *list.List
+	mu    sync.Mutex
+}
+
+type memoryEntry struct {
+	key       string
+	subject   string
+	claims    jwt.MapClaims
+	expiresAt time.Time
+}
+
+func NewMemoryCache(size int) *MemoryCache {
+	if size <= 0 {
+		size = 1024
+	}
+	return &MemoryCache{
+		size:  size,
+		items: map[string]*list.Element{},
+		order: list.New(),
+	}
+}
+
+func (m *MemoryCache) Get(ctx context.Context, key string) (jwt.MapClaims, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	el, ok := m.items[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := el.Value.(*memoryEntry)
+	if time.Now().After(entry.expiresAt) {
+		m.remove(el)
+		return nil, false, nil
+	}
+	m.order.MoveToFront(el)
+	return maps.Clone(entry.claims), true, nil
+}
+
+func (m *MemoryCache) Set(ctx context.Context, key string, claims jwt.MapClaims, ttl time.Duration) error {
+	sub, _ := claims.GetSubject()
+	return m.SetSubject(ctx, key, sub, claims, ttl)
+}
+
+func (m *MemoryCache) SetSubject(ctx context.Context, key, sub string, claims jwt.MapClaims, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if el, ok := m.items[key]; ok {
+		m.remove(el)
+	}
+	m.items[key] = m.order.PushFront(&memoryEntry{key, sub, maps.Clone(claims), time.Now().Add(ttl)})
+
+	for m.order.Len() > m.size {
+		m.remove(m.order.Back())
+	}
+	return nil
+}
+
+func (m *MemoryCache) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if el, ok := m.items[key]; ok {
+		m.remove(el)
+	}
+	return nil
+}
+
+// InvalidateToken removes the entries of tokenStr under every set of
+// verifying options.
+func (m *MemoryCache) InvalidateToken(ctx context.Context, tokenStr string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	token := CacheKey(tokenStr)
+	for key, el := range m.items {
+		if CacheKeyToken(key) == token {
+			m.remove(el)
+		}
+	}
+	return nil
+}
+
+func (m *MemoryCache) InvalidateSubject(ctx context.Context, sub string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, el := range m.items {
+		if el.Value.(*memoryEntry).subject == sub {
+			m.remove(el)
+		}
+	}
+	return nil
+}
+
+func (m *MemoryCache) remove(el *list.Element) {
+	m.order.Remove(el)
+	delete(m.items, el.Value.(*memoryEntry).key)
+}
+
+// cacheTTL bounds the cache lifetime by the token exp so an entry never
+// outlives the token itself.
+func cacheTTL(claims jwt.MapClaims, opts Options) time.Duration {
+	ttl := opts.CacheTTL
+	exp, err := claims.GetExpirationTime()
+	if err == nil && exp != nil {
+		if untilExp := time.Until(exp.Time); ttl <= 0 || untilExp < ttl {
+			ttl = untilExp
+		}
+	}
+	return ttl
+}
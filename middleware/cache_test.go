@@ -0,0 +1,193 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rsa"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/digitcodestudiotech/go-middle/crypto"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestCacheNotSharedAcrossAudiences(t *testing.T) {
+	cache := NewMemoryCache(0)
+	keys := newTestKeys()
+	apiA := VerifyTokenWithOptions(Options{Provider: keys, Audience: []string{"api-a"}, TokenCache: cache, CacheTTL: time.Minute})
+	apiB := VerifyTokenWithOptions(Options{Provider: keys, Audience: []string{"api-b"}, TokenCache: cache, CacheTTL: time.Minute})
+	tokenStr := sign(t, jwt.MapClaims{"sub": "alice", "aud": "api-a"})
+
+	if w := serve(tokenStr, apiA); w.Code != http.StatusOK {
+		t.Fatalf("api-a: status %d, want 200", w.Code)
+	}
+	if w := serve(tokenStr, apiB); w.Code != http.StatusUnauthorized {
+		t.Fatalf("api-b: status %d, want 401", w.Code)
+	}
+}
+
+func TestCacheNotSharedAcrossProviders(t *testing.T) {
+	cache := NewMemoryCache(0)
+	other := &testKeys{keys: map[string]*rsa.PublicKey{"k1": &otherKey.PublicKey}}
+	apiA := VerifyTokenWithOptions(Options{Provider: newTestKeys(), TokenCache: cache, CacheTTL: time.Minute})
+	apiB := VerifyTokenWithOptions(Options{Provider: other, TokenCache: cache, CacheTTL: time.Minute})
+	tokenStr := sign(t, jwt.MapClaims{"sub": "alice"})
+
+	serve(tokenStr, apiA)
+	if w := serve(tokenStr, apiB); w.Code != http.StatusUnauthorized {
+		t.Fatalf("status %d, want 401", w.Code)
+	}
+}
+
+type countingMetadata struct {
+	*refreshingKeys
+	calls int
+}
+
+func (c *countingMetadata) Metadata() crypto.KeyMetadata {
+	c.calls++
+	return c.refreshingKeys.Metadata()
+}
+
+func TestCacheScopeComputedOncePerProvider(t *testing.T) {
+	keys := &countingMetadata{refreshingKeys: &refreshingKeys{testKeys: newTestKeys()}}
+	opts := Options{Provider: keys, TokenCache: NewMemoryCache(0), CacheTTL: time.Minute}
+	tokenStr := sign(t, jwt.MapClaims{"sub": "alice"})
+
+	for range 3 {
+		if _, err := Validate(context.Background(), tokenStr, opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if keys.calls != 1 {
+		t.Fatalf("Metadata called %d times, want 1", keys.calls)
+	}
+}
+
+func TestCacheHitRechecksKey(t *testing.T) {
+	keys := newTestKeys()
+	verify := VerifyTokenWithOptions(Options{Provider: keys, CacheTTL: time.Minute})
+	tokenStr := sign(t, jwt.MapClaims{"sub": "alice"})
+
+	if w := serve(tokenStr, verify); w.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200", w.Code)
+	}
+	keys.remove("k1")
+	if w := serve(tokenStr, verify); w.Code != http.StatusUnauthorized {
+		t.Fatalf("after key removal: status %d, want 401", w.Code)
+	}
+}
+
+func TestCacheHitRechecksExpiry(t *testing.T) {
+	cache := NewMemoryCache(0)
+	opts := Options{Provider: newTestKeys(), TokenCache: cache, Leeway: 2 * time.Second}
+	tokenStr := sign(t, jwt.MapClaims{"sub": "alice", "exp": time.Now().Add(time.Second).Unix()})
+	ctx := context.Background()
+
+	claims, err := Validate(ctx, tokenStr, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Cache the entry past exp, as a custom TokenCache might.
+	_ = cache.Set(ctx, cacheKey(tokenStr, opts), claims, time.Hour)
+
+	opts.Leeway = 0
+	time.Sleep(1100 * time.Millisecond)
+	if _, err := Validate(ctx, tokenStr, opts); err == nil {
+		t.Fatal("expired token accepted from cache")
+	}
+}
+
+func TestMemoryCacheGetReturnsCopy(t *testing.T) {
+	cache := NewMemoryCache(0)
+	ctx := context.Background()
+	_ = cache.Set(ctx, "k", jwt.MapClaims{"sub": "alice"}, time.Minute)
+
+	claims, _, _ := cache.Get(ctx, "k")
+	claims["sub"] = "mallory"
+
+	claims, _, _ = cache.Get(ctx, "k")
+	if claims["sub"] != "alice" {
+		t.Fatalf("sub = %v, want alice", claims["sub"])
+	}
+}
+
+func TestMemoryCacheInvalidateToken(t *testing.T) {
+	cache := NewMemoryCache(0)
+	ctx := context.Background()
+	tokenStr := sign(t, jwt.MapClaims{"sub": "alice"})
+	for _, aud := range []string{"api-a", "api-b"} {
+		opts := Options{Provider: newTestKeys(), Audience: []string{aud}}
+		_ = cache.Set(ctx, cacheKey(tokenStr, opts), jwt.MapClaims{"sub": "alice"}, time.Minute)
+	}
+	_ = cache.Set(ctx, cacheKey("other", Options{}), jwt.MapClaims{"sub": "bob"}, time.Minute)
+
+	if err := cache.InvalidateToken(ctx, tokenStr); err != nil {
+		t.Fatal(err)
+	}
+	if n := cache.order.Len(); n != 1 {
+		t.Fatalf("%d entries left, want 1", n)
+	}
+}
+
+func TestMemoryCacheEvictsOldest(t *testing.T) {
+	cache := NewMemoryCache(2)
+	ctx := context.Background()
+	for _, key := range []string{"a", "b", "c"} {
+		_ = cache.Set(ctx, key, jwt.MapClaims{}, time.Minute)
+	}
+	if _, ok, _ := cache.Get(ctx, "a"); ok {
+		t.Fatal("oldest entry not evicted")
+	}
+	if _, ok, _ := cache.Get(ctx, "c"); !ok {
+		t.Fatal("newest entry missing")
+	}
+}
+
+func TestCacheTTLBoundedByExp(t *testing.T) {
+	claims := jwt.MapClaims{"exp": float64(time.Now().Add(10 * time.Second).Unix())}
+	if ttl := cacheTTL(claims, Options{CacheTTL: time.Hour}); ttl > 10*time.Second {
+		t.Fatalf("ttl = %v, want at most 10s", ttl)
+	}
+	if ttl := cacheTTL(jwt.MapClaims{}, Options{CacheTTL: time.Minute}); ttl != time.Minute {
+		t.Fatalf("ttl = %v, want 1m", ttl)
+	}
+}
+
+func TestInvalidateSubjectUsesSubjectClaim(t *testing.T) {
+	cache := NewMemoryCache(0)
+	opts := Options{Provider: newTestKeys(), TokenCache: cache, SubjectClaim: "oid"}
+	ctx := context.Background()
+	tokenStr := sign(t, jwt.MapClaims{"sub": "pairwise-123", "oid": "user-1"})
+
+	if _, err := Validate(ctx, tokenStr, opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.InvalidateSubject(ctx, "pairwise-123"); err != nil {
+		t.Fatal(err)
+	}
+	if cache.order.Len() != 1 {
+		t.Fatal("entry removed by its sub claim instead of SubjectClaim")
+	}
+	if err := cache.InvalidateSubject(ctx, "user-1"); err != nil {
+		t.Fatal(err)
+	}
+	if cache.order.Len() != 0 {
+		t.Fatal("entry not removed by its SubjectClaim value")
+	}
+}
+
+func TestMemoryCacheSetIndexesSub(t *testing.T) {
+	cache := NewMemoryCache(0)
+	ctx := context.Background()
+	_ = cache.Set(ctx, "a", jwt.MapClaims{"sub": "alice"}, time.Minute)
+	_ = cache.Set(ctx, "b", jwt.MapClaims{"sub": "bob"}, time.Minute)
+
+	_ = cache.InvalidateSubject(ctx, "alice")
+	if _, ok, _ := cache.Get(ctx, "a"); ok {
+		t.Fatal("alice still cached")
+	}
+	if _, ok, _ := cache.Get(ctx, "b"); !ok {
+		t.Fatal("bob removed")
+	}
+}
@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// clientIP resolves the address reported in audit events.
+func clientIP(c *gin.Context, opts Options) string {
+	if opts.ClientIPResolver != nil {
+		return opts.ClientIPResolver(c)
+	}
+	return c.ClientIP()
+}
+
+// trustedProxyResolver returns a resolver that believes X-Forwarded-For and
+// X-Real-IP only when the direct peer is one of proxies. The forwarded chain
+// is walked from the right and the first untrusted address is the client,
+// so a client cannot spoof its address by prepending entries. X-Real-IP is
+// only read when X-Forwarded-For is absent.
+func trustedProxyResolver(proxies []*net.IPNet) func(c *gin.Context) string {
+	trusted := func(addr string) bool {
+		return containsIP(proxies, addr)
+	}
+
+	return func(c *gin.Context) string {
+		remote := remoteHost(c.Request)
+		if !trusted(remote) {
+			return remote
+		}
+
+		if xff := c.GetHeader("X-Forwarded-For"); xff != "" {
+			// When every hop is a trusted proxy the leftmost one is the
+			// closest thing to a client; X-Real-IP must not override it.
+			client := remote
+			hops := strings.Split(xff, ",")
+			for i := len(hops) - 1; i >= 0; i-- {
+				hop := strings.TrimSpace(hops[i])
+				if net.ParseIP(hop) == nil {
+					continue
+				}
+				if !trusted(hop) {
+					return hop
+				}
+				client = hop
+			}
+			return client
+		}
+		if realIP := strings.TrimSpace(c.GetHeader("X-Real-IP")); net.ParseIP(realIP) != nil {
+			return realIP
+		}
+		return remote
+	}
+}
+
+// fromTrustedProxy reports whether the direct peer of r is one of proxies,
+// so that its X-Forwarded-* headers can be believed.
+func fromTrustedProxy(r *http.Request, proxies []*net.IPNet) bool {
+	return containsIP(proxies, remoteHost(r))
+}
+
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// parseCIDRs parses IPs or CIDRs; a bare IP matches only itself. what names
+// the list in errors.
+func parseCIDRs(entries []string, what string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(entries))
+	for _, e := range entries {
+		cidr := e
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, errors.New("invalid " + what + ": " + e)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+func containsIP(nets []*net.IPNet, addr string) bool {
+	ip := net.ParseIP(strings.TrimSpace(addr))
+	if ip == nil {
+		return false
+	}
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestTrustedProxyResolver(t *testing.T) {
+	nets, err := parseCIDRs([]string{"10.0.0.0/8", "192.168.1.1"}, "trusted proxy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolve := trustedProxyResolver(nets)
+
+	for _, tc := range []struct {
+		name    string
+		remote  string
+		headers map[string]string
+		want    string
+	}{
+		{"direct client", "203.0.113.7:4000", nil, "203.0.113.7"},
+		{"untrusted peer forwarding", "203.0.113.7:4000", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "203.0.113.7"},
+		{"trusted proxy", "10.0.0.5:4000", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "198.51.100.1"},
+		{"proxy chain", "10.0.0.5:4000", map[string]string{"X-Forwarded-For": "198.51.100.1, 192.168.1.1, 10.1.2.3"}, "198.51.100.1"},
+		{"spoofed prefix", "10.0.0.5:4000", map[string]string{"X-Forwarded-For": "1.2.3.4, 198.51.100.1"}, "198.51.100.1"},
+		{"garbage hop", "10.0.0.5:4000", map[string]string{"X-Forwarded-For": "not-an-ip, 10.1.2.3"}, "10.1.2.3"},
+		{"only garbage", "10.0.0.5:4000", map[string]string{"X-Forwarded-For": "not-an-ip"}, "10.0.0.5"},
+		{"X-Real-IP", "192.168.1.1:4000", map[string]string{"X-Real-IP": " 198.51.100.2 "}, "198.51.100.2"},
+		{"only proxies", "10.0.0.5:4000", map[string]string{"X-Forwarded-For": "192.168.1.1, 10.1.2.3"}, "192.168.1.1"},
+		{"only proxies ignores X-Real-IP", "10.0.0.5:4000", map[string]string{"X-Forwarded-For": "10.1.2.3", "X-Real-IP": "198.51.100.2"}, "10.1.2.3"},
+	} {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+		c.Request.RemoteAddr = tc.remote
+		for k, v := range tc.headers {
+			c.Request.Header.Set(k, v)
+		}
+		if got := resolve(c); got != tc.want {
+			t.Errorf("%s: got %s, want %s", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestParseCIDRs(t *testing.T) {
+	nets, err := parseCIDRs([]string{"10.0.0.0/8", "192.168.1.1", "2001:db8::1"}, "trusted proxy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for addr, want := range map[string]bool{
+		"10.9.9.9":    true,
+		"192.168.1.1": true,
+		"192.168.1.2": false,
+		"2001:db8::1": true,
+		"2001:db8::2": false,
+		"":            false,
+	} {
+		if got := containsIP(nets, addr); got != want {
+			t.Errorf("%q: contained = %v, want %v", addr, got, want)
+		}
+	}
+
+	if _, err := parseCIDRs([]string{"10.0.0.0/33"}, "trusted proxy"); err == nil || err.Error() != "invalid trusted proxy: 10.0.0.0/33" {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestAllowedCIDRs(t *testing.T) {
+	r := gin.New()
+	r.GET("/", VerifyTokenWithOptions(Options{
+		Provider:       newTestKeys(),
+		TrustedProxies: []string{"10.0.0.0/8"},
+		AllowedCIDRs:   []string{"198.51.100.0/24", "2001:db8::/32"},
+	}), func(c *gin.Context) { c.Status(http.StatusOK) })
+	tokenStr := sign(t, jwt.MapClaims{"sub": "alice"})
+
+	for _, tc := range []struct {
+		name   string
+		token  string
+		remote string
+		xff    string
+		want   int
+	}{
+		{"in range", tokenStr, "198.51.100.7:4000", "", http.StatusOK},
+		{"ipv6 in range", tokenStr, "[2001:db8::1]:4000", "", http.StatusOK},
+		{"out of range", tokenStr, "203.0.113.7:4000", "", http.StatusForbidden},
+		{"via trusted proxy", tokenStr, "10.0.0.5:4000", "198.51.100.7", http.StatusOK},
+		{"proxy outside range", tokenStr, "10.0.0.5:4000", "203.0.113.7", http.StatusForbidden},
+		{"spoofed forward", tokenStr, "203.0.113.7:4000", "198.51.100.7", http.StatusForbidden},
+		{"unauthenticated in range", "", "198.51.100.7:4000", "", http.StatusUnauthorized},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = tc.remote
+		if tc.xff != "" {
+			req.Header.Set("X-Forwarded-For", tc.xff)
+		}
+		if tc.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tc.want {
+			t.Errorf("%s: status %d, want %d", tc.name, w.Code, tc.want)
+		}
+		if tc.want == http.StatusForbidden {
+			if got := body(t, w.Body.Bytes())["code"]; got != ErrIPNotAllowed.Code {
+				t.Errorf("%s: code %v", tc.name, got)
+			}
+		}
+	}
+}
+
+func TestAllowedCIDRsInvalid(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("invalid CIDR accepted")
+		}
+	}()
+	VerifyTokenWithOptions(Options{Provider: newTestKeys(), AllowedCIDRs: []string{"10.0.0.0/33"}})
+}
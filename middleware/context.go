@@ -0,0 +1,20 @@
+package middleware
+
+import "github.com/gin-gonic/gin"
+
+// prefixKey stores Options.ContextPrefix so accessors find values set by
+// VerifyToken without being given the options.
+type prefixKey struct{}
+
+func setValue(c *gin.Context, prefix, name string, value any) {
+	if prefix != "" {
+		c.Set(prefixKey{}, prefix)
+	}
+	c.Set(prefix+name, value)
+}
+
+func getValue(c *gin.Context, name string) (any, bool) {
+	prefix, _ := c.Get(prefixKey{})
+	p, _ := prefix.(string)
+	return c.Get(p + name)
+}
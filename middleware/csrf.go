@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// DefaultCSRFHeader carries the CSRF value when Options.CSRFHeader is empty.
+const DefaultCSRFHeader = "X-CSRF-Token"
+
+// checkCSRF implements the double submit pattern: a cross-site request
+// carries the cookie but cannot read the token to copy its CSRF claim into
+// a header. Safe methods are not checked.
+func checkCSRF(r *http.Request, claims jwt.MapClaims, opts Options) *AuthError {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return nil
+	}
+
+	header := opts.CSRFHeader
+	if header == "" {
+		header = DefaultCSRFHeader
+	}
+	want := claimString(claims[opts.CSRFClaim])
+	got := r.Header.Get(header)
+	if want == "" || subtle.ConstantTimeCompare([]byte(got), []byte(want)) != 1 {
+		return ErrCSRFMismatch
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestCSRFDoubleSubmit(t *testing.T) {
+	opts := Options{
+		Provider:    newTestKeys(),
+		TokenLookup: "header:Authorization,cookie:access_token",
+		CSRFClaim:   "csrf",
+	}
+	r := gin.New()
+	r.Any("/", VerifyTokenWithOptions(opts), func(c *gin.Context) { c.Status(http.StatusOK) })
+	h := Verify[jwt.MapClaims](opts)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	tokenStr := sign(t, jwt.MapClaims{"sub": "alice", "csrf": "c5rf"})
+	noClaim := sign(t, jwt.MapClaims{"sub": "alice"})
+
+	for _, tc := range []struct {
+		name   string
+		method string
+		token  string
+		cookie bool
+		header string
+		want   int
+	}{
+		{"matching header", http.MethodPost, tokenStr, true, "c5rf", http.StatusOK},
+		{"missing header", http.MethodPost, tokenStr, true, "", http.StatusForbidden},
+		{"mismatched header", http.MethodDelete, tokenStr, true, "other", http.StatusForbidden},
+		{"token without claim", http.MethodPost, noClaim, true, "", http.StatusForbidden},
+		{"safe GET", http.MethodGet, tokenStr, true, "", http.StatusOK},
+		{"safe HEAD", http.MethodHead, tokenStr, true, "", http.StatusOK},
+		{"bearer header", http.MethodPost, tokenStr, false, "", http.StatusOK},
+	} {
+		for name, handler := range map[string]http.Handler{"gin": r, "net/http": h} {
+			req := httptest.NewRequest(tc.method, "/", nil)
+			if tc.cookie {
+				req.AddCookie(&http.Cookie{Name: "access_token", Value: tc.token})
+			} else {
+				req.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+			if tc.header != "" {
+				req.Header.Set(DefaultCSRFHeader, tc.header)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Code != tc.want {
+				t.Errorf("%s %s: status %d, want %d", name, tc.name, w.Code, tc.want)
+			}
+		}
+	}
+}
+
+func TestCSRFCustomHeader(t *testing.T) {
+	r := gin.New()
+	r.POST("/", VerifyTokenWithOptions(Options{
+		Provider:    newTestKeys(),
+		TokenLookup: "cookie:access_token",
+		CSRFClaim:   "csrf",
+		CSRFHeader:  "X-XSRF-Token",
+	}), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for header, want := range map[string]int{"X-XSRF-Token": http.StatusOK, DefaultCSRFHeader: http.StatusForbidden} {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.AddCookie(&http.Cookie{Name: "access_token", Value: sign(t, jwt.MapClaims{"sub": "alice", "csrf": "c5rf"})})
+		req.Header.Set(header, "c5rf")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Errorf("%s: status %d, want %d", header, w.Code, want)
+		}
+	}
+}
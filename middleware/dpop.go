@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/digitcodestudiotech/go-middle/crypto"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const defaultDPoPProofMaxAge = 5 * time.Minute
+
+var dpopAlgorithms = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// checkDPoP verifies the DPoP proof of RFC 9449 sent with a DPoP-bound access
+// token: the proof must be signed by the key in its jwk header, match the
+// request method and URL, be recent, hash the access token in ath, and the
+// jwk thumbprint must equal the token cnf.jkt.
+func checkDPoP(r *http.Request, tokenStr string, claims jwt.MapClaims, opts Options) *AuthError {
+	cnf, _ := claims["cnf"].(map[string]interface{})
+	jkt, _ := cnf["jkt"].(string)
+	if jkt == "" {
+		return ErrTokenNotDPoPBound
+	}
+
+	proofs := r.Header.Values("DPoP")
+	if len(proofs) != 1 {
+		return ErrInvalidDPoPProof.wrap(errors.New("exactly one DPoP header is required"))
+	}
+
+	var thumbprint string
+	proof, err := jwt.Parse(proofs[0], func(t *jwt.Token) (interface{}, error) {
+		if typ, _ := t.Header["typ"].(string); typ != "dpop+jwt" {
+			return nil, errors.New("typ must be dpop+jwt")
+		}
+		raw, err := json.Marshal(t.Header["jwk"])
+		if err != nil {
+			return nil, err
+		}
+		if thumbprint, err = crypto.JWKThumbprint(raw); err != nil {
+			return nil, err
+		}
+		return crypto.ParseJWK(raw)
+	}, jwt.WithValidMethods(dpopAlgorithms))
+	if err != nil || !proof.Valid {
+		return ErrInvalidDPoPProof.wrap(err)
+	}
+
+	proofClaims := proof.Claims.(jwt.MapClaims)
+
+	if jti, _ := proofClaims["jti"].(string); jti == "" {
+		return ErrInvalidDPoPProof.wrap(errors.New("missing jti"))
+	}
+	if htm, _ := proofClaims["htm"].(string); htm != r.Method {
+		return ErrInvalidDPoPProof.wrap(errors.New("htm does not match request method"))
+	}
+	if htu, _ := proofClaims["htu"].(string); stripQuery(htu) != requestURL(r, opts) {
+		return ErrInvalidDPoPProof.wrap(errors.New("htu does not match request URL"))
+	}
+
+	iat, err := proofClaims.GetIssuedAt()
+	if err != nil || iat == nil {
+		return ErrInvalidDPoPProof.wrap(errors.New("missing iat"))
+	}
+	maxAge := opts.DPoPProofMaxAge
+	if maxAge <= 0 {
+		maxAge = defaultDPoPProofMaxAge
+	}
+	if age := time.Since(iat.Time); age > maxAge || age < -maxAge {
+		return ErrInvalidDPoPProof.wrap(errors.New("iat outside accepted window"))
+	}
+
+	sum := sha256.Sum256([]byte(tokenStr))
+	if ath, _ := proofClaims["ath"].(string); ath != base64.RawURLEncoding.EncodeToString(sum[:]) {
+		return ErrInvalidDPoPProof.wrap(errors.New("ath does not match access token"))
+	}
+
+	if thumbprint != jkt {
+		return ErrDPoPBindingMismatch
+	}
+	return nil
+}
+
+// requestURL is the htu of r. X-Forwarded-Proto is only believed from
+// opts.TrustedProxies.
+func requestURL(r *http.Request, opts Options) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	} else if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" && fromTrustedProxy(r, opts.trustedProxies) {
+		scheme = proto
+	}
+	return scheme + "://" + r.Host + r.URL.Path
+}
+
+func stripQuery(u string) string {
+	if i := strings.IndexAny(u, "?#"); i >= 0 {
+		return u[:i]
+	}
+	return u
+}
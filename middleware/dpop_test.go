@@ -0,0 +1,185 @@
+package middleware
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/digitcodestudiotech/go-middle/crypto"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// dpopKey is a client key pair with its public JWK and thumbprint.
+type dpopKey struct {
+	priv       *ecdsa.PrivateKey
+	jwk        map[string]string
+	thumbprint string
+}
+
+func newDPoPKey(t *testing.T) dpopKey {
+	t.Helper()
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwk := map[string]string{
+		"kty": "EC",
+		"crv": "P-256",
+		"x":   base64.RawURLEncoding.EncodeToString(priv.X.FillBytes(make([]byte, 32))),
+		"y":   base64.RawURLEncoding.EncodeToString(priv.Y.FillBytes(make([]byte, 32))),
+	}
+	raw, _ := json.Marshal(jwk)
+	thumbprint, err := crypto.JWKThumbprint(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dpopKey{priv, jwk, thumbprint}
+}
+
+// proof signs a DPoP proof for GET https://api.example.com/orders bound to
+// tokenStr, after edit adjusts its claims and header.
+func (k dpopKey) proof(t *testing.T, tokenStr string, edit func(claims jwt.MapClaims, header map[string]any)) string {
+	t.Helper()
+	sum := sha256.Sum256([]byte(tokenStr))
+	claims := jwt.MapClaims{
+		"jti": "proof-1",
+		"htm": http.MethodGet,
+		"htu": "https://api.example.com/orders",
+		"iat": time.Now().Unix(),
+		"ath": base64.RawURLEncoding.EncodeToString(sum[:]),
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["typ"] = "dpop+jwt"
+	token.Header["jwk"] = k.jwk
+	if edit != nil {
+		edit(claims, token.Header)
+	}
+	proof, err := token.SignedString(k.priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return proof
+}
+
+func dpopRequest(proofs ...string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "https://api.example.com/orders?page=2", nil)
+	for _, p := range proofs {
+		r.Header.Add("DPoP", p)
+	}
+	return r
+}
+
+func TestCheckDPoP(t *testing.T) {
+	key := newDPoPKey(t)
+	tokenStr := "access-token"
+	bound := jwt.MapClaims{"cnf": map[string]interface{}{"jkt": key.thumbprint}}
+
+	for _, tc := range []struct {
+		name   string
+		edit   func(jwt.MapClaims, map[string]any)
+		claims jwt.MapClaims
+		want   *AuthError
+	}{
+		{"valid", nil, bound, nil},
+		{"htu with query", func(c jwt.MapClaims, _ map[string]any) { c["htu"] = "https://api.example.com/orders?page=3" }, bound, nil},
+		{"token not bound", nil, jwt.MapClaims{}, ErrTokenNotDPoPBound},
+		{"other key", nil, jwt.MapClaims{"cnf": map[string]interface{}{"jkt": newDPoPKey(t).thumbprint}}, ErrDPoPBindingMismatch},
+		{"wrong typ", func(_ jwt.MapClaims, h map[string]any) { h["typ"] = "JWT" }, bound, ErrInvalidDPoPProof},
+		{"no jti", func(c jwt.MapClaims, _ map[string]any) { delete(c, "jti") }, bound, ErrInvalidDPoPProof},
+		{"wrong htm", func(c jwt.MapClaims, _ map[string]any) { c["htm"] = http.MethodPost }, bound, ErrInvalidDPoPProof},
+		{"wrong htu", func(c jwt.MapClaims, _ map[string]any) { c["htu"] = "https://api.example.com/admin" }, bound, ErrInvalidDPoPProof},
+		{"no iat", func(c jwt.MapClaims, _ map[string]any) { delete(c, "iat") }, bound, ErrInvalidDPoPProof},
+		{"old iat", func(c jwt.MapClaims, _ map[string]any) { c["iat"] = ago(10 * time.Minute) }, bound, ErrInvalidDPoPProof},
+		{"future iat", func(c jwt.MapClaims, _ map[string]any) { c["iat"] = in(10 * time.Minute) }, bound, ErrInvalidDPoPProof},
+		{"wrong ath", func(c jwt.MapClaims, _ map[string]any) { c["ath"] = "x" }, bound, ErrInvalidDPoPProof},
+	} {
+		err := checkDPoP(dpopRequest(key.proof(t, tokenStr, tc.edit)), tokenStr, tc.claims, Options{})
+		if tc.want == nil && err != nil || tc.want != nil && !errors.Is(err, tc.want) {
+			t.Errorf("%s: err = %v, want %v", tc.name, err, tc.want)
+		}
+	}
+}
+
+func TestDPoPForwardedProto(t *testing.T) {
+	key := newDPoPKey(t)
+	bound := jwt.MapClaims{"cnf": map[string]interface{}{"jkt": key.thumbprint}}
+	proof := key.proof(t, "access-token", nil)
+	proxies, err := parseCIDRs([]string{"10.0.0.0/8"}, "trusted proxy")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		remote string
+		want   *AuthError
+	}{
+		{"trusted proxy", "10.0.0.5:4000", nil},
+		{"untrusted peer", "203.0.113.7:4000", ErrInvalidDPoPProof},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "http://api.example.com/orders", nil)
+		r.RemoteAddr = tc.remote
+		r.Header.Set("X-Forwarded-Proto", "https")
+		r.Header.Set("DPoP", proof)
+
+		err := checkDPoP(r, "access-token", bound, Options{trustedProxies: proxies})
+		if tc.want == nil && err != nil || tc.want != nil && !errors.Is(err, tc.want) {
+			t.Errorf("%s: err = %v, want %v", tc.name, err, tc.want)
+		}
+	}
+}
+
+func TestCheckDPoPProofCount(t *testing.T) {
+	key := newDPoPKey(t)
+	bound := jwt.MapClaims{"cnf": map[string]interface{}{"jkt": key.thumbprint}}
+	proof := key.proof(t, "access-token", nil)
+
+	for name, r := range map[string]*http.Request{"none": dpopRequest(), "two": dpopRequest(proof, proof)} {
+		if err := checkDPoP(r, "access-token", bound, Options{}); !errors.Is(err, ErrInvalidDPoPProof) {
+			t.Errorf("%s: err = %v, want ErrInvalidDPoPProof", name, err)
+		}
+	}
+}
+
+func TestDPoPProofMaxAge(t *testing.T) {
+	key := newDPoPKey(t)
+	bound := jwt.MapClaims{"cnf": map[string]interface{}{"jkt": key.thumbprint}}
+	proof := key.proof(t, "access-token", func(c jwt.MapClaims, _ map[string]any) { c["iat"] = ago(time.Minute) })
+
+	if err := checkDPoP(dpopRequest(proof), "access-token", bound, Options{DPoPProofMaxAge: 30 * time.Second}); !errors.Is(err, ErrInvalidDPoPProof) {
+		t.Fatalf("err = %v, want ErrInvalidDPoPProof", err)
+	}
+}
+
+func TestVerifyDPoPScheme(t *testing.T) {
+	key := newDPoPKey(t)
+	tokenStr := sign(t, jwt.MapClaims{"sub": "alice", "cnf": map[string]any{"jkt": key.thumbprint}})
+	r := gin.New()
+	r.GET("/orders", VerifyTokenWithOptions(Options{Provider: newTestKeys(), DPoP: true}), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	for _, scheme := range []string{"DPoP", "Bearer"} {
+		req := dpopRequest(key.proof(t, tokenStr, nil))
+		req.Header.Set("Authorization", scheme+" "+tokenStr)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: status %d, body %s", scheme, w.Code, w.Body)
+		}
+	}
+
+	w := serve(sign(t, jwt.MapClaims{"sub": "alice"}), VerifyTokenWithOptions(Options{Provider: newTestKeys(), DPoP: true}))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("unbound token: status %d, want 401", w.Code)
+	}
+}
@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"time"
+
+	"github.com/digitcodestudiotech/go-middle/utils"
+)
+
+// applyEnv fills opts from environment variables. By default explicit
+// options win and env only fills empty fields; with opts.EnvOverride set,
+// any env value that is present replaces the option.
+func applyEnv(opts Options) Options {
+	override := opts.EnvOverride
+
+	if opts.Provider == nil {
+		if opts.PublicKeyURL == "" {
+			// Env is the only key source left, so GetEnv warns when unset.
+			opts.PublicKeyURL = utils.GetEnv("PUBLIC_KEY_URL")
+		} else {
+			envString(&opts.PublicKeyURL, "PUBLIC_KEY_URL", override)
+		}
+		envDuration(&opts.RefreshEvery, "PUBLIC_KEY_REFRESH_EVERY", override)
+	}
+	envSlice(&opts.Audience, "JWT_AUDIENCE", override)
+	envString(&opts.Issuer, "JWT_ISSUER", override)
+	envSlice(&opts.Algorithms, "JWT_ALGORITHMS", override)
+	envDuration(&opts.Leeway, "JWT_LEEWAY", override)
+	envDuration(&opts.NotBeforeLeeway, "JWT_NOT_BEFORE_LEEWAY", override)
+
+	return opts
+}
+
+func envString(dst *string, key string, override bool) {
+	if v := utils.GetEnvOptional(key); v != "" && (override || *dst == "") {
+		*dst = v
+	}
+}
+
+func envSlice(dst *[]string, key string, override bool) {
+	if v := utils.GetEnvSlice(key); len(v) > 0 && (override || len(*dst) == 0) {
+		*dst = v
+	}
+}
+
+func envDuration(dst *time.Duration, key string, override bool) {
+	if v := utils.GetEnvDuration(key); v > 0 && (override || *dst == 0) {
+		*dst = v
+	}
+}
@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestAudienceFromEnv(t *testing.T) {
+	t.Setenv("JWT_AUDIENCE", "api, admin")
+	verify := VerifyTokenWithOptions(Options{Provider: newTestKeys(), EnvOverride: true})
+
+	for _, tc := range []struct {
+		aud  any
+		want int
+	}{
+		{"admin", http.StatusOK},
+		{[]string{"web", "api"}, http.StatusOK},
+		{"web", http.StatusUnauthorized},
+	} {
+		if w := serve(sign(t, jwt.MapClaims{"sub": "alice", "aud": tc.aud}), verify); w.Code != tc.want {
+			t.Errorf("aud %v: status %d, want %d", tc.aud, w.Code, tc.want)
+		}
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	t.Setenv("PUBLIC_KEY_URL", "https://env.example.com/key")
+	t.Setenv("PUBLIC_KEY_REFRESH_EVERY", "2m")
+	t.Setenv("JWT_ISSUER", "https://env.example.com")
+	t.Setenv("JWT_LEEWAY", "not-a-duration")
+	explicit := Options{PublicKeyURL: "https://opts.example.com/key", RefreshEvery: time.Minute, Leeway: time.Second}
+
+	got := applyEnv(explicit)
+	if got.PublicKeyURL != explicit.PublicKeyURL || got.RefreshEvery != time.Minute {
+		t.Errorf("env replaced explicit options: %q, %v", got.PublicKeyURL, got.RefreshEvery)
+	}
+	if got.Issuer != "https://env.example.com" {
+		t.Errorf("Issuer = %q, want it filled from env", got.Issuer)
+	}
+
+	explicit.EnvOverride = true
+	got = applyEnv(explicit)
+	if got.PublicKeyURL != "https://env.example.com/key" || got.RefreshEvery != 2*time.Minute {
+		t.Errorf("EnvOverride: %q, %v, want env values", got.PublicKeyURL, got.RefreshEvery)
+	}
+	if got.Leeway != time.Second {
+		t.Errorf("invalid JWT_LEEWAY replaced Leeway: %v", got.Leeway)
+	}
+}
+
+func TestApplyEnvSkipsKeyURLWithProvider(t *testing.T) {
+	t.Setenv("PUBLIC_KEY_URL", "https://env.example.com/key")
+	if got := applyEnv(Options{Provider: newTestKeys(), EnvOverride: true}); got.PublicKeyURL != "" {
+		t.Fatalf("PublicKeyURL = %q with a Provider", got.PublicKeyURL)
+	}
+}
+
+func TestApplyEnvWarnsWithoutKeySource(t *testing.T) {
+	var buf strings.Builder
+	prev := log.Writer()
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(prev) })
+	t.Setenv("PUBLIC_KEY_URL", "")
+
+	applyEnv(Options{PublicKeyURL: "https://keys.example.com/key"})
+	applyEnv(Options{Provider: newTestKeys()})
+	if buf.Len() != 0 {
+		t.Fatalf("warned with a key source: %q", buf.String())
+	}
+	applyEnv(Options{})
+	if !strings.Contains(buf.String(), "env PUBLIC_KEY_URL not set") {
+		t.Fatalf("log = %q, want the PUBLIC_KEY_URL warning", buf.String())
+	}
+}
+
+func TestProviderSkipsEnv(t *testing.T) {
+	t.Setenv("PUBLIC_KEY_URL", "http://127.0.0.1:1/unreachable")
+	t.Setenv("JWT_ISSUER", "https://env.example.com")
+
+	verify := VerifyTokenWithOptions(Options{Provider: newTestKeys()})
+	if w := serve(sign(t, jwt.MapClaims{"sub": "alice"}), verify); w.Code != http.StatusOK {
+		t.Fatalf("status %d: env applied despite a Provider", w.Code)
+	}
+
+	verify = VerifyTokenWithOptions(Options{Provider: newTestKeys(), EnvOverride: true})
+	if w := serve(sign(t, jwt.MapClaims{"sub": "alice"}), verify); w.Code != http.StatusUnauthorized {
+		t.Fatalf("status %d: JWT_ISSUER ignored with EnvOverride", w.Code)
+	}
+}
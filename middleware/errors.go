@@ -0,0 +1,164 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type AuthError struct {
+	Status  int
+	Code    string
+	Message string
+	// Err is the underlying cause, only exposed in responses when
+	// Options.VerboseErrors is set and it is a token parse or validation
+	// error.
+	Err error
+}
+
+func newAuthError(status int, code, message string) *AuthError {
+	return &AuthError{Status: status, Code: code, Message: message}
+}
+
+func (e *AuthError) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *AuthError) Unwrap() error {
+	return e.Err
+}
+
+// Is matches on Code, so a sentinel wrapped with a cause still satisfies
+// errors.Is(err, ErrTokenExpired).
+func (e *AuthError) Is(target error) bool {
+	t, ok := target.(*AuthError)
+	return ok && t.Code == e.Code
+}
+
+// wrap returns a copy of e carrying err as its cause.
+func (e *AuthError) wrap(err error) *AuthError {
+	wrapped := *e
+	wrapped.Err = err
+	return &wrapped
+}
+
+var (
+	ErrMissingAuthorization = newAuthError(http.StatusUnauthorized, "missing_authorization", "missing authorization header")
+	ErrInvalidFormat        = newAuthError(http.StatusUnauthorized, "invalid_format", "invalid authorization format")
+	ErrTokenTooLarge        = newAuthError(http.StatusBadRequest, "token_too_large", "token exceeds maximum size")
+	ErrInvalidToken         = newAuthError(http.StatusUnauthorized, "invalid_token", "invalid or expired token")
+	ErrMalformedToken       = newAuthError(http.StatusUnauthorized, "malformed_token", "malformed token")
+	ErrCriticalHeader       = newAuthError(http.StatusUnauthorized, "unsupported_critical_header", "token declares an unsupported critical header")
+	ErrInvalidAlgorithm     = newAuthError(http.StatusUnauthorized, "invalid_algorithm", "signing algorithm not allowed")
+	ErrDeprecatedAlgorithm  = newAuthError(http.StatusUnauthorized, "deprecated_algorithm", "signing algorithm is deprecated")
+	ErrAlgorithmKeyMismatch = newAuthError(http.StatusUnauthorized, "alg_key_mismatch", "signing algorithm does not match key type")
+	ErrUnverifiableToken    = newAuthError(http.StatusUnauthorized, "unverifiable_token", "unable to resolve verification key")
+	ErrInvalidSignature     = newAuthError(http.StatusUnauthorized, "invalid_signature", "invalid token signature")
+	ErrTokenExpired         = newAuthError(http.StatusUnauthorized, "token_expired", "token is expired")
+	ErrTokenNotValidYet     = newAuthError(http.StatusUnauthorized, "token_not_valid_yet", "token is not valid yet")
+	ErrInvalidIssuer        = newAuthError(http.StatusUnauthorized, "invalid_issuer", "token issuer not accepted")
+	ErrDecryptFailed        = newAuthError(http.StatusUnauthorized, "decrypt_failed", "unable to decrypt token")
+	ErrInvalidAudience      = newAuthError(http.StatusUnauthorized, "invalid_audience", "token audience not accepted")
+	ErrMissingIssuedAt      = newAuthError(http.StatusUnauthorized, "missing_iat", "token has no issued at claim")
+	ErrTokenTooOld          = newAuthError(http.StatusUnauthorized, "token_too_old", "token is too old")
+	ErrTokenNotDPoPBound    = newAuthError(http.StatusUnauthorized, "token_not_dpop_bound", "token is not DPoP bound")
+	ErrInvalidDPoPProof     = newAuthError(http.StatusUnauthorized, "invalid_dpop_proof", "invalid DPoP proof")
+	ErrDPoPBindingMismatch  = newAuthError(http.StatusUnauthorized, "dpop_binding_mismatch", "DPoP proof key does not match token binding")
+	ErrTokenNotCertBound    = newAuthError(http.StatusUnauthorized, "token_not_certificate_bound", "token is not certificate bound")
+	ErrCertBindingMismatch  = newAuthError(http.StatusUnauthorized, "certificate_binding_mismatch", "client certificate does not match token binding")
+	ErrMissingRequiredClaim = newAuthError(http.StatusUnauthorized, "missing_required_claim", "missing required claim")
+	ErrClaimConflict        = newAuthError(http.StatusUnauthorized, "claim_conflict", "token header and payload claims conflict")
+	ErrNonceMismatch        = newAuthError(http.StatusUnauthorized, "nonce_mismatch", "ID token nonce does not match")
+	ErrTokenInactive        = newAuthError(http.StatusUnauthorized, "token_inactive", "token is not active")
+	ErrTokenRevoked         = newAuthError(http.StatusUnauthorized, "token_revoked", "token has been revoked")
+	ErrClaimsRejected       = newAuthError(http.StatusUnauthorized, "claims_rejected", "token claims rejected")
+	ErrRevocationFailed     = newAuthError(http.StatusServiceUnavailable, "revocation_unavailable", "unable to check token revocation")
+	ErrIntrospectionFailed  = newAuthError(http.StatusServiceUnavailable, "introspection_unavailable", "unable to introspect token")
+	ErrValidationTimeout    = newAuthError(http.StatusServiceUnavailable, "timeout", "token validation timed out")
+	ErrKeyStale             = newAuthError(http.StatusServiceUnavailable, "key_stale", "verification keys are stale")
+	ErrKeysNotReady         = newAuthError(http.StatusServiceUnavailable, "keys_not_ready", "verification keys are still loading")
+	ErrNoKeyProvider        = newAuthError(http.StatusInternalServerError, "no_key_provider", "no key provider configured")
+	ErrRequestRejected      = newAuthError(http.StatusUnauthorized, "request_rejected", "request rejected")
+	ErrMissingClaims        = newAuthError(http.StatusUnauthorized, "missing_claims", "no claims found")
+	ErrUnexpectedClaims     = newAuthError(http.StatusInternalServerError, "unexpected_claims_type", "claims have an unexpected type")
+	ErrCSRFMismatch         = newAuthError(http.StatusForbidden, "csrf_mismatch", "CSRF token missing or mismatched")
+	ErrInsecureTransport    = newAuthError(http.StatusForbidden, "insecure_transport", "connection security below required level")
+	ErrIPNotAllowed         = newAuthError(http.StatusForbidden, "ip_not_allowed", "client address not allowed")
+	ErrUserResolution       = newAuthError(http.StatusForbidden, "user_resolution_failed", "unable to resolve user")
+	ErrReauthRequired       = newAuthError(http.StatusUnauthorized, "reauthentication_required", "recent authentication required")
+	ErrInsufficientAuth     = newAuthError(http.StatusForbidden, "insufficient_authentication", "authentication method not sufficient")
+	ErrRateLimited          = newAuthError(http.StatusTooManyRequests, "rate_limited", "too many requests")
+	ErrInsufficientScope    = newAuthError(http.StatusForbidden, "insufficient_scope", "token lacks required scope")
+	ErrInsufficientRole     = newAuthError(http.StatusForbidden, "insufficient_role", "token lacks required role")
+)
+
+func abort(c *gin.Context, err *AuthError) {
+	c.AbortWithStatusJSON(err.Status, errorBody(err, false))
+}
+
+func errorBody(err *AuthError, verbose bool) gin.H {
+	body := gin.H{"error": err.Message, "code": err.Code}
+	if verbose && err.Err != nil && tokenError(err) {
+		body["detail"] = err.Err.Error()
+	}
+	return body
+}
+
+// tokenError reports whether the cause of err comes from parsing or
+// validating the token itself. Only those causes are shown with
+// VerboseErrors; errors of hooks, checkers and stores, which may carry
+// internal details, never are.
+func tokenError(err *AuthError) bool {
+	if err.Code == ErrMalformedToken.Code || err.Code == ErrCriticalHeader.Code {
+		return true
+	}
+	for _, target := range []error{
+		jwt.ErrTokenMalformed, jwt.ErrTokenUnverifiable, jwt.ErrTokenSignatureInvalid,
+		jwt.ErrTokenInvalidClaims, jwt.ErrTokenRequiredClaimMissing, jwt.ErrTokenExpired,
+		jwt.ErrTokenNotValidYet, jwt.ErrTokenUsedBeforeIssued, jwt.ErrTokenInvalidAudience,
+		jwt.ErrTokenInvalidIssuer, jwt.ErrTokenInvalidSubject, jwt.ErrTokenInvalidId,
+	} {
+		if errors.Is(err.Err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// fail reports err through opts.ErrorHandler when configured, otherwise it
+// writes the default JSON body. Errors that are not an *AuthError are
+// reported as ErrRequestRejected.
+func fail(c *gin.Context, opts Options, err error) {
+	if opts.OnAuthFailure != nil {
+		opts.OnAuthFailure(c, err)
+	}
+	audit(c, opts, AuditRejected, asAuthError(err), nil)
+	if opts.ErrorHandler != nil {
+		opts.ErrorHandler(c, err)
+		c.Abort()
+		return
+	}
+	authErr := asAuthError(err)
+	body := errorBody(authErr, opts.VerboseErrors)
+	if opts.MarshalError != nil {
+		if raw, err := opts.MarshalError(body); err == nil {
+			c.Data(authErr.Status, "application/json; charset=utf-8", raw)
+			c.Abort()
+			return
+		}
+	}
+	c.AbortWithStatusJSON(authErr.Status, body)
+}
+
+func asAuthError(err error) *AuthError {
+	var authErr *AuthError
+	if errors.As(err, &authErr) {
+		return authErr
+	}
+	return ErrRequestRejected.wrap(err)
+}
@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func body(t *testing.T, raw []byte) map[string]any {
+	t.Helper()
+	var m map[string]any
+	if err := json.Unmarshal(raw, &m); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestVerboseErrorsShowsTokenErrors(t *testing.T) {
+	verify := VerifyTokenWithOptions(Options{Provider: newTestKeys(), VerboseErrors: true})
+	tokenStr := sign(t, jwt.MapClaims{"sub": "alice", "exp": time.Now().Add(-time.Hour).Unix()})
+
+	w := serve(tokenStr, verify)
+	got := body(t, w.Body.Bytes())
+	if got["code"] != ErrTokenExpired.Code || got["detail"] == nil {
+		t.Fatalf("body = %v, want token_expired with detail", got)
+	}
+}
+
+func TestVerboseErrorsHidesHookErrors(t *testing.T) {
+	internal := errors.New("db01.internal: connection refused")
+	for name, opts := range map[string]Options{
+		"PreValidate": {PreValidate: func(*gin.Context) (bool, error) { return false, internal }},
+		"Validator":   {Validator: func(jwt.MapClaims) error { return internal }},
+	} {
+		opts.Provider = newTestKeys()
+		opts.VerboseErrors = true
+
+		w := serve(sign(t, jwt.MapClaims{"sub": "alice"}), VerifyTokenWithOptions(opts))
+		if got := body(t, w.Body.Bytes()); got["detail"] != nil {
+			t.Errorf("%s: body = %v, want no detail", name, got)
+		}
+	}
+}
+
+func TestErrorsWithoutVerbose(t *testing.T) {
+	w := serve("not-a-token", VerifyTokenWithOptions(Options{Provider: newTestKeys()}))
+	got := body(t, w.Body.Bytes())
+	if w.Code != http.StatusUnauthorized || got["code"] != ErrMalformedToken.Code || got["detail"] != nil {
+		t.Fatalf("status %d, body = %v", w.Code, got)
+	}
+}
+
+func TestErrorHandlerReceivesCause(t *testing.T) {
+	var got error
+	verify := VerifyTokenWithOptions(Options{
+		Provider:     newTestKeys(),
+		ErrorHandler: func(c *gin.Context, err error) { got = err; c.Status(http.StatusTeapot) },
+	})
+
+	if w := serve("", verify); w.Code != http.StatusTeapot {
+		t.Fatalf("status %d, want 418", w.Code)
+	}
+	if !errors.Is(got, ErrMissingAuthorization) {
+		t.Fatalf("err = %v, want ErrMissingAuthorization", got)
+	}
+}
+
+func TestAuthErrorIsMatchesCode(t *testing.T) {
+	wrapped := ErrTokenExpired.wrap(jwt.ErrTokenExpired)
+	if !errors.Is(wrapped, ErrTokenExpired) || !errors.Is(wrapped, jwt.ErrTokenExpired) {
+		t.Fatal("wrapped error does not match its sentinel and cause")
+	}
+	if errors.Is(wrapped, ErrInvalidToken) {
+		t.Fatal("wrapped error matches another sentinel")
+	}
+}
+
+func TestMarshalError(t *testing.T) {
+	verify := VerifyTokenWithOptions(Options{
+		Provider:     newTestKeys(),
+		MarshalError: func(v any) ([]byte, error) { return []byte(`{"custom":true}`), nil },
+	})
+	w := serve("", verify)
+	if w.Code != http.StatusUnauthorized || w.Body.String() != `{"custom":true}` {
+		t.Fatalf("status %d, body %s", w.Code, w.Body)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json; charset=utf-8" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+}
+
+func TestMarshalErrorFallback(t *testing.T) {
+	verify := VerifyTokenWithOptions(Options{
+		Provider:     newTestKeys(),
+		MarshalError: func(v any) ([]byte, error) { return nil, errors.New("encoder broken") },
+	})
+	w := serve("", verify)
+	if got := body(t, w.Body.Bytes()); w.Code != http.StatusUnauthorized || got["code"] != ErrMissingAuthorization.Code {
+		t.Fatalf("status %d, body %v", w.Code, got)
+	}
+}
@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"regexp"
+	"sync"
+)
+
+// DefaultFailureLogSize is the capacity of a FailureLog created with size 0.
+const DefaultFailureLogSize = 100
+
+// maxFailureReason caps the length of a recorded reason.
+const maxFailureReason = 256
+
+// FailureLog keeps the most recent authentication failures in memory, for
+// diagnosing a spike from a dashboard. Set its Record method as
+// Options.AuditLogger, or call it from an existing logger, and expose it
+// with FailureLogHandler. Entries are redacted as they are recorded: the
+// subject becomes a short keyed hash, the issuer its host, and anything
+// shaped like a token in the reason is removed.
+type FailureLog struct {
+	mu      sync.Mutex
+	entries []AuditEvent
+	next    int
+	full    bool
+}
+
+func NewFailureLog(size int) *FailureLog {
+	if size <= 0 {
+		size = DefaultFailureLogSize
+	}
+	return &FailureLog{entries: make([]AuditEvent, size)}
+}
+
+// Record stores rejected and would-be rejected events, overwriting the
+// oldest entry once the log is full. Other event types are ignored.
+func (l *FailureLog) Record(e AuditEvent) {
+	if e.Type != AuditRejected && e.Type != AuditWouldReject {
+		return
+	}
+	e = redactEvent(e)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries[l.next] = e
+	l.next = (l.next + 1) % len(l.entries)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// Recent returns the recorded failures, oldest first.
+func (l *FailureLog) Recent() []AuditEvent {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.full {
+		return append([]AuditEvent{}, l.entries[:l.next]...)
+	}
+	recent := make([]AuditEvent, 0, len(l.entries))
+	recent = append(recent, l.entries[l.next:]...)
+	return append(recent, l.entries[:l.next]...)
+}
+
+// jwtLike matches compact JWS and JWE serializations, whose first segment
+// is a base64url JSON object.
+var jwtLike = regexp.MustCompile(`eyJ[A-Za-z0-9_-]*(\.[A-Za-z0-9_-]*){2,4}`)
+
+// subjectKey keys the subject hash. It is random per process, so a recorded
+// hash correlates failures of one subject but cannot be matched against
+// hashes of guessed subjects.
+var subjectKey = func() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	return key
+}()
+
+func redactEvent(e AuditEvent) AuditEvent {
+	if e.Subject != "" {
+		mac := hmac.New(sha256.New, subjectKey)
+		mac.Write([]byte(e.Subject))
+		e.Subject = "hmac:" + hex.EncodeToString(mac.Sum(nil)[:8])
+	}
+	if e.Issuer != "" {
+		if u, err := url.Parse(e.Issuer); err == nil && u.Host != "" {
+			e.Issuer = u.Host
+		} else {
+			e.Issuer = "[redacted]"
+		}
+	}
+	e.Reason = jwtLike.ReplaceAllString(e.Reason, "[redacted]")
+	if len(e.Reason) > maxFailureReason {
+		e.Reason = e.Reason[:maxFailureReason] + "..."
+	}
+	return e
+}
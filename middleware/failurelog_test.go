@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestFailureLogKeepsNewest(t *testing.T) {
+	log := NewFailureLog(2)
+	for i := range 3 {
+		log.Record(AuditEvent{Type: AuditRejected, Code: strconv.Itoa(i)})
+	}
+	log.Record(AuditEvent{Type: AuditDeprecatedAlgorithm})
+
+	recent := log.Recent()
+	if len(recent) != 2 || recent[0].Code != "1" || recent[1].Code != "2" {
+		t.Fatalf("recent = %+v, want codes 1 and 2", recent)
+	}
+}
+
+func TestFailureLogRecentEmpty(t *testing.T) {
+	if recent := NewFailureLog(0).Recent(); recent == nil || len(recent) != 0 {
+		t.Fatalf("recent = %#v, want an empty slice", recent)
+	}
+}
+
+func TestFailureLogRedacts(t *testing.T) {
+	log := NewFailureLog(0)
+	tokenStr := sign(t, jwt.MapClaims{"sub": "alice"})
+	log.Record(AuditEvent{
+		Type:    AuditWouldReject,
+		Subject: "alice",
+		Issuer:  "https://auth.example.com/realms/main",
+		Reason:  "bad token " + tokenStr + " from auth.example.com" + strings.Repeat("x", 300),
+	})
+	log.Record(AuditEvent{Type: AuditRejected, Subject: "alice"})
+
+	recent := log.Recent()
+	e := recent[0]
+	unkeyed := sha256.Sum256([]byte("alice"))
+	if !strings.HasPrefix(e.Subject, "hmac:") || strings.Contains(e.Subject, hex.EncodeToString(unkeyed[:6])) {
+		t.Errorf("subject = %q, want a keyed hash", e.Subject)
+	}
+	if recent[1].Subject != e.Subject {
+		t.Errorf("subject hashes differ: %q, %q", e.Subject, recent[1].Subject)
+	}
+	if e.Issuer != "auth.example.com" {
+		t.Errorf("issuer = %q, want the host", e.Issuer)
+	}
+	if strings.Contains(e.Reason, tokenStr) || !strings.Contains(e.Reason, "auth.example.com") {
+		t.Errorf("reason = %q", e.Reason)
+	}
+	if len(e.Reason) > maxFailureReason+len("...") {
+		t.Errorf("reason is %d bytes long", len(e.Reason))
+	}
+}
+
+func TestFailureLogHandler(t *testing.T) {
+	log := NewFailureLog(0)
+	log.Record(AuditEvent{Type: AuditRejected, Code: "token_expired"})
+
+	w := call(FailureLogHandler(log, allow))
+	var events []AuditEvent
+	if err := json.Unmarshal(w.Body.Bytes(), &events); err != nil || len(events) != 1 || events[0].Code != "token_expired" {
+		t.Fatalf("body = %s, %v", w.Body, err)
+	}
+	if w := call(FailureLogHandler(log, deny)); w.Code != http.StatusForbidden {
+		t.Fatalf("guarded: status %d, want 403", w.Code)
+	}
+}
+
+func TestFailureLogHandlerNilGuardPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("nil guard accepted")
+		}
+	}()
+	FailureLogHandler(NewFailureLog(0), nil)
+}
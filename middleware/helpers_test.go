@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+var (
+	testKey  = generateKey()
+	otherKey = generateKey()
+)
+
+func generateKey() *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+// testKeys is a KeyProvider serving RSA public keys by kid. Keys can be
+// removed to simulate a JWKS rotation.
+type testKeys struct {
+	mu   sync.Mutex
+	keys map[string]*rsa.PublicKey
+}
+
+func newTestKeys() *testKeys {
+	return &testKeys{keys: map[string]*rsa.PublicKey{"k1": &testKey.PublicKey}}
+}
+
+func (k *testKeys) Key(t *jwt.Token) (interface{}, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	kid, _ := t.Header["kid"].(string)
+	key, ok := k.keys[kid]
+	if !ok {
+		return nil, errors.New("unknown kid")
+	}
+	return key, nil
+}
+
+func (k *testKeys) remove(kid string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	delete(k.keys, kid)
+}
+
+// sign returns an RS256 token with kid k1 over claims, with exp an hour
+// ahead unless claims sets it.
+func sign(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	if _, ok := claims["exp"]; !ok {
+		claims["exp"] = time.Now().Add(time.Hour).Unix()
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "k1"
+	tokenStr, err := token.SignedString(testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tokenStr
+}
+
+// serve runs a GET request with bearer token tokenStr through handlers
+// followed by a handler answering 200.
+func serve(tokenStr string, handlers ...gin.HandlerFunc) *httptest.ResponseRecorder {
+	return serveMethod(http.MethodGet, tokenStr, handlers...)
+}
+
+func serveMethod(method, tokenStr string, handlers ...gin.HandlerFunc) *httptest.ResponseRecorder {
+	r := gin.New()
+	r.Handle(method, "/", append(handlers, func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	})...)
+
+	req := httptest.NewRequest(method, "/", nil)
+	if tokenStr != "" {
+		req.Header.Set("Authorization", "Bearer "+tokenStr)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
@@ -0,0 +1,170 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type claimsKey struct{}
+
+// Verify is the net/http counterpart of VerifyTokenWithOptions. Claims are
+// decoded into a fresh T per request, so T is usually a pointer to a struct
+// embedding jwt.RegisteredClaims, or jwt.MapClaims. Options.Validator,
+// Options.RequiredClaims, Options.DPoP, Options.MTLSBound, Options.CSRFClaim,
+// Options.ClaimsTransform and Options.TokenCache only apply when T is
+// jwt.MapClaims. Options.Revocation applies to every T; other claims types
+// reach the checker re-encoded as jwt.MapClaims. Verify panics when T is
+// neither a pointer nor a map type. The Gin-only DryRun, ErrorHandler,
+// AuditLogger, OnAuthenticated and OnAuth* hooks are ignored; errors are
+// always written as JSON, encoded with Options.MarshalError when set.
+func Verify[T jwt.Claims](opts Options) func(http.Handler) http.Handler {
+
+	opts = resolveOptions(opts)
+
+	var zero T
+	_, mapClaims := any(zero).(jwt.MapClaims)
+	if claimsType := reflect.TypeOf(&zero).Elem(); claimsType.Kind() != reflect.Pointer && claimsType.Kind() != reflect.Map {
+		panic("[go-middle] Verify requires a pointer or map claims type, got " + claimsType.String())
+	}
+	if !mapClaims && opts.Validator != nil {
+		panic("[go-middle] Options.Validator requires jwt.MapClaims, implement jwt.ClaimsValidator on the claims type instead")
+	}
+	if !mapClaims && len(opts.RequiredClaims) > 0 {
+		panic("[go-middle] Options.RequiredClaims requires jwt.MapClaims")
+	}
+	if !mapClaims && opts.DPoP {
+		panic("[go-middle] Options.DPoP requires jwt.MapClaims")
+	}
+	if !mapClaims && opts.MTLSBound {
+		panic("[go-middle] Options.MTLSBound requires jwt.MapClaims")
+	}
+	if !mapClaims && opts.CSRFClaim != "" {
+		panic("[go-middle] Options.CSRFClaim requires jwt.MapClaims")
+	}
+	if !mapClaims && opts.LenientNumericDates {
+		panic("[go-middle] Options.LenientNumericDates requires jwt.MapClaims")
+	}
+	if !mapClaims && opts.ClaimPrecedence != PayloadOnly {
+		panic("[go-middle] Options.ClaimPrecedence requires jwt.MapClaims")
+	}
+	if !mapClaims && opts.ClaimsTransform != nil {
+		panic("[go-middle] Options.ClaimsTransform requires jwt.MapClaims")
+	}
+	if len(opts.AllowedCIDRs) > 0 {
+		panic("[go-middle] Options.AllowedCIDRs is only supported by VerifyTokenWithOptions")
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			if skipPath(r.URL.Path, opts) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			tokenStr, source, authErr := extractToken(r, opts)
+			if authErr == nil {
+				authErr = checkTransport(r, opts)
+			}
+			if authErr != nil {
+				writeError(w, opts, authErr)
+				return
+			}
+
+			if opts.StaleMode != StaleAllow && isStale(opts.Provider) {
+				if opts.StaleMode == StaleReject {
+					writeError(w, opts, ErrKeyStale)
+					return
+				}
+				w.Header().Set("X-Auth-Degraded", "true")
+			}
+
+			opts := methodOptions(r.Method, opts)
+
+			var claims T
+			if mapClaims {
+				validated, authErr := validate(r.Context(), tokenStr, opts)
+				if authErr == nil && opts.DPoP {
+					authErr = checkDPoP(r, tokenStr, validated, opts)
+				}
+				if authErr == nil && opts.MTLSBound {
+					authErr = checkMTLS(r, validated)
+				}
+				if authErr == nil && opts.CSRFClaim != "" && source == "cookie" {
+					authErr = checkCSRF(r, validated, opts)
+				}
+				if authErr == nil {
+					validated, authErr = transformClaims(validated, opts)
+				}
+				if authErr != nil {
+					writeError(w, opts, authErr)
+					return
+				}
+				claims = any(validated).(T)
+			} else {
+				claims = newClaims[T]()
+				if authErr := validateTyped(r.Context(), tokenStr, claims, opts); authErr != nil {
+					writeError(w, opts, authErr)
+					return
+				}
+			}
+
+			if opts.DebugHeaders {
+				subject, _ := claims.GetSubject()
+				var scopes []string
+				if m, ok := any(claims).(jwt.MapClaims); ok {
+					subject, scopes = subjectOf(m, opts), tokenScopes(m)
+				}
+				setDebugHeaders(w.Header(), subject, scopes)
+			}
+
+			ctx := context.WithValue(r.Context(), claimsKey{}, claims)
+			r = r.WithContext(ctx)
+			if opts.StripAuthHeader {
+				r.Header.Del("Authorization")
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func ClaimsFromContext[T jwt.Claims](ctx context.Context) (T, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(T)
+	return claims, ok
+}
+
+// newClaims allocates a T to decode into. Verify only accepts pointer and
+// map types.
+func newClaims[T jwt.Claims]() T {
+	var zero T
+	t := reflect.TypeOf(&zero).Elem()
+	if t.Kind() == reflect.Map {
+		return reflect.MakeMap(t).Interface().(T)
+	}
+	return reflect.New(t.Elem()).Interface().(T)
+}
+
+func writeError(w http.ResponseWriter, opts Options, err *AuthError) {
+	body := errorBody(err, opts.VerboseErrors)
+
+	marshal := json.Marshal
+	if opts.MarshalError != nil {
+		marshal = opts.MarshalError
+	}
+	raw, marshalErr := marshal(body)
+	if marshalErr != nil {
+		raw, _ = json.Marshal(body)
+	}
+
+	if errors.Is(err, ErrKeysNotReady) {
+		w.Header().Set("Retry-After", warmupRetryAfter)
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(err.Status)
+	_, _ = w.Write(raw)
+}
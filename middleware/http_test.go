@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func serveHTTP(handler func(http.Handler) http.Handler, tokenStr string) *httptest.ResponseRecorder {
+	h := handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if tokenStr != "" {
+		req.Header.Set("Authorization", "Bearer "+tokenStr)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func revokeJTI(jti string) RevocationFunc {
+	return func(ctx context.Context, claims jwt.MapClaims) (bool, error) {
+		return claims["jti"] == jti, nil
+	}
+}
+
+func TestVerifyMapClaims(t *testing.T) {
+	var got jwt.MapClaims
+	h := Verify[jwt.MapClaims](Options{Provider: newTestKeys()})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = ClaimsFromContext[jwt.MapClaims](r.Context())
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+sign(t, jwt.MapClaims{"sub": "alice"}))
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got["sub"] != "alice" {
+		t.Fatalf("claims = %v", got)
+	}
+}
+
+func TestVerifyMissingToken(t *testing.T) {
+	if w := serveHTTP(Verify[jwt.MapClaims](Options{Provider: newTestKeys()}), ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("status %d, want 401", w.Code)
+	}
+}
+
+func TestVerifyTypedClaimsRevocation(t *testing.T) {
+	verify := Verify[*jwt.RegisteredClaims](Options{Provider: newTestKeys(), Revocation: revokeJTI("revoked")})
+
+	if w := serveHTTP(verify, sign(t, jwt.MapClaims{"sub": "alice", "jti": "revoked"})); w.Code != http.StatusUnauthorized {
+		t.Fatalf("revoked token: status %d, want 401", w.Code)
+	}
+	if w := serveHTTP(verify, sign(t, jwt.MapClaims{"sub": "alice", "jti": "live"})); w.Code != http.StatusOK {
+		t.Fatalf("live token: status %d, want 200", w.Code)
+	}
+}
+
+func TestVerifyTypedClaimsValidationTimeout(t *testing.T) {
+	slow := RevocationFunc(func(ctx context.Context, claims jwt.MapClaims) (bool, error) {
+		<-ctx.Done()
+		return false, ctx.Err()
+	})
+	verify := Verify[*jwt.RegisteredClaims](Options{Provider: newTestKeys(), Revocation: slow, ValidationTimeout: 10 * time.Millisecond})
+
+	if w := serveHTTP(verify, sign(t, jwt.MapClaims{"sub": "alice"})); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status %d, want 503", w.Code)
+	}
+}
+
+func TestVerifyTypedClaimsRejectsMapOnlyOptions(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Verify did not panic")
+		}
+	}()
+	Verify[*jwt.RegisteredClaims](Options{Provider: newTestKeys(), RequiredClaims: []string{"email"}})
+}
+
+func TestVerifyRejectsValueClaimsTypes(t *testing.T) {
+	for name, build := range map[string]func(){
+		"struct":    func() { Verify[jwt.RegisteredClaims](Options{Provider: newTestKeys()}) },
+		"interface": func() { Verify[jwt.Claims](Options{Provider: newTestKeys()}) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: Verify did not panic", name)
+				}
+			}()
+			build()
+		}()
+	}
+}
+
+func TestVerifyGraceLeeway(t *testing.T) {
+	handler := Verify[jwt.MapClaims](Options{
+		Provider:     newTestKeys(),
+		GraceLeeway:  time.Minute,
+		GraceMethods: []string{http.MethodGet},
+	})
+	tokenStr := sign(t, jwt.MapClaims{"sub": "alice", "exp": ago(30 * time.Second)})
+
+	if w := serveHTTP(handler, tokenStr); w.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200", w.Code)
+	}
+}
+
+func TestVerifyStaleMode(t *testing.T) {
+	tokenStr := sign(t, jwt.MapClaims{"sub": "alice"})
+
+	for _, tc := range []struct {
+		name     string
+		mode     StaleMode
+		want     int
+		degraded bool
+	}{
+		{"allow", StaleAllow, http.StatusOK, false},
+		{"degrade", StaleDegrade, http.StatusOK, true},
+		{"reject", StaleReject, http.StatusServiceUnavailable, false},
+	} {
+		verify := Verify[*jwt.RegisteredClaims](Options{Provider: &staleKeys{newTestKeys(), true}, StaleMode: tc.mode})
+		w := serveHTTP(verify, tokenStr)
+
+		if w.Code != tc.want || (w.Header().Get("X-Auth-Degraded") == "true") != tc.degraded {
+			t.Errorf("%s: status %d, header %q", tc.name, w.Code, w.Header().Get("X-Auth-Degraded"))
+		}
+	}
+}
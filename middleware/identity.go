@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// InjectIdentityHeaders forwards verified claims to upstream services as
+// request headers, mapping claim name to header name. Client supplied copies
+// of those headers are always removed first so they cannot be spoofed. The
+// "sub" entry carries Subject, so it follows Options.SubjectClaim.
+func InjectIdentityHeaders(mapping map[string]string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, header := range mapping {
+			c.Request.Header.Del(header)
+		}
+
+		claims, authErr := claimsFrom(c)
+		if authErr != nil {
+			abort(c, authErr)
+			return
+		}
+
+		for claim, header := range mapping {
+			v := claimString(claims[claim])
+			if claim == "sub" {
+				if subject := Subject(c); subject != "" {
+					v = subject
+				}
+			}
+			if v != "" {
+				c.Request.Header.Set(header, v)
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// setDebugHeaders writes the Options.DebugHeaders response headers. Empty
+// values are left out.
+func setDebugHeaders(h http.Header, subject string, scopes []string) {
+	if subject != "" {
+		h.Set("X-Auth-Subject", subject)
+	}
+	if len(scopes) > 0 {
+		h.Set("X-Auth-Scopes", strings.Join(scopes, " "))
+	}
+}
+
+func claimString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []interface{}, []string:
+		return strings.Join(stringList(v), " ")
+	}
+	return fmt.Sprint(v)
+}
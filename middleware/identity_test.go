@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// upstreamHeaders runs a request carrying header through verify and
+// InjectIdentityHeaders, returning the headers the next handler sees.
+func upstreamHeaders(t *testing.T, opts Options, tokenStr string, header http.Header) http.Header {
+	t.Helper()
+	opts.Provider = newTestKeys()
+	var got http.Header
+	r := gin.New()
+	r.GET("/", VerifyTokenWithOptions(opts), InjectIdentityHeaders(map[string]string{
+		"sub":    "X-User-ID",
+		"email":  "X-User-Email",
+		"groups": "X-User-Groups",
+	}), func(c *gin.Context) {
+		got = c.Request.Header
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header = header
+	req.Header.Set("Authorization", "Bearer "+tokenStr)
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	return got
+}
+
+func TestInjectIdentityHeaders(t *testing.T) {
+	tokenStr := sign(t, jwt.MapClaims{"sub": "alice", "groups": []string{"dev", "ops"}})
+	got := upstreamHeaders(t, Options{}, tokenStr, http.Header{
+		"X-User-Id":    {"root"},
+		"X-User-Email": {"root@example.com"},
+	})
+
+	if got.Get("X-User-ID") != "alice" || got.Get("X-User-Groups") != "dev ops" {
+		t.Errorf("headers = %v", got)
+	}
+	if v, ok := got["X-User-Email"]; ok {
+		t.Errorf("spoofed X-User-Email = %q kept", v)
+	}
+}
+
+func TestInjectIdentityHeadersSubjectClaim(t *testing.T) {
+	tokenStr := sign(t, jwt.MapClaims{"sub": "pairwise-123", "uid": "user-1"})
+	got := upstreamHeaders(t, Options{SubjectClaim: "uid"}, tokenStr, http.Header{})
+
+	if got.Get("X-User-ID") != "user-1" {
+		t.Fatalf("X-User-ID = %q, want user-1", got.Get("X-User-ID"))
+	}
+}
+
+func TestInjectIdentityHeadersWithoutClaims(t *testing.T) {
+	if w := serve("", InjectIdentityHeaders(map[string]string{"sub": "X-User-ID"})); w.Code != ErrMissingClaims.Status {
+		t.Fatalf("status %d, want %d", w.Code, ErrMissingClaims.Status)
+	}
+}
+
+func TestDebugHeaders(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) })
+	handlers := func(opts Options) map[string]http.Handler {
+		opts.Provider = newTestKeys()
+		r := gin.New()
+		r.GET("/", VerifyTokenWithOptions(opts), func(c *gin.Context) { c.Status(http.StatusOK) })
+		return map[string]http.Handler{
+			"gin":   r,
+			"map":   Verify[jwt.MapClaims](opts)(ok),
+			"typed": Verify[*jwt.RegisteredClaims](opts)(ok),
+		}
+	}
+	tokenStr := sign(t, jwt.MapClaims{"sub": "alice", "uid": "u-1", "scope": "read write"})
+
+	for _, tc := range []struct {
+		name         string
+		opts         Options
+		token        string
+		subject      string
+		scopes       string
+		typedSubject string
+	}{
+		{"disabled", Options{}, tokenStr, "", "", ""},
+		{"enabled", Options{DebugHeaders: true}, tokenStr, "alice", "read write", "alice"},
+		{"subject claim", Options{DebugHeaders: true, SubjectClaim: "uid"}, tokenStr, "u-1", "read write", "alice"},
+		{"no scopes", Options{DebugHeaders: true}, sign(t, jwt.MapClaims{"sub": "alice"}), "alice", "", "alice"},
+		{"rejected", Options{DebugHeaders: true}, "not-a-token", "", "", ""},
+	} {
+		for name, h := range handlers(tc.opts) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			subject, scopes := tc.subject, tc.scopes
+			if name == "typed" {
+				subject, scopes = tc.typedSubject, ""
+			}
+			if got := w.Header().Get("X-Auth-Subject"); got != subject {
+				t.Errorf("%s %s: X-Auth-Subject = %q, want %q", name, tc.name, got, subject)
+			}
+			if got := w.Header().Get("X-Auth-Scopes"); got != scopes {
+				t.Errorf("%s %s: X-Auth-Scopes = %q, want %q", name, tc.name, got, scopes)
+			}
+		}
+	}
+}
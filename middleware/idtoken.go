@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ValidateIDToken validates an OpenID Connect ID token for login flows. On
+// top of Validate it requires opts.Issuer and opts.Audience (the client_id),
+// exp and iat, an azp that is one of opts.Audience when the token has several
+// audiences, and a nonce claim equal to expectedNonce, the nonce sent in the
+// authentication request. An empty expectedNonce only accepts tokens without
+// nonce.
+func ValidateIDToken(ctx context.Context, tokenStr, expectedNonce string, opts Options) (jwt.MapClaims, error) {
+	if opts.Issuer == "" || len(opts.Audience) == 0 {
+		return nil, errors.New("ValidateIDToken requires Options.Issuer and Options.Audience")
+	}
+	n := len(opts.ParserOptions)
+	opts.ParserOptions = append(opts.ParserOptions[:n:n], jwt.WithExpirationRequired(), jwt.WithIssuedAt())
+
+	claims, err := Validate(ctx, tokenStr, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if iat, _ := claims.GetIssuedAt(); iat == nil {
+		return nil, ErrMissingIssuedAt
+	}
+	if aud, _ := claims.GetAudience(); len(aud) > 1 && !containsAny([]string{claimString(claims["azp"])}, opts.Audience) {
+		return nil, ErrInvalidAudience.wrap(errors.New("azp is not the client_id"))
+	}
+
+	nonce, _ := claims["nonce"].(string)
+	if subtle.ConstantTimeCompare([]byte(nonce), []byte(expectedNonce)) != 1 {
+		return nil, ErrNonceMismatch
+	}
+	return claims, nil
+}
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestValidateIDToken(t *testing.T) {
+	const issuer = "https://idp.example.com"
+	opts := Options{Provider: newTestKeys(), Issuer: issuer, Audience: []string{"client-1"}}
+	idToken := func(edit jwt.MapClaims) string {
+		claims := jwt.MapClaims{"iss": issuer, "aud": "client-1", "sub": "alice", "iat": ago(time.Minute), "nonce": "n-0S6"}
+		for k, v := range edit {
+			if v == nil {
+				delete(claims, k)
+			} else {
+				claims[k] = v
+			}
+		}
+		return sign(t, claims)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		token string
+		nonce string
+		want  *AuthError
+	}{
+		{"matching nonce", idToken(nil), "n-0S6", nil},
+		{"mismatched nonce", idToken(nil), "n-other", ErrNonceMismatch},
+		{"missing nonce", idToken(jwt.MapClaims{"nonce": nil}), "n-0S6", ErrNonceMismatch},
+		{"no nonce expected", idToken(jwt.MapClaims{"nonce": nil}), "", nil},
+		{"unexpected nonce", idToken(nil), "", ErrNonceMismatch},
+		{"wrong issuer", idToken(jwt.MapClaims{"iss": "https://evil.example.com"}), "n-0S6", ErrInvalidIssuer},
+		{"other client", idToken(jwt.MapClaims{"aud": "client-2"}), "n-0S6", ErrInvalidAudience},
+		{"missing iat", idToken(jwt.MapClaims{"iat": nil}), "n-0S6", ErrMissingIssuedAt},
+		{"several audiences with azp", idToken(jwt.MapClaims{"aud": []string{"client-1", "api"}, "azp": "client-1"}), "n-0S6", nil},
+		{"several audiences without azp", idToken(jwt.MapClaims{"aud": []string{"client-1", "api"}}), "n-0S6", ErrInvalidAudience},
+		{"azp of another client", idToken(jwt.MapClaims{"aud": []string{"client-1", "api"}, "azp": "api"}), "n-0S6", ErrInvalidAudience},
+		{"expired", idToken(jwt.MapClaims{"exp": ago(time.Minute)}), "n-0S6", ErrTokenExpired},
+	} {
+		claims, err := ValidateIDToken(context.Background(), tc.token, tc.nonce, opts)
+		switch {
+		case tc.want == nil && (err != nil || claims["sub"] != "alice"):
+			t.Errorf("%s: claims = %v, err = %v", tc.name, claims, err)
+		case tc.want != nil && !errors.Is(err, tc.want):
+			t.Errorf("%s: err = %v, want %s", tc.name, err, tc.want.Code)
+		}
+	}
+}
+
+func TestValidateIDTokenRequiresIssuerAndAudience(t *testing.T) {
+	tokenStr := sign(t, jwt.MapClaims{"sub": "alice", "iat": ago(time.Minute)})
+	for name, opts := range map[string]Options{
+		"no issuer":   {Provider: newTestKeys(), Audience: []string{"client-1"}},
+		"no audience": {Provider: newTestKeys(), Issuer: "https://idp.example.com"},
+	} {
+		if _, err := ValidateIDToken(context.Background(), tokenStr, "", opts); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type IntrospectionOptions struct {
+	// URL is the RFC 7662 introspection endpoint.
+	URL string
+	// ClientID and ClientSecret authenticate to the endpoint with HTTP Basic.
+	ClientID     string
+	ClientSecret string
+	// HTTPClient defaults to a client with a 10 second timeout.
+	HTTPClient *http.Client
+
+	// TokenCache stores active introspection results until the token exp, or
+	// CacheTTL when shorter. Defaults to a MemoryCache; results without exp
+	// are only cached when CacheTTL is set.
+	TokenCache TokenCache
+	CacheTTL   time.Duration
+
+	// Breaker stops calling a failing endpoint for a while. There are no
+	// claims without a response, so failures always reject the request.
+	Breaker *CircuitBreaker
+
+	// ContextPrefix namespaces the context keys, see Options.ContextPrefix.
+	ContextPrefix string
+
+	// TokenLookup, ErrorHandler and MarshalError work as in Options.
+	TokenLookup  string
+	ErrorHandler func(c *gin.Context, err error)
+	MarshalError func(v any) ([]byte, error)
+}
+
+// VerifyIntrospection validates opaque access tokens by POSTing them to the
+// introspection endpoint. Active tokens have the response members stored as
+// jwt.MapClaims under the same "claims" key as VerifyToken, so the Require*
+// middlewares work unchanged.
+func VerifyIntrospection(opts IntrospectionOptions) gin.HandlerFunc {
+	if opts.URL == "" {
+		panic("[go-middle] IntrospectionOptions.URL is required")
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	if opts.TokenCache == nil {
+		opts.TokenCache = NewMemoryCache(0)
+	}
+	// failOpts carries the options shared with VerifyToken to extractToken
+	// and fail.
+	failOpts := Options{ErrorHandler: opts.ErrorHandler, MarshalError: opts.MarshalError}
+	if opts.TokenLookup != "" {
+		sources, err := parseTokenLookup(opts.TokenLookup)
+		if err != nil {
+			panic("[go-middle] " + err.Error())
+		}
+		failOpts.tokenLookup = sources
+	}
+
+	return func(c *gin.Context) {
+		tokenStr, _, authErr := extractToken(c.Request, failOpts)
+		if authErr != nil {
+			fail(c, failOpts, authErr)
+			return
+		}
+
+		claims, authErr := introspect(c, tokenStr, opts)
+		if authErr != nil {
+			fail(c, failOpts, authErr)
+			return
+		}
+
+		setValue(c, opts.ContextPrefix, "claims", claims)
+		setValue(c, opts.ContextPrefix, "subject", claimString(claims["sub"]))
+		c.Next()
+	}
+}
+
+func introspect(c *gin.Context, tokenStr string, opts IntrospectionOptions) (jwt.MapClaims, *AuthError) {
+	ctx := c.Request.Context()
+	key := introspectionCacheKey(tokenStr, opts)
+	if claims, ok, err := opts.TokenCache.Get(ctx, key); err == nil && ok {
+		return claims, nil
+	}
+
+	var claims jwt.MapClaims
+	err := opts.Breaker.do(func() (err error) {
+		claims, err = postIntrospection(c, tokenStr, opts)
+		return err
+	})
+	if err != nil || claims == nil {
+		if err == nil {
+			err = errors.New("introspection failed")
+		}
+		return nil, ErrIntrospectionFailed.wrap(err)
+	}
+
+	if active, _ := claims["active"].(bool); !active {
+		return nil, ErrTokenInactive
+	}
+
+	if ttl := cacheTTL(claims, Options{CacheTTL: opts.CacheTTL}); ttl > 0 {
+		_ = opts.TokenCache.Set(ctx, key, claims, ttl)
+	}
+	return claims, nil
+}
+
+// introspectionCacheKey scopes entries to the endpoint, like cacheKey does
+// for verifying options, so a cache shared with VerifyToken or another
+// endpoint never mixes results.
+func introspectionCacheKey(tokenStr string, opts IntrospectionOptions) string {
+	sum := sha256.Sum256([]byte("introspection " + opts.URL))
+	return CacheKey(tokenStr) + ":" + hex.EncodeToString(sum[:8])
+}
+
+func postIntrospection(c *gin.Context, tokenStr string, opts IntrospectionOptions) (jwt.MapClaims, error) {
+	form := url.Values{"token": {tokenStr}, "token_type_hint": {"access_token"}}
+	req, err := http.NewRequestWithContext(c.Request.Context(), http.MethodPost, opts.URL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if opts.ClientID != "" {
+		req.SetBasicAuth(url.QueryEscape(opts.ClientID), url.QueryEscape(opts.ClientSecret))
+	}
+
+	resp, err := opts.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("introspection endpoint returned %d", resp.StatusCode)
+	}
+
+	claims := jwt.MapClaims{}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
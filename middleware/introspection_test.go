@@ -0,0 +1,161 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// introspectionServer answers RFC 7662 requests with the response for the
+// posted token, counting the calls.
+func introspectionServer(t *testing.T, responses map[string]map[string]any) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if user, pass, ok := r.BasicAuth(); !ok || user != "api" || pass != "s%3Acret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.PostFormValue("token_type_hint") != "access_token" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		resp, ok := responses[r.PostFormValue("token")]
+		if !ok {
+			resp = map[string]any{"active": false}
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func TestVerifyIntrospection(t *testing.T) {
+	srv, _ := introspectionServer(t, map[string]map[string]any{
+		"opaque-1": {"active": true, "sub": "alice", "scope": "read write", "exp": in(time.Hour)},
+	})
+	verify := VerifyIntrospection(IntrospectionOptions{URL: srv.URL, ClientID: "api", ClientSecret: "s:cret"})
+
+	for _, tc := range []struct {
+		name     string
+		tokenStr string
+		want     int
+	}{
+		{"active", "opaque-1", http.StatusOK},
+		{"inactive", "opaque-2", http.StatusUnauthorized},
+		{"missing", "", http.StatusUnauthorized},
+	} {
+		var subject string
+		w := serve(tc.tokenStr, verify, RequireScopes("read"), func(c *gin.Context) { subject = Subject(c) })
+		if w.Code != tc.want || tc.want == http.StatusOK && subject != "alice" {
+			t.Errorf("%s: status %d, subject %q", tc.name, w.Code, subject)
+		}
+	}
+}
+
+func TestIntrospectionCache(t *testing.T) {
+	srv, calls := introspectionServer(t, map[string]map[string]any{
+		"with-exp":    {"active": true, "sub": "alice", "exp": in(time.Hour)},
+		"without-exp": {"active": true, "sub": "bob"},
+	})
+	verify := VerifyIntrospection(IntrospectionOptions{URL: srv.URL, ClientID: "api", ClientSecret: "s:cret"})
+
+	for range 3 {
+		serve("with-exp", verify)
+		serve("without-exp", verify)
+	}
+	if got := calls.Load(); got != 4 {
+		t.Fatalf("%d introspection calls, want 1 for the token with exp and 3 without", got)
+	}
+}
+
+func TestIntrospectionCacheScopedToURL(t *testing.T) {
+	active, _ := introspectionServer(t, map[string]map[string]any{"opaque": {"active": true, "exp": in(time.Hour)}})
+	inactive, _ := introspectionServer(t, nil)
+	cache := NewMemoryCache(0)
+
+	serve("opaque", VerifyIntrospection(IntrospectionOptions{URL: active.URL, ClientID: "api", ClientSecret: "s:cret", TokenCache: cache}))
+	w := serve("opaque", VerifyIntrospection(IntrospectionOptions{URL: inactive.URL, ClientID: "api", ClientSecret: "s:cret", TokenCache: cache}))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status %d: result cached for another endpoint", w.Code)
+	}
+}
+
+func TestIntrospectionFailure(t *testing.T) {
+	srv, calls := introspectionServer(t, nil)
+	verify := VerifyIntrospection(IntrospectionOptions{
+		URL:     srv.URL,
+		Breaker: NewCircuitBreaker(BreakerOptions{Policy: FailOpen, Threshold: 2, Cooldown: time.Hour}),
+	})
+
+	// Without client credentials the endpoint answers 401.
+	for range 3 {
+		if w := serve("opaque", verify); w.Code != http.StatusServiceUnavailable {
+			t.Fatalf("status %d, want 503 even with FailOpen", w.Code)
+		}
+	}
+	if got := calls.Load(); got != 2 {
+		t.Fatalf("%d calls, want the breaker to stop after 2", got)
+	}
+}
+
+func TestIntrospectionSharedOptions(t *testing.T) {
+	srv, _ := introspectionServer(t, map[string]map[string]any{
+		"opaque-1": {"active": true, "sub": "alice", "exp": in(time.Hour)},
+	})
+	verify := VerifyIntrospection(IntrospectionOptions{
+		URL:          srv.URL,
+		ClientID:     "api",
+		ClientSecret: "s:cret",
+		TokenLookup:  "cookie:access_token",
+		ErrorHandler: func(c *gin.Context, err error) {
+			c.String(http.StatusTeapot, asAuthError(err).Code)
+		},
+	})
+	r := gin.New()
+	r.GET("/", verify, func(c *gin.Context) { c.String(http.StatusOK, Subject(c)) })
+
+	for _, tc := range []struct {
+		name   string
+		cookie string
+		want   int
+		body   string
+	}{
+		{"cookie", "opaque-1", http.StatusOK, "alice"},
+		{"inactive", "opaque-2", http.StatusTeapot, ErrTokenInactive.Code},
+		{"missing", "", http.StatusTeapot, ErrMissingAuthorization.Code},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tc.cookie != "" {
+			req.AddCookie(&http.Cookie{Name: "access_token", Value: tc.cookie})
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tc.want || w.Body.String() != tc.body {
+			t.Errorf("%s: status %d, body %q", tc.name, w.Code, w.Body.String())
+		}
+	}
+
+	marshaled := VerifyIntrospection(IntrospectionOptions{
+		URL:          srv.URL,
+		MarshalError: func(v any) ([]byte, error) { return []byte(`{"custom":true}`), nil },
+	})
+	if w := serve("", marshaled); w.Code != http.StatusUnauthorized || w.Body.String() != `{"custom":true}` {
+		t.Fatalf("status %d, body %q, want the MarshalError body", w.Code, w.Body.String())
+	}
+}
+
+func TestVerifyIntrospectionRequiresURL(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("missing URL accepted")
+		}
+	}()
+	VerifyIntrospection(IntrospectionOptions{})
+}
@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/digitcodestudiotech/go-middle/crypto"
+	"github.com/gin-gonic/gin"
+)
+
+// Authenticator pairs the verification middleware with its key provider
+// for DI containers such as Uber Fx or dig:
+//
+//	fx.Provide(func(lc fx.Lifecycle) (*middleware.Authenticator, error) {
+//		auth, err := middleware.NewAuthenticator(middleware.Options{})
+//		if err == nil {
+//			lc.Append(fx.Hook{OnStart: auth.Start, OnStop: auth.Stop})
+//		}
+//		return auth, err
+//	})
+type Authenticator struct {
+	opts    Options
+	handler gin.HandlerFunc
+	owned   bool
+}
+
+// NewAuthenticator builds the middleware of VerifyTokenWithOptions, but
+// returns configuration errors instead of panicking and does no network
+// I/O: without opts.Provider the key from PublicKeyURL is fetched in the
+// background, or by Start, by a provider of its own rather than the one
+// shared by VerifyToken.
+func NewAuthenticator(opts Options) (*Authenticator, error) {
+	owned := opts.Provider == nil
+	opts.dedicatedKey = true
+	opts, err := prepareOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Authenticator{opts: opts, handler: verifyHandler(opts), owned: owned}, nil
+}
+
+func (a *Authenticator) Handler() gin.HandlerFunc {
+	return a.handler
+}
+
+func (a *Authenticator) Provider() crypto.KeyProvider {
+	return a.opts.Provider
+}
+
+// Start preloads the keys when the provider implements crypto.Lifecycle,
+// and returns the fetch error so that a missing key aborts startup.
+func (a *Authenticator) Start(ctx context.Context) error {
+	if lc, ok := a.opts.Provider.(crypto.Lifecycle); ok {
+		return lc.Start(ctx)
+	}
+	return nil
+}
+
+// Stop stops the refresh loop of the provider created by NewAuthenticator.
+// A provider passed in Options belongs to the caller and is left running.
+func (a *Authenticator) Stop(ctx context.Context) error {
+	if lc, ok := a.opts.Provider.(crypto.Lifecycle); ok && a.owned {
+		return lc.Stop(ctx)
+	}
+	return nil
+}
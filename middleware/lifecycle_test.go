@@ -0,0 +1,114 @@
+package middleware
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// pemServer serves the public half of testKey, counting requests, and
+// fails with 503 while down is set.
+func pemServer(t *testing.T) (url string, requests *atomic.Int32, down *atomic.Bool) {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(&testKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	requests, down = &atomic.Int32{}, &atomic.Bool{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL, requests, down
+}
+
+func TestAuthenticator(t *testing.T) {
+	url, _, _ := pemServer(t)
+	auth, err := NewAuthenticator(Options{PublicKeyURL: url, RefreshEvery: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer auth.Stop(context.Background())
+
+	if err := auth.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if w := serve(sign(t, jwt.MapClaims{"sub": "alice"}), auth.Handler()); w.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200", w.Code)
+	}
+}
+
+func TestAuthenticatorStartFails(t *testing.T) {
+	url, _, down := pemServer(t)
+	down.Store(true)
+	auth, err := NewAuthenticator(Options{PublicKeyURL: url, RefreshEvery: time.Hour})
+	if err != nil {
+		t.Fatalf("constructor failed on an unreachable key: %v", err)
+	}
+	defer auth.Stop(context.Background())
+
+	if err := auth.Start(context.Background()); err == nil {
+		t.Fatal("Start succeeded without a key")
+	}
+}
+
+func TestAuthenticatorConfigError(t *testing.T) {
+	if _, err := NewAuthenticator(Options{Provider: newTestKeys(), AllowedCIDRs: []string{"10.0.0.0/33"}}); err == nil {
+		t.Fatal("invalid options accepted")
+	}
+	if _, err := NewAuthenticator(Options{}); err == nil {
+		t.Fatal("missing key source accepted")
+	}
+}
+
+func TestAuthenticatorStopsOwnedProvider(t *testing.T) {
+	url, requests, _ := pemServer(t)
+	auth, err := NewAuthenticator(Options{PublicKeyURL: url, RefreshEvery: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := auth.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	stopped := requests.Load()
+	time.Sleep(50 * time.Millisecond)
+	if n := requests.Load(); n != stopped {
+		t.Fatalf("refreshed %d times after Stop", n-stopped)
+	}
+}
+
+// lifecycleKeys records the lifecycle calls it receives.
+type lifecycleKeys struct {
+	*testKeys
+	started, stopped bool
+}
+
+func (k *lifecycleKeys) Start(context.Context) error { k.started = true; return nil }
+func (k *lifecycleKeys) Stop(context.Context) error  { k.stopped = true; return nil }
+
+func TestAuthenticatorLeavesCallerProvider(t *testing.T) {
+	keys := &lifecycleKeys{testKeys: newTestKeys()}
+	auth, err := NewAuthenticator(Options{Provider: keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = auth.Start(context.Background())
+	_ = auth.Stop(context.Background())
+	if !keys.started || keys.stopped {
+		t.Fatalf("started = %v, stopped = %v, want only started", keys.started, keys.stopped)
+	}
+}
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+type tokenSource struct {
+	kind string
+	name string
+}
+
+// parseTokenLookup parses a TokenLookup value such as
+// "header:Authorization,cookie:access_token,query:token".
+func parseTokenLookup(spec string) ([]tokenSource, error) {
+	var sources []tokenSource
+	for _, part := range strings.Split(spec, ",") {
+		kind, name, ok := strings.Cut(strings.TrimSpace(part), ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || kind != "header" && kind != "cookie" && kind != "query" {
+			return nil, errors.New("invalid TokenLookup source: " + part)
+		}
+		sources = append(sources, tokenSource{kind: kind, name: name})
+	}
+	return sources, nil
+}
+
+// extractToken returns the token from the first lookup source that has a
+// value, and the kind of that source. The Authorization header must use the
+// Bearer (or DPoP) scheme; other sources carry the raw token.
+func extractToken(r *http.Request, opts Options) (string, string, *AuthError) {
+	if len(opts.tokenLookup) == 0 {
+		tokenStr, authErr := bearerToken(r.Header.Get("Authorization"), opts)
+		return tokenStr, "header", authErr
+	}
+
+	for _, src := range opts.tokenLookup {
+		switch src.kind {
+		case "header":
+			v := r.Header.Get(src.name)
+			if v == "" {
+				continue
+			}
+			if strings.EqualFold(src.name, "Authorization") {
+				tokenStr, authErr := bearerToken(v, opts)
+				return tokenStr, src.kind, authErr
+			}
+			return v, src.kind, nil
+		case "cookie":
+			if cookie, err := r.Cookie(src.name); err == nil && cookie.Value != "" {
+				return cookie.Value, src.kind, nil
+			}
+		case "query":
+			if v := r.URL.Query().Get(src.name); v != "" {
+				return v, src.kind, nil
+			}
+		}
+	}
+	return "", "", ErrMissingAuthorization
+}
@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestParseTokenLookup(t *testing.T) {
+	sources, err := parseTokenLookup("header:Authorization, cookie: access_token ,query:token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []tokenSource{{"header", "Authorization"}, {"cookie", "access_token"}, {"query", "token"}}
+	if len(sources) != len(want) {
+		t.Fatalf("sources = %v", sources)
+	}
+	for i := range want {
+		if sources[i] != want[i] {
+			t.Errorf("source %d = %v, want %v", i, sources[i], want[i])
+		}
+	}
+
+	for _, spec := range []string{"", "header", "header:", "form:token", "cookie:a,,query:b"} {
+		if _, err := parseTokenLookup(spec); err == nil {
+			t.Errorf("%q accepted", spec)
+		}
+	}
+}
+
+func TestExtractToken(t *testing.T) {
+	sources, _ := parseTokenLookup("header:Authorization,header:X-Token,cookie:access_token,query:token")
+	opts := Options{tokenLookup: sources}
+
+	for _, tc := range []struct {
+		name   string
+		setup  func(r *http.Request)
+		token  string
+		source string
+		err    *AuthError
+	}{
+		{"bearer header", func(r *http.Request) { r.Header.Set("Authorization", "Bearer a") }, "a", "header", nil},
+		{"raw header", func(r *http.Request) { r.Header.Set("X-Token", "b") }, "b", "header", nil},
+		{"cookie", func(r *http.Request) { r.AddCookie(&http.Cookie{Name: "access_token", Value: "c"}) }, "c", "cookie", nil},
+		{"query", func(r *http.Request) { r.URL.RawQuery = "token=d" }, "d", "query", nil},
+		{"first source wins", func(r *http.Request) {
+			r.Header.Set("X-Token", "b")
+			r.URL.RawQuery = "token=d"
+		}, "b", "header", nil},
+		{"invalid first source", func(r *http.Request) {
+			r.Header.Set("Authorization", "Basic a")
+			r.URL.RawQuery = "token=d"
+		}, "", "header", ErrInvalidFormat},
+		{"empty cookie", func(r *http.Request) { r.AddCookie(&http.Cookie{Name: "access_token", Value: ""}) }, "", "", ErrMissingAuthorization},
+		{"none", func(*http.Request) {}, "", "", ErrMissingAuthorization},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		tc.setup(r)
+		token, source, err := extractToken(r, opts)
+		if token != tc.token || source != tc.source || err != tc.err {
+			t.Errorf("%s: got %q from %q, err %v", tc.name, token, source, err)
+		}
+	}
+}
+
+func TestTokenLookupCookie(t *testing.T) {
+	r := gin.New()
+	r.GET("/", VerifyTokenWithOptions(Options{Provider: newTestKeys(), TokenLookup: "header:Authorization,cookie:access_token"}), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: "access_token", Value: sign(t, jwt.MapClaims{"sub": "alice"})})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, body %s", w.Code, w.Body)
+	}
+}
+
+func TestInvalidTokenLookupPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("invalid TokenLookup accepted")
+		}
+	}()
+	VerifyTokenWithOptions(Options{Provider: newTestKeys(), TokenLookup: "form:token"})
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"net/http"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// checkMTLS verifies a certificate-bound access token of RFC 8705: the token
+// cnf.x5t#S256 must equal the SHA-256 thumbprint of the client certificate
+// presented on the TLS connection.
+func checkMTLS(r *http.Request, claims jwt.MapClaims) *AuthError {
+	return checkCertBinding(r.TLS, claims)
+}
+
+// CheckCertificateBinding is the Options.MTLSBound check for transports
+// other than net/http, e.g. with the TLS state of a gRPC peer. state is nil
+// without TLS. The error is ErrTokenNotCertBound or ErrCertBindingMismatch.
+func CheckCertificateBinding(state *tls.ConnectionState, claims jwt.MapClaims) error {
+	if err := checkCertBinding(state, claims); err != nil {
+		return err
+	}
+	return nil
+}
+
+func checkCertBinding(state *tls.ConnectionState, claims jwt.MapClaims) *AuthError {
+	cnf, _ := claims["cnf"].(map[string]interface{})
+	x5t, _ := cnf["x5t#S256"].(string)
+	if x5t == "" {
+		return ErrTokenNotCertBound
+	}
+
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return ErrCertBindingMismatch.wrap(errors.New("no client certificate presented"))
+	}
+
+	sum := sha256.Sum256(state.PeerCertificates[0].Raw)
+	thumbprint := base64.RawURLEncoding.EncodeToString(sum[:])
+	if subtle.ConstantTimeCompare([]byte(thumbprint), []byte(x5t)) != 1 {
+		return ErrCertBindingMismatch
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestCheckMTLS(t *testing.T) {
+	cert := &x509.Certificate{Raw: []byte("client certificate DER")}
+	sum := sha256.Sum256(cert.Raw)
+	bound := jwt.MapClaims{"cnf": map[string]interface{}{"x5t#S256": base64.RawURLEncoding.EncodeToString(sum[:])}}
+
+	withCert := func(certs ...*x509.Certificate) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "https://api.example.com/", nil)
+		r.TLS = &tls.ConnectionState{PeerCertificates: certs}
+		return r
+	}
+
+	for _, tc := range []struct {
+		name   string
+		r      *http.Request
+		claims jwt.MapClaims
+		want   *AuthError
+	}{
+		{"bound", withCert(cert), bound, nil},
+		{"not bound", withCert(cert), jwt.MapClaims{}, ErrTokenNotCertBound},
+		{"other certificate", withCert(&x509.Certificate{Raw: []byte("other")}), bound, ErrCertBindingMismatch},
+		{"no certificate", withCert(), bound, ErrCertBindingMismatch},
+		{"plain HTTP", httptest.NewRequest(http.MethodGet, "/", nil), bound, ErrCertBindingMismatch},
+	} {
+		err := checkMTLS(tc.r, tc.claims)
+		if tc.want == nil && err != nil || tc.want != nil && !errors.Is(err, tc.want) {
+			t.Errorf("%s: err = %v, want %v", tc.name, err, tc.want)
+		}
+	}
+}
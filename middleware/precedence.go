@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ClaimPrecedence decides how claims replicated as JWS header parameters
+// (RFC 7519 section 5.3) combine with the payload. Header parameters
+// registered by RFC 7515 and RFC 7797, such as alg, kid or b64, are never
+// treated as claims.
+type ClaimPrecedence int
+
+const (
+	// PayloadOnly ignores header parameters, so only payload claims count.
+	PayloadOnly ClaimPrecedence = iota
+	// PayloadWins adds header claims missing from the payload and keeps the
+	// payload value when both carry a claim.
+	PayloadWins
+	// HeaderWins adds header claims and replaces payload values with them.
+	HeaderWins
+	// RejectConflicting adds header claims missing from the payload and
+	// rejects the token with ErrClaimConflict when both carry a claim with
+	// different values.
+	RejectConflicting
+)
+
+// mergeHeaderClaims applies opts.ClaimPrecedence to claims, before the
+// registered claims are validated, so that exp, iss and aud are checked on
+// the values every later step reads. Only jwt.MapClaims can be merged.
+func mergeHeaderClaims(header map[string]interface{}, claims jwt.Claims, opts Options) *AuthError {
+	m, ok := claims.(jwt.MapClaims)
+	if opts.ClaimPrecedence == PayloadOnly || !ok {
+		return nil
+	}
+
+	for name, v := range header {
+		if registeredHeaders[name] || name == "b64" {
+			continue
+		}
+		current, collides := m[name]
+		switch {
+		case !collides:
+			m[name] = v
+		case opts.ClaimPrecedence == HeaderWins:
+			m[name] = v
+		case opts.ClaimPrecedence == RejectConflicting && !reflect.DeepEqual(current, v):
+			return ErrClaimConflict.wrap(errors.New("header and payload disagree on " + strconv.Quote(name)))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestClaimPrecedence(t *testing.T) {
+	const issuer = "https://idp.example.com"
+	header := map[string]any{"sub": "mallory", "iss": issuer}
+
+	for _, tc := range []struct {
+		name       string
+		precedence ClaimPrecedence
+		header     map[string]any
+		sub, iss   any
+		want       *AuthError
+	}{
+		{"payload only", PayloadOnly, header, "alice", nil, nil},
+		{"payload wins", PayloadWins, header, "alice", issuer, nil},
+		{"header wins", HeaderWins, header, "mallory", issuer, nil},
+		{"conflict rejected", RejectConflicting, header, nil, nil, ErrClaimConflict},
+		{"agreeing header", RejectConflicting, map[string]any{"sub": "alice", "iss": issuer}, "alice", issuer, nil},
+	} {
+		claims, err := Validate(context.Background(), signHeader(t, tc.header), Options{Provider: newTestKeys(), ClaimPrecedence: tc.precedence})
+		switch {
+		case tc.want != nil:
+			if !errors.Is(err, tc.want) {
+				t.Errorf("%s: err = %v, want %s", tc.name, err, tc.want.Code)
+			}
+		case err != nil:
+			t.Errorf("%s: %v", tc.name, err)
+		case claims["sub"] != tc.sub || claims["iss"] != tc.iss:
+			t.Errorf("%s: sub = %v, iss = %v, want %v, %v", tc.name, claims["sub"], claims["iss"], tc.sub, tc.iss)
+		case claims["kid"] != nil || claims["alg"] != nil:
+			t.Errorf("%s: registered header parameters merged: %v", tc.name, claims)
+		}
+	}
+}
+
+func TestClaimPrecedenceValidatesMergedClaims(t *testing.T) {
+	opts := Options{Provider: newTestKeys(), ClaimPrecedence: HeaderWins, Issuer: "https://idp.example.com"}
+	expectErr(t, "header iss", signHeader(t, map[string]any{"iss": "https://idp.example.com"}), opts, nil)
+	expectErr(t, "wrong header iss", signHeader(t, map[string]any{"iss": "https://evil.example.com"}), opts, ErrInvalidIssuer)
+	expectErr(t, "expired in header", signHeader(t, map[string]any{"iss": "https://idp.example.com", "exp": ago(time.Hour)}), opts, ErrTokenExpired)
+}
+
+func TestClaimPrecedenceRequiresMapClaims(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("ClaimPrecedence accepted for typed claims")
+		}
+	}()
+	Verify[*jwt.RegisteredClaims](Options{Provider: newTestKeys(), ClaimPrecedence: HeaderWins})
+}
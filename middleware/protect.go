@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Protect mounts token verification on group, followed by the scope and role
+// requirements configured in opts. Paths skipped by SkipPaths or PreValidate
+// skip the requirements too. Unlike VerifyTokenWithOptions it returns
+// configuration errors instead of panicking.
+func Protect(group *gin.RouterGroup, opts Options) error {
+	for _, s := range append(append([]string{}, opts.RequiredScopes...), opts.RequiredRoles...) {
+		if s == "" {
+			return errors.New("[go-middle] empty scope or role requirement")
+		}
+	}
+
+	opts, err := prepareOptions(opts)
+	if err != nil {
+		return errors.New("[go-middle] " + err.Error())
+	}
+
+	handlers := []gin.HandlerFunc{verifyHandler(opts)}
+	if len(opts.RequiredScopes) > 0 {
+		handlers = append(handlers, unlessSkipped(RequireScopes(opts.RequiredScopes...)))
+	}
+	if len(opts.RequiredRoles) > 0 {
+		handlers = append(handlers, unlessSkipped(RequireRoles(opts.RequiredRoles...)))
+	}
+
+	group.Use(handlers...)
+	return nil
+}
+
+// skippedKey marks a request that verification let through unchecked,
+// through SkipPaths or PreValidate.
+type skippedKey struct{}
+
+// unlessSkipped lets requests skipped by SkipPaths or PreValidate past a
+// requirement, since they carry no claims to check.
+func unlessSkipped(require gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetBool(skippedKey{}) {
+			return
+		}
+		require(c)
+	}
+}
@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func protected(t *testing.T, opts Options) *gin.Engine {
+	t.Helper()
+	r := gin.New()
+	group := r.Group("/")
+	if err := Protect(group, opts); err != nil {
+		t.Fatal(err)
+	}
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	group.GET("/public", ok)
+	group.GET("/private", ok)
+	return r
+}
+
+func get(r http.Handler, path, tokenStr string) int {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if tokenStr != "" {
+		req.Header.Set("Authorization", "Bearer "+tokenStr)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestProtectRequirements(t *testing.T) {
+	r := protected(t, Options{Provider: newTestKeys(), RequiredScopes: []string{"read"}, RequiredRoles: []string{"admin"}})
+
+	for _, tc := range []struct {
+		name   string
+		claims jwt.MapClaims
+		want   int
+	}{
+		{"scope and role", jwt.MapClaims{"scope": "read", "roles": []string{"admin"}}, http.StatusOK},
+		{"missing scope", jwt.MapClaims{"roles": []string{"admin"}}, http.StatusForbidden},
+		{"missing role", jwt.MapClaims{"scope": "read"}, http.StatusForbidden},
+	} {
+		if code := get(r, "/private", sign(t, tc.claims)); code != tc.want {
+			t.Errorf("%s: status %d, want %d", tc.name, code, tc.want)
+		}
+	}
+	if code := get(r, "/private", ""); code != http.StatusUnauthorized {
+		t.Errorf("no token: status %d, want 401", code)
+	}
+}
+
+func TestProtectSkipPathsSkipRequirements(t *testing.T) {
+	r := protected(t, Options{Provider: newTestKeys(), SkipPaths: []string{"/public"}, RequiredScopes: []string{"read"}})
+
+	if code := get(r, "/public", ""); code != http.StatusOK {
+		t.Fatalf("skipped path: status %d, want 200", code)
+	}
+	if code := get(r, "/private", ""); code != http.StatusUnauthorized {
+		t.Fatalf("protected path: status %d, want 401", code)
+	}
+}
+
+func TestProtectPreValidateSkipsRequirements(t *testing.T) {
+	r := protected(t, Options{
+		Provider:      newTestKeys(),
+		RequiredRoles: []string{"admin"},
+		PreValidate: func(c *gin.Context) (bool, error) {
+			return c.GetHeader("X-Internal") == "1", nil
+		},
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/private", nil)
+	req.Header.Set("X-Internal", "1")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200", w.Code)
+	}
+}
+
+func TestProtectRejectsEmptyRequirement(t *testing.T) {
+	if err := Protect(gin.New().Group("/"), Options{Provider: newTestKeys(), RequiredScopes: []string{""}}); err == nil {
+		t.Fatal("Protect accepted an empty scope")
+	}
+}
@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// RateLimitBySubject allows limit requests per Subject in each fixed window
+// and responds 429 with Retry-After beyond that. X-RateLimit-Remaining is
+// set on every response. Tokens without a subject share one bucket.
+// Counters are kept in memory, per process.
+func RateLimitBySubject(limit int, window time.Duration) gin.HandlerFunc {
+	counter := newWindowCounter(window)
+
+	return func(c *gin.Context) {
+		if _, authErr := claimsFrom(c); authErr != nil {
+			abort(c, authErr)
+			return
+		}
+
+		remaining, reset, ok := counter.take(Subject(c), limit)
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		if !ok {
+			c.Header("Retry-After", strconv.Itoa(int((reset+time.Second-1)/time.Second)))
+			abort(c, ErrRateLimited)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// DefaultClientQuota is the QuotaByClient limits key applied to clients that
+// have no entry of their own, including tokens without a client identifier.
+const DefaultClientQuota = "*"
+
+// QuotaByClient allows limits[client] requests per client in each fixed
+// window, where the client is the azp claim, falling back to client_id.
+// Clients without an entry each get limits[DefaultClientQuota], and are not
+// limited when that is absent too; tokens without a client share one
+// bucket. X-RateLimit-Limit and X-RateLimit-Remaining are set on every
+// limited response; beyond the quota it responds 429 with Retry-After.
+// Counters are kept in memory, per process.
+func QuotaByClient(limits map[string]int, window time.Duration) gin.HandlerFunc {
+	counter := newWindowCounter(window)
+
+	return func(c *gin.Context) {
+		claims, authErr := claimsFrom(c)
+		if authErr != nil {
+			abort(c, authErr)
+			return
+		}
+
+		client := clientID(claims)
+		limit, ok := limits[client]
+		if !ok {
+			if limit, ok = limits[DefaultClientQuota]; !ok {
+				c.Next()
+				return
+			}
+		}
+
+		remaining, reset, ok := counter.take(client, limit)
+		c.Header("X-RateLimit-Limit", strconv.Itoa(limit))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		if !ok {
+			c.Header("Retry-After", strconv.Itoa(int((reset+time.Second-1)/time.Second)))
+			abort(c, ErrRateLimited)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func clientID(claims jwt.MapClaims) string {
+	if azp := claimString(claims["azp"]); azp != "" {
+		return azp
+	}
+	return claimString(claims["client_id"])
+}
+
+type windowCounter struct {
+	window time.Duration
+	mu     sync.Mutex
+	counts map[string]*windowCount
+	swept  time.Time
+}
+
+type windowCount struct {
+	start time.Time
+	n     int
+}
+
+func newWindowCounter(window time.Duration) *windowCounter {
+	return &windowCounter{window: window, counts: map[string]*windowCount{}, swept: time.Now()}
+}
+
+// take counts a request for key. It returns the requests left in the
+// current window, the time until it resets, and whether the request fits.
+func (w *windowCounter) take(key string, limit int) (remaining int, reset time.Duration, ok bool) {
+	now := time.Now()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if now.Sub(w.swept) >= w.window {
+		for k, count := range w.counts {
+			if now.Sub(count.start) >= w.window {
+				delete(w.counts, k)
+			}
+		}
+		w.swept = now
+	}
+
+	count, found := w.counts[key]
+	if !found || now.Sub(count.start) >= w.window {
+		count = &windowCount{start: now}
+		w.counts[key] = count
+	}
+	reset = count.start.Add(w.window).Sub(now)
+	if count.n >= limit {
+		return 0, reset, false
+	}
+	count.n++
+	return limit - count.n, reset, true
+}
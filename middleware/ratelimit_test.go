@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestRateLimitBySubject(t *testing.T) {
+	handlers := []gin.HandlerFunc{VerifyTokenWithOptions(Options{Provider: newTestKeys()}), RateLimitBySubject(2, time.Minute)}
+	alice := sign(t, jwt.MapClaims{"sub": "alice"})
+
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		w := serve(alice, handlers...)
+		if w.Code != want {
+			t.Fatalf("request %d: status %d, want %d", i, w.Code, want)
+		}
+		if want == http.StatusTooManyRequests && w.Header().Get("Retry-After") == "" {
+			t.Fatal("429 without Retry-After")
+		}
+	}
+	if w := serve(sign(t, jwt.MapClaims{"sub": "bob"}), handlers...); w.Code != http.StatusOK {
+		t.Fatalf("other subject: status %d, want 200", w.Code)
+	}
+}
+
+func TestRateLimitBySubjectClaim(t *testing.T) {
+	handlers := []gin.HandlerFunc{VerifyTokenWithOptions(Options{Provider: newTestKeys(), SubjectClaim: "oid"}), RateLimitBySubject(1, time.Minute)}
+	alice := sign(t, jwt.MapClaims{"sub": "shared", "oid": "alice"})
+	bob := sign(t, jwt.MapClaims{"sub": "shared", "oid": "bob"})
+
+	if w := serve(alice, handlers...); w.Code != http.StatusOK {
+		t.Fatalf("alice: status %d, want 200", w.Code)
+	}
+	if w := serve(bob, handlers...); w.Code != http.StatusOK {
+		t.Fatalf("bob shares alice's bucket: status %d, want 200", w.Code)
+	}
+	if w := serve(alice, handlers...); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("alice over limit: status %d, want 429", w.Code)
+	}
+}
+
+func TestRateLimitRequiresClaims(t *testing.T) {
+	if w := serve("", RateLimitBySubject(1, time.Minute)); w.Code != http.StatusUnauthorized {
+		t.Fatalf("status %d, want 401", w.Code)
+	}
+}
+
+func TestQuotaByClient(t *testing.T) {
+	verify := VerifyTokenWithOptions(Options{Provider: newTestKeys()})
+	quota := QuotaByClient(map[string]int{"web": 1, DefaultClientQuota: 2}, time.Minute)
+
+	web := sign(t, jwt.MapClaims{"sub": "alice", "azp": "web"})
+	if w := serve(web, verify, quota); w.Code != http.StatusOK || w.Header().Get("X-RateLimit-Limit") != "1" {
+		t.Fatalf("web: status %d, limit %q", w.Code, w.Header().Get("X-RateLimit-Limit"))
+	}
+	if w := serve(web, verify, quota); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("web over quota: status %d, want 429", w.Code)
+	}
+
+	// Unlisted clients get the default quota each.
+	for _, client := range []string{"cli", "batch"} {
+		tokenStr := sign(t, jwt.MapClaims{"sub": "alice", "client_id": client})
+		for i := range 2 {
+			if w := serve(tokenStr, verify, quota); w.Code != http.StatusOK {
+				t.Fatalf("%s request %d: status %d, want 200", client, i, w.Code)
+			}
+		}
+	}
+}
+
+func TestQuotaByClientWithoutDefault(t *testing.T) {
+	verify := VerifyTokenWithOptions(Options{Provider: newTestKeys()})
+	quota := QuotaByClient(map[string]int{"web": 1}, time.Minute)
+	tokenStr := sign(t, jwt.MapClaims{"sub": "alice", "azp": "cli"})
+
+	for range 3 {
+		if w := serve(tokenStr, verify, quota); w.Code != http.StatusOK || w.Header().Get("X-RateLimit-Limit") != "" {
+			t.Fatalf("unlisted client limited: status %d", w.Code)
+		}
+	}
+}
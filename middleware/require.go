@@ -0,0 +1,364 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// RequireAMR passes when the token amr claim contains any of methods.
+func RequireAMR(methods ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, authErr := claimsFrom(c)
+		if authErr != nil {
+			abort(c, authErr)
+			return
+		}
+
+		if !containsAny(stringList(claims["amr"]), methods) {
+			abort(c, ErrInsufficientAuth)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireACR passes when the token acr claim equals any of values.
+func RequireACR(values ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, authErr := claimsFrom(c)
+		if authErr != nil {
+			abort(c, authErr)
+			return
+		}
+
+		acr, _ := claims["acr"].(string)
+		if !containsAny([]string{acr}, values) {
+			abort(c, ErrInsufficientAuth)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireFreshAuth passes when the token auth_time claim is at most maxAge
+// old, e.g. in front of sensitive actions that need a recent login. Tokens
+// without auth_time are rejected.
+func RequireFreshAuth(maxAge time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, authErr := claimsFrom(c)
+		if authErr != nil {
+			abort(c, authErr)
+			return
+		}
+
+		authTime, ok := numericDate(claims["auth_time"])
+		if !ok || time.Since(authTime) > maxAge {
+			abort(c, ErrReauthRequired)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// Claims returns the claims stored by VerifyToken, honouring
+// Options.ContextPrefix.
+func Claims(c *gin.Context) (jwt.MapClaims, bool) {
+	claims, authErr := claimsFrom(c)
+	return claims, authErr == nil
+}
+
+// User returns the object stored by Options.UserResolver.
+func User[T any](c *gin.Context) (T, bool) {
+	user, ok := getValue(c, "user")
+	if !ok {
+		var zero T
+		return zero, false
+	}
+	typed, ok := user.(T)
+	return typed, ok
+}
+
+// Subject returns the user ID of the verified token, read from
+// Options.SubjectClaim.
+func Subject(c *gin.Context) string {
+	subject, _ := getValue(c, "subject")
+	s, _ := subject.(string)
+	return s
+}
+
+// Degraded reports whether the request was verified with stale keys under
+// StaleDegrade.
+func Degraded(c *gin.Context) bool {
+	degraded, _ := getValue(c, "auth_degraded")
+	b, _ := degraded.(bool)
+	return b
+}
+
+type ScopeOptions struct {
+	// CaseInsensitive matches scopes ignoring case. Matching is exact by default.
+	CaseInsensitive bool
+	// Audience limits the check to tokens whose aud, a string or an array,
+	// contains it; tokens for other audiences pass unchecked. Chain one
+	// RequireScopesWithOptions per audience for per-service policies.
+	Audience string
+}
+
+// RequireScopes passes when the token grants all of scopes, read from the
+// scope claim or the scp array. Scopes may be separated by any run of
+// whitespace or commas; matching is exact.
+func RequireScopes(scopes ...string) gin.HandlerFunc {
+	return RequireScopesWithOptions(ScopeOptions{}, scopes...)
+}
+
+func RequireScopesWithOptions(opts ScopeOptions, scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, authErr := claimsFrom(c)
+		if authErr != nil {
+			abort(c, authErr)
+			return
+		}
+
+		if opts.Audience != "" {
+			aud, _ := claims.GetAudience()
+			if !containsAny(aud, []string{opts.Audience}) {
+				c.Next()
+				return
+			}
+		}
+
+		if !matchAll(tokenScopes(claims), scopes, opts.CaseInsensitive) {
+			abort(c, ErrInsufficientScope)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// DefaultMethodScopes maps safe methods to "read" and the rest to "write".
+var DefaultMethodScopes = map[string][]string{
+	http.MethodGet:     {"read"},
+	http.MethodHead:    {"read"},
+	http.MethodOptions: {"read"},
+	http.MethodPost:    {"write"},
+	http.MethodPut:     {"write"},
+	http.MethodPatch:   {"write"},
+	http.MethodDelete:  {"write"},
+}
+
+// RequireMethodScopes requires all scopes mapped to the request method,
+// e.g. read for GET and write for POST. A "*" entry covers unlisted
+// methods; methods matching neither are rejected. A nil mapping uses
+// DefaultMethodScopes.
+func RequireMethodScopes(mapping map[string][]string) gin.HandlerFunc {
+	if mapping == nil {
+		mapping = DefaultMethodScopes
+	}
+
+	return func(c *gin.Context) {
+		claims, authErr := claimsFrom(c)
+		if authErr != nil {
+			abort(c, authErr)
+			return
+		}
+
+		scopes, ok := mapping[c.Request.Method]
+		if !ok {
+			scopes, ok = mapping["*"]
+		}
+		if !ok || !matchAll(tokenScopes(claims), scopes, false) {
+			abort(c, ErrInsufficientScope)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+type RoleOptions struct {
+	// Claims lists where roles are read from, as dotted paths into nested
+	// objects, e.g. "realm_access.roles" for Keycloak. Roles found at every
+	// path are combined. Keys that contain dots themselves, such as
+	// "resource_access.my.client.roles", are matched longest first.
+	// Defaults to "roles".
+	Claims []string
+	// Delimiters are the characters that split a string value into roles,
+	// with surrounding whitespace trimmed. Defaults to any run of whitespace
+	// or commas. Entries of an array are taken as they are.
+	Delimiters string
+}
+
+// RequireRoles passes when the roles claim contains any of roles. A string
+// claim is split on whitespace and commas, an array is used as is.
+func RequireRoles(roles ...string) gin.HandlerFunc {
+	return RequireRolesWithOptions(RoleOptions{}, roles...)
+}
+
+// RequireRolesWithOptions passes when the roles read as opts describes
+// contain any of roles.
+func RequireRolesWithOptions(opts RoleOptions, roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, authErr := claimsFrom(c)
+		if authErr != nil {
+			abort(c, authErr)
+			return
+		}
+
+		if !containsAny(ExtractRoles(claims, opts), roles) {
+			abort(c, ErrInsufficientRole)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// ExtractRoles returns the roles of claims as RequireRolesWithOptions reads
+// them, for handlers and Validators that apply their own role logic.
+func ExtractRoles(claims jwt.MapClaims, opts RoleOptions) []string {
+	paths := opts.Claims
+	if len(paths) == 0 {
+		paths = []string{"roles"}
+	}
+	isDelimiter := isScopeSeparator
+	if opts.Delimiters != "" {
+		isDelimiter = func(r rune) bool { return strings.ContainsRune(opts.Delimiters, r) }
+	}
+
+	var roles []string
+	for _, path := range paths {
+		v, ok := claimPath(map[string]interface{}(claims), path)
+		if !ok {
+			continue
+		}
+		if s, ok := v.(string); ok {
+			for _, role := range strings.FieldsFunc(s, isDelimiter) {
+				if role = strings.TrimSpace(role); role != "" {
+					roles = append(roles, role)
+				}
+			}
+			continue
+		}
+		roles = append(roles, stringList(v)...)
+	}
+	return roles
+}
+
+// claimPath resolves a dotted path in nested claim objects, preferring the
+// longest key at each level so that keys containing dots still match.
+func claimPath(v interface{}, path string) (interface{}, bool) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	if value, ok := m[path]; ok {
+		return value, true
+	}
+	for i := strings.LastIndexByte(path, '.'); i > 0; i = strings.LastIndexByte(path[:i], '.') {
+		if next, ok := m[path[:i]]; ok {
+			if value, ok := claimPath(next, path[i+1:]); ok {
+				return value, true
+			}
+		}
+	}
+	return nil, false
+}
+
+func tokenScopes(claims jwt.MapClaims) []string {
+	raw, ok := claims["scope"]
+	if !ok {
+		raw = claims["scp"]
+	}
+
+	var scopes []string
+	for _, s := range stringList(raw) {
+		scopes = append(scopes, strings.FieldsFunc(s, isScopeSeparator)...)
+	}
+	return scopes
+}
+
+func isScopeSeparator(r rune) bool {
+	return r == ',' || unicode.IsSpace(r)
+}
+
+// claimsFrom returns the claims stored by VerifyToken. A value of another
+// type under the same key is reported instead of being treated as missing.
+func claimsFrom(c *gin.Context) (jwt.MapClaims, *AuthError) {
+	v, ok := getValue(c, "claims")
+	if !ok {
+		return nil, ErrMissingClaims
+	}
+	claims, ok := v.(jwt.MapClaims)
+	if !ok {
+		return nil, ErrUnexpectedClaims
+	}
+	return claims, nil
+}
+
+func numericDate(v interface{}) (time.Time, bool) {
+	switch v := v.(type) {
+	case float64:
+		return time.Unix(0, int64(v*float64(time.Second))), true
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return time.Time{}, false
+		}
+		return time.Unix(0, int64(f*float64(time.Second))), true
+	}
+	return time.Time{}, false
+}
+
+func stringList(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+func matchAll(have, want []string, fold bool) bool {
+	for _, w := range want {
+		found := false
+		for _, h := range have {
+			if h == w || fold && strings.EqualFold(h, w) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func containsAny(have, want []string) bool {
+	for _, w := range want {
+		for _, h := range have {
+			if h == w {
+				return true
+			}
+		}
+	}
+	return false
+}
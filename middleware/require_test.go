@@ -0,0 +1,260 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// status verifies a token over claims and runs it through require.
+func status(t *testing.T, claims jwt.MapClaims, require gin.HandlerFunc) int {
+	t.Helper()
+	return serve(sign(t, claims), VerifyTokenWithOptions(Options{Provider: newTestKeys()}), require).Code
+}
+
+func TestRequireAMR(t *testing.T) {
+	require := RequireAMR("mfa", "hwk")
+
+	for _, tc := range []struct {
+		name string
+		amr  any
+		want int
+	}{
+		{"listed", []string{"pwd", "mfa"}, http.StatusOK},
+		{"string", "hwk", http.StatusOK},
+		{"unlisted", []string{"pwd"}, http.StatusForbidden},
+		{"missing", nil, http.StatusForbidden},
+	} {
+		claims := jwt.MapClaims{"sub": "alice"}
+		if tc.amr != nil {
+			claims["amr"] = tc.amr
+		}
+		if got := status(t, claims, require); got != tc.want {
+			t.Errorf("%s: status %d, want %d", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestRequireACR(t *testing.T) {
+	require := RequireACR("urn:mace:incommon:iap:silver", "gold")
+
+	for _, tc := range []struct {
+		acr  any
+		want int
+	}{
+		{"gold", http.StatusOK},
+		{"bronze", http.StatusForbidden},
+		{[]string{"gold"}, http.StatusForbidden},
+		{nil, http.StatusForbidden},
+	} {
+		claims := jwt.MapClaims{"sub": "alice"}
+		if tc.acr != nil {
+			claims["acr"] = tc.acr
+		}
+		if got := status(t, claims, require); got != tc.want {
+			t.Errorf("acr %v: status %d, want %d", tc.acr, got, tc.want)
+		}
+	}
+}
+
+func TestRequireWithoutClaims(t *testing.T) {
+	if w := serve("", RequireAMR("mfa")); w.Code != ErrMissingClaims.Status {
+		t.Fatalf("status %d, want %d", w.Code, ErrMissingClaims.Status)
+	}
+}
+
+func TestRequireUnexpectedClaimsType(t *testing.T) {
+	// Another middleware storing its own value under "claims" must surface
+	// as a server error, not as an unauthenticated request.
+	other := func(c *gin.Context) { c.Set("claims", map[string]any{"sub": "alice"}) }
+
+	w := serve("", other, RequireScopes("read"))
+	if w.Code != http.StatusInternalServerError || body(t, w.Body.Bytes())["code"] != ErrUnexpectedClaims.Code {
+		t.Fatalf("status %d, body %s", w.Code, w.Body)
+	}
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	other(c)
+	if _, ok := Claims(c); ok {
+		t.Fatal("Claims returned a value of another type")
+	}
+}
+
+func TestRequireScopes(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		claims jwt.MapClaims
+		opts   ScopeOptions
+		want   int
+	}{
+		{"space separated", jwt.MapClaims{"scope": "read write"}, ScopeOptions{}, http.StatusOK},
+		{"mixed separators", jwt.MapClaims{"scope": " read,\twrite\n"}, ScopeOptions{}, http.StatusOK},
+		{"scp array", jwt.MapClaims{"scp": []string{"read", "write"}}, ScopeOptions{}, http.StatusOK},
+		{"scp array of lists", jwt.MapClaims{"scp": []string{"read write"}}, ScopeOptions{}, http.StatusOK},
+		{"missing one", jwt.MapClaims{"scope": "read"}, ScopeOptions{}, http.StatusForbidden},
+		{"case differs", jwt.MapClaims{"scope": "READ Write"}, ScopeOptions{}, http.StatusForbidden},
+		{"case insensitive", jwt.MapClaims{"scope": "READ Write"}, ScopeOptions{CaseInsensitive: true}, http.StatusOK},
+		{"prefix only", jwt.MapClaims{"scope": "reader writer"}, ScopeOptions{}, http.StatusForbidden},
+		{"no scopes", jwt.MapClaims{}, ScopeOptions{}, http.StatusForbidden},
+	} {
+		tc.claims["sub"] = "alice"
+		if got := status(t, tc.claims, RequireScopesWithOptions(tc.opts, "read", "write")); got != tc.want {
+			t.Errorf("%s: status %d, want %d", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestRequireScopesForAudience(t *testing.T) {
+	// Each service enforces its own scopes on tokens issued for it.
+	orders := RequireScopesWithOptions(ScopeOptions{Audience: "orders"}, "orders:write")
+	billing := RequireScopesWithOptions(ScopeOptions{Audience: "billing"}, "billing:read")
+
+	for _, tc := range []struct {
+		name   string
+		claims jwt.MapClaims
+		want   int
+	}{
+		{"string aud granted", jwt.MapClaims{"aud": "orders", "scope": "orders:write"}, http.StatusOK},
+		{"string aud missing scope", jwt.MapClaims{"aud": "orders", "scope": "billing:read"}, http.StatusForbidden},
+		{"array aud granted", jwt.MapClaims{"aud": []string{"orders", "billing"}, "scope": "orders:write billing:read"}, http.StatusOK},
+		{"array aud missing one", jwt.MapClaims{"aud": []string{"orders", "billing"}, "scope": "orders:write"}, http.StatusForbidden},
+		{"other audience", jwt.MapClaims{"aud": "reports"}, http.StatusOK},
+		{"no aud", jwt.MapClaims{}, http.StatusOK},
+	} {
+		tc.claims["sub"] = "alice"
+		w := serve(sign(t, tc.claims), VerifyTokenWithOptions(Options{Provider: newTestKeys()}), orders, billing)
+		if w.Code != tc.want {
+			t.Errorf("%s: status %d, want %d", tc.name, w.Code, tc.want)
+		}
+	}
+}
+
+func TestRequireFreshAuth(t *testing.T) {
+	require := RequireFreshAuth(5 * time.Minute)
+
+	for _, tc := range []struct {
+		name     string
+		authTime any
+		want     int
+	}{
+		{"recent", ago(time.Minute), http.StatusOK},
+		{"just inside", ago(5*time.Minute - 5*time.Second), http.StatusOK},
+		{"too old", ago(10 * time.Minute), http.StatusUnauthorized},
+		{"string", "1700000000", http.StatusUnauthorized},
+		{"missing", nil, http.StatusUnauthorized},
+	} {
+		claims := jwt.MapClaims{"sub": "alice"}
+		if tc.authTime != nil {
+			claims["auth_time"] = tc.authTime
+		}
+		w := serve(sign(t, claims), VerifyTokenWithOptions(Options{Provider: newTestKeys()}), require)
+		if w.Code != tc.want {
+			t.Errorf("%s: status %d, want %d", tc.name, w.Code, tc.want)
+		}
+		if tc.want != http.StatusOK && body(t, w.Body.Bytes())["code"] != ErrReauthRequired.Code {
+			t.Errorf("%s: body %s, want %s", tc.name, w.Body, ErrReauthRequired.Code)
+		}
+	}
+}
+
+func TestRequireMethodScopes(t *testing.T) {
+	readOnly := sign(t, jwt.MapClaims{"sub": "alice", "scope": "read"})
+	readWrite := sign(t, jwt.MapClaims{"sub": "alice", "scope": "read write"})
+	verify := VerifyTokenWithOptions(Options{Provider: newTestKeys()})
+	custom := map[string][]string{http.MethodDelete: {"admin"}, "*": {"read"}}
+
+	for _, tc := range []struct {
+		name     string
+		mapping  map[string][]string
+		method   string
+		tokenStr string
+		want     int
+	}{
+		{"GET with read", nil, http.MethodGet, readOnly, http.StatusOK},
+		{"POST with read", nil, http.MethodPost, readOnly, http.StatusForbidden},
+		{"POST with write", nil, http.MethodPost, readWrite, http.StatusOK},
+		{"unmapped method", nil, "PROPFIND", readWrite, http.StatusForbidden},
+		{"wildcard", custom, http.MethodPatch, readOnly, http.StatusOK},
+		{"custom entry", custom, http.MethodDelete, readWrite, http.StatusForbidden},
+	} {
+		w := serveMethod(tc.method, tc.tokenStr, verify, RequireMethodScopes(tc.mapping))
+		if w.Code != tc.want {
+			t.Errorf("%s: status %d, want %d", tc.name, w.Code, tc.want)
+		}
+	}
+}
+
+func TestRequireRoles(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		roles any
+		want  int
+	}{
+		{"array", []string{"viewer", "admin"}, http.StatusOK},
+		{"string", "viewer, admin", http.StatusOK},
+		{"other role", []string{"viewer"}, http.StatusForbidden},
+		{"missing", nil, http.StatusForbidden},
+	} {
+		claims := jwt.MapClaims{"sub": "alice"}
+		if tc.roles != nil {
+			claims["roles"] = tc.roles
+		}
+		if got := status(t, claims, RequireRoles("admin", "owner")); got != tc.want {
+			t.Errorf("%s: status %d, want %d", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestExtractRoles(t *testing.T) {
+	claims := jwt.MapClaims{
+		"roles":        "viewer",
+		"realm_access": map[string]any{"roles": []any{"admin", "auditor"}},
+		"resource_access": map[string]any{
+			"my.client": map[string]any{"roles": []any{"editor"}},
+		},
+		"https://example.com/groups": "ops;dev ; ",
+	}
+
+	for _, tc := range []struct {
+		name string
+		opts RoleOptions
+		want []string
+	}{
+		{"default", RoleOptions{}, []string{"viewer"}},
+		{"nested", RoleOptions{Claims: []string{"realm_access.roles"}}, []string{"admin", "auditor"}},
+		{"dotted key", RoleOptions{Claims: []string{"resource_access.my.client.roles"}}, []string{"editor"}},
+		{"combined", RoleOptions{Claims: []string{"roles", "realm_access.roles"}}, []string{"viewer", "admin", "auditor"}},
+		{"missing path", RoleOptions{Claims: []string{"realm_access.groups", "nope"}}, nil},
+		{"through a string", RoleOptions{Claims: []string{"roles.admin"}}, nil},
+		{"delimiters", RoleOptions{Claims: []string{"https://example.com/groups"}, Delimiters: ";"}, []string{"ops", "dev"}},
+		{"default delimiters", RoleOptions{Claims: []string{"https://example.com/groups"}}, []string{"ops;dev", ";"}},
+	} {
+		if got := ExtractRoles(claims, tc.opts); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestRequireRolesWithOptions(t *testing.T) {
+	require := RequireRolesWithOptions(RoleOptions{Claims: []string{"realm_access.roles", "resource_access.my.client.roles"}}, "editor")
+
+	for _, tc := range []struct {
+		name   string
+		claims jwt.MapClaims
+		want   int
+	}{
+		{"client role", jwt.MapClaims{"resource_access": map[string]any{"my.client": map[string]any{"roles": []string{"editor"}}}}, http.StatusOK},
+		{"realm role", jwt.MapClaims{"realm_access": map[string]any{"roles": []string{"editor"}}}, http.StatusOK},
+		{"top level only", jwt.MapClaims{"roles": []string{"editor"}}, http.StatusForbidden},
+	} {
+		tc.claims["sub"] = "alice"
+		if got := status(t, tc.claims, require); got != tc.want {
+			t.Errorf("%s: status %d, want %d", tc.name, got, tc.want)
+		}
+	}
+}
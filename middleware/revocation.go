@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/digitcodestudiotech/go-middle/crypto"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var _ RevocationChecker = (*crypto.RevocationList)(nil)
+
+// RevocationChecker reports whether a verified token has been revoked,
+// typically by looking up its jti. Implementations doing I/O should honour
+// ctx, which carries Options.ValidationTimeout.
+type RevocationChecker interface {
+	IsRevoked(ctx context.Context, claims jwt.MapClaims) (bool, error)
+}
+
+// RevocationFunc adapts a function to RevocationChecker.
+type RevocationFunc func(ctx context.Context, claims jwt.MapClaims) (bool, error)
+
+func (f RevocationFunc) IsRevoked(ctx context.Context, claims jwt.MapClaims) (bool, error) {
+	return f(ctx, claims)
+}
+
+// checkRevocation runs on every request, including cache hits, so revoking
+// a token takes effect immediately.
+func checkRevocation(ctx context.Context, claims jwt.MapClaims, opts Options) *AuthError {
+	if opts.Revocation == nil {
+		return nil
+	}
+
+	var revoked bool
+	err := opts.RevocationBreaker.do(func() error {
+		r, err := opts.Revocation.IsRevoked(ctx, claims)
+		revoked = r && err == nil
+		return err
+	})
+	if err != nil {
+		return ErrRevocationFailed.wrap(err)
+	}
+	if revoked {
+		return ErrTokenRevoked
+	}
+	return nil
+}
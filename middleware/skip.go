@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"path"
+	"strings"
+)
+
+// skipPath reports whether p matches one of opts.SkipPaths. An entry ending in
+// "/*" matches everything below that prefix; other entries use path.Match.
+func skipPath(p string, opts Options) bool {
+	if opts.SkipIgnoreTrailingSlash {
+		p = trimSlash(p)
+	}
+
+	for _, pattern := range opts.SkipPaths {
+		if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+			if strings.HasPrefix(p, prefix+"/") {
+				return true
+			}
+			continue
+		}
+
+		if opts.SkipIgnoreTrailingSlash {
+			pattern = trimSlash(pattern)
+		}
+		if ok, _ := path.Match(pattern, p); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func trimSlash(p string) string {
+	if len(p) > 1 {
+		return strings.TrimRight(p, "/")
+	}
+	return p
+}
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestSkipPath(t *testing.T) {
+	strict := Options{SkipPaths: []string{"/healthz", "/metrics/", "/public/*", "/v?/ping"}}
+	loose := strict
+	loose.SkipIgnoreTrailingSlash = true
+
+	for _, tc := range []struct {
+		path          string
+		strict, loose bool
+	}{
+		{"/healthz", true, true},
+		{"/healthz/", false, true},
+		{"/healthz//", false, true},
+		{"/metrics", false, true},
+		{"/metrics/", true, true},
+		{"/public/css/app.css", true, true},
+		{"/public", false, false},
+		{"/publicity", false, false},
+		{"/v1/ping", true, true},
+		{"/v1/ping/", false, true},
+		{"/private", false, false},
+		{"/", false, false},
+	} {
+		if got := skipPath(tc.path, strict); got != tc.strict {
+			t.Errorf("%s: skipped = %v, want %v", tc.path, got, tc.strict)
+		}
+		if got := skipPath(tc.path, loose); got != tc.loose {
+			t.Errorf("%s with SkipIgnoreTrailingSlash: skipped = %v, want %v", tc.path, got, tc.loose)
+		}
+	}
+}
+
+func TestSkipPathsBypassVerification(t *testing.T) {
+	verify := VerifyTokenWithOptions(Options{Provider: newTestKeys(), SkipPaths: []string{"/"}})
+	if w := serve("", verify); w.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200", w.Code)
+	}
+}
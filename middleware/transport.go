@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+)
+
+// checkTransport enforces Options.MinTLSVersion and
+// Options.RejectInsecureCiphers on the connection of r. A request without
+// TLS fails both.
+func checkTransport(r *http.Request, opts Options) *AuthError {
+	if opts.MinTLSVersion == 0 && !opts.RejectInsecureCiphers {
+		return nil
+	}
+	if r.TLS == nil {
+		return ErrInsecureTransport.wrap(errors.New("connection is not TLS"))
+	}
+
+	if r.TLS.Version < opts.MinTLSVersion {
+		return ErrInsecureTransport.wrap(errors.New(tls.VersionName(r.TLS.Version) + " is below " + tls.VersionName(opts.MinTLSVersion)))
+	}
+	if opts.RejectInsecureCiphers {
+		for _, suite := range tls.InsecureCipherSuites() {
+			if suite.ID == r.TLS.CipherSuite {
+				return ErrInsecureTransport.wrap(errors.New("insecure cipher suite " + suite.Name))
+			}
+		}
+	}
+	return nil
+}
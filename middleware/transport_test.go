@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestCheckTransport(t *testing.T) {
+	strong := tls.TLS_AES_128_GCM_SHA256
+	weak := tls.TLS_RSA_WITH_RC4_128_SHA
+
+	for _, tc := range []struct {
+		name  string
+		state *tls.ConnectionState
+		opts  Options
+		ok    bool
+	}{
+		{"disabled", nil, Options{}, true},
+		{"plain HTTP", nil, Options{MinTLSVersion: tls.VersionTLS12}, false},
+		{"TLS 1.1", &tls.ConnectionState{Version: tls.VersionTLS11, CipherSuite: strong}, Options{MinTLSVersion: tls.VersionTLS12}, false},
+		{"TLS 1.2", &tls.ConnectionState{Version: tls.VersionTLS12, CipherSuite: strong}, Options{MinTLSVersion: tls.VersionTLS12}, true},
+		{"TLS 1.3", &tls.ConnectionState{Version: tls.VersionTLS13, CipherSuite: strong}, Options{MinTLSVersion: tls.VersionTLS12}, true},
+		{"TLS 1.2 under 1.3 minimum", &tls.ConnectionState{Version: tls.VersionTLS12, CipherSuite: strong}, Options{MinTLSVersion: tls.VersionTLS13}, false},
+		{"insecure cipher", &tls.ConnectionState{Version: tls.VersionTLS12, CipherSuite: weak}, Options{RejectInsecureCiphers: true}, false},
+		{"insecure cipher allowed", &tls.ConnectionState{Version: tls.VersionTLS12, CipherSuite: weak}, Options{MinTLSVersion: tls.VersionTLS12}, true},
+		{"plain HTTP with cipher check", nil, Options{RejectInsecureCiphers: true}, false},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.TLS = tc.state
+		err := checkTransport(r, tc.opts)
+		if tc.ok && err != nil || !tc.ok && !errors.Is(err, ErrInsecureTransport) {
+			t.Errorf("%s: err = %v", tc.name, err)
+		}
+	}
+}
+
+func TestMinTLSVersion(t *testing.T) {
+	opts := Options{Provider: newTestKeys(), MinTLSVersion: tls.VersionTLS12}
+	r := gin.New()
+	r.GET("/", VerifyTokenWithOptions(opts), func(c *gin.Context) { c.Status(http.StatusOK) })
+	h := Verify[jwt.MapClaims](opts)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	tokenStr := sign(t, jwt.MapClaims{"sub": "alice"})
+
+	for version, want := range map[uint16]int{tls.VersionTLS11: http.StatusForbidden, tls.VersionTLS13: http.StatusOK} {
+		for name, handler := range map[string]http.Handler{"gin": r, "net/http": h} {
+			req := httptest.NewRequest(http.MethodGet, "https://api.example.com/", nil)
+			req.TLS.Version = version
+			req.Header.Set("Authorization", "Bearer "+tokenStr)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Code != want {
+				t.Errorf("%s %s: status %d, want %d", name, tls.VersionName(version), w.Code, want)
+			}
+			if want == http.StatusForbidden && body(t, w.Body.Bytes())["code"] != ErrInsecureTransport.Code {
+				t.Errorf("%s %s: body %s", name, tls.VersionName(version), w.Body)
+			}
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package middleware
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// VerifyDetached verifies a compact JWS whose payload travels separately,
+// e.g. a signed HTTP body with the JWS in a header (RFC 7515 appendix F). The
+// payload segment of jws must be empty. Both "b64": true and the unencoded
+// "b64": false of RFC 7797 are supported. The protected header is returned;
+// payload is not interpreted as claims. AllowUnencodedPayload is implied.
+func VerifyDetached(jws string, payload []byte, opts Options) (map[string]any, error) {
+	if opts.Provider == nil {
+		return nil, ErrNoKeyProvider
+	}
+	opts.AllowUnencodedPayload = true
+	if parts := strings.Split(jws, "."); len(parts) != 3 || parts[1] != "" {
+		return nil, ErrMalformedToken.wrap(errors.New("payload segment must be empty"))
+	}
+
+	header, _, err := verifyUnencoded(jws, payload, opts)
+	if err != nil {
+		return nil, err
+	}
+	return header, nil
+}
+
+// unencodedPayload reports whether the header of jws sets "b64": false.
+func unencodedPayload(jws string) bool {
+	header, err := decodeHeader(jws)
+	if err != nil {
+		return false
+	}
+	b64, ok := header["b64"].(bool)
+	return ok && !b64
+}
+
+// parseUnencoded verifies a JWS with an embedded RFC 7797 payload and decodes
+// the payload into claims.
+func parseUnencoded(jws string, claims jwt.Claims, opts Options) *AuthError {
+	header, payload, authErr := verifyUnencoded(jws, nil, opts)
+	if authErr != nil {
+		return authErr
+	}
+
+	var err error
+	if m, ok := claims.(jwt.MapClaims); ok {
+		err = json.Unmarshal(payload, &m)
+	} else {
+		err = json.Unmarshal(payload, claims)
+	}
+	if err != nil {
+		return ErrMalformedToken.wrap(err)
+	}
+	if authErr := mergeHeaderClaims(header, claims, opts); authErr != nil {
+		return authErr
+	}
+	return validateClaims(claims, opts)
+}
+
+// verifyUnencoded checks the signature of jws over payload, or over its own
+// payload segment when payload is nil. An unencoded payload may contain dots,
+// so the segments are split at the first and last dot.
+func verifyUnencoded(jws string, payload []byte, opts Options) (map[string]any, []byte, *AuthError) {
+	first, last := strings.IndexByte(jws, '.'), strings.LastIndexByte(jws, '.')
+	if first < 0 || first == last {
+		return nil, nil, ErrMalformedToken
+	}
+	header, err := decodeHeader(jws)
+	if err != nil {
+		return nil, nil, ErrMalformedToken.wrap(err)
+	}
+
+	encoded := true
+	if b64, ok := header["b64"].(bool); ok && !b64 {
+		if !containsAny(stringList(header["crit"]), []string{"b64"}) {
+			return nil, nil, ErrMalformedToken.wrap(errors.New(`"b64" must be listed in "crit"`))
+		}
+		encoded = false
+	}
+
+	if payload == nil {
+		payload = []byte(jws[first+1 : last])
+		if encoded {
+			decoded, err := base64.RawURLEncoding.DecodeString(string(payload))
+			if err != nil {
+				return nil, nil, ErrMalformedToken.wrap(err)
+			}
+			payload = decoded
+		}
+	}
+	signingInput := jws[:first] + "."
+	if encoded {
+		signingInput += base64.RawURLEncoding.EncodeToString(payload)
+	} else {
+		signingInput += string(payload)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(jws[last+1:])
+	if err != nil {
+		return nil, nil, ErrMalformedToken.wrap(err)
+	}
+
+	alg, _ := header["alg"].(string)
+	method := jwt.GetSigningMethod(alg)
+	if method == nil {
+		return nil, nil, ErrUnverifiableToken.wrap(errors.New("unknown signing method " + alg))
+	}
+
+	token := &jwt.Token{Raw: jws, Method: method, Header: header}
+	key, err := keyfunc(opts)(token)
+	if err != nil {
+		var authErr *AuthError
+		if errors.As(err, &authErr) {
+			return nil, nil, authErr
+		}
+		return nil, nil, ErrUnverifiableToken.wrap(err)
+	}
+
+	keys := []jwt.VerificationKey{key}
+	if set, ok := key.(jwt.VerificationKeySet); ok {
+		keys = set.Keys
+	}
+	for _, k := range keys {
+		if err = token.Method.Verify(signingInput, sig, k); err == nil {
+			return header, payload, nil
+		}
+	}
+	return nil, nil, ErrInvalidSignature.wrap(err)
+}
+
+func decodeHeader(jws string) (map[string]any, error) {
+	segment, _, _ := strings.Cut(jws, ".")
+	raw, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return nil, err
+	}
+	var header map[string]any
+	if err := json.Unmarshal(raw, &header); err != nil {
+		return nil, err
+	}
+	return header, nil
+}
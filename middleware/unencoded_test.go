@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// signUnencoded returns a JWS over payload with the given extra header
+// parameters. The payload segment is payload itself, left empty when detached.
+func signUnencoded(t *testing.T, header map[string]any, payload string, detached bool) string {
+	t.Helper()
+	header["alg"], header["kid"] = "RS256", "k1"
+	raw, err := json.Marshal(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	protected := base64.RawURLEncoding.EncodeToString(raw)
+	segment := payload
+	if b64, ok := header["b64"].(bool); !ok || b64 {
+		segment = base64.RawURLEncoding.EncodeToString([]byte(payload))
+	}
+	sig, err := jwt.SigningMethodRS256.Sign(protected+"."+segment, testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if detached {
+		segment = ""
+	}
+	return protected + "." + segment + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func unencoded() map[string]any {
+	return map[string]any{"b64": false, "crit": []string{"b64"}}
+}
+
+func TestVerifyDetached(t *testing.T) {
+	const body = `{"amount":"10.00","to":"acct.123"}`
+	opts := Options{Provider: newTestKeys()}
+
+	for _, tc := range []struct {
+		name    string
+		jws     string
+		payload string
+		want    *AuthError
+	}{
+		{"unencoded", signUnencoded(t, unencoded(), body, true), body, nil},
+		{"encoded", signUnencoded(t, map[string]any{}, body, true), body, nil},
+		{"unencoded tampered", signUnencoded(t, unencoded(), body, true), `{"amount":"99.00","to":"acct.123"}`, ErrInvalidSignature},
+		{"encoded tampered", signUnencoded(t, map[string]any{}, body, true), body + " ", ErrInvalidSignature},
+		{"attached payload", signUnencoded(t, map[string]any{}, body, false), body, ErrMalformedToken},
+		{"b64 not critical", signUnencoded(t, map[string]any{"b64": false}, body, true), body, ErrMalformedToken},
+	} {
+		header, err := VerifyDetached(tc.jws, []byte(tc.payload), opts)
+		switch {
+		case tc.want == nil && err != nil:
+			t.Errorf("%s: %v", tc.name, err)
+		case tc.want == nil && header["alg"] != "RS256":
+			t.Errorf("%s: header = %v", tc.name, header)
+		case tc.want != nil && !errors.Is(err, tc.want):
+			t.Errorf("%s: err = %v, want %v", tc.name, err, tc.want)
+		}
+	}
+
+	if _, err := VerifyDetached(signUnencoded(t, unencoded(), body, true), []byte(body), Options{}); !errors.Is(err, ErrNoKeyProvider) {
+		t.Fatalf("no provider: err = %v", err)
+	}
+}
+
+func TestUnencodedPayload(t *testing.T) {
+	payload := fmt.Sprintf(`{"sub":"alice.smith","exp":%d}`, time.Now().Add(time.Hour).Unix())
+	jws := signUnencoded(t, unencoded(), payload, false)
+
+	claims, err := Validate(context.Background(), jws, Options{Provider: newTestKeys(), AllowUnencodedPayload: true})
+	if err != nil || claims["sub"] != "alice.smith" {
+		t.Fatalf("claims = %v, err = %v", claims, err)
+	}
+	if _, err := Validate(context.Background(), jws, Options{Provider: newTestKeys()}); err == nil {
+		t.Fatal("unencoded payload accepted without AllowUnencodedPayload")
+	}
+
+	tampered := strings.Replace(jws, "alice.smith", "mallory", 1)
+	if _, err := Validate(context.Background(), tampered, Options{Provider: newTestKeys(), AllowUnencodedPayload: true}); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("tampered: err = %v, want ErrInvalidSignature", err)
+	}
+
+	expired := signUnencoded(t, unencoded(), fmt.Sprintf(`{"sub":"alice","exp":%d}`, time.Now().Add(-time.Hour).Unix()), false)
+	if _, err := Validate(context.Background(), expired, Options{Provider: newTestKeys(), AllowUnencodedPayload: true}); !errors.Is(err, ErrTokenExpired) {
+		t.Fatalf("expired: err = %v, want ErrTokenExpired", err)
+	}
+}
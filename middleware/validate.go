@@ -0,0 +1,555 @@
+package middleware
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"log"
+	"maps"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/digitcodestudiotech/go-middle/crypto"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type Decrypter interface {
+	Decrypt(token string) (string, error)
+}
+
+// Validate runs the verification pipeline on a raw token string, without any
+// extraction from a request. opts is used as given: env is not consulted and
+// opts.Provider must be set. The returned error is one of the Err* sentinels
+// and can be compared with errors.Is.
+func Validate(ctx context.Context, tokenStr string, opts Options) (jwt.MapClaims, error) {
+	claims, err := validate(ctx, tokenStr, opts)
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// Result is the outcome of one token in ValidateBatch.
+type Result struct {
+	Claims jwt.MapClaims
+	Err    error
+}
+
+// ValidateBatch runs Validate on every token concurrently with a bounded
+// number of workers. Results are in the order of tokens. Tokens not yet
+// started when ctx is done get ctx.Err().
+func ValidateBatch(ctx context.Context, tokens []string, opts Options) []Result {
+	results := make([]Result, len(tokens))
+
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(tokens) {
+		workers = len(tokens)
+	}
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i].Claims, results[i].Err = Validate(ctx, tokens[i], opts)
+			}
+		}()
+	}
+
+	for i := range tokens {
+		if ctx.Err() != nil {
+			results[i].Err = ctx.Err()
+			continue
+		}
+		select {
+		case next <- i:
+		case <-ctx.Done():
+			results[i].Err = ctx.Err()
+		}
+	}
+	close(next)
+	wg.Wait()
+
+	return results
+}
+
+// DebugToken verifies tokenStr against provider for CLIs and admin tools.
+// Unlike Validate it returns the decoded header and claims even when the
+// token is rejected, e.g. expired or with a bad signature; valid is true only
+// when err is nil. Header and claims are nil if the token cannot be decoded.
+func DebugToken(tokenStr string, provider crypto.KeyProvider) (valid bool, header map[string]any, claims jwt.MapClaims, err error) {
+	if provider == nil {
+		return false, nil, nil, ErrNoKeyProvider
+	}
+
+	claims = jwt.MapClaims{}
+	token, parseErr := jwt.ParseWithClaims(tokenStr, claims, keyfunc(Options{Provider: provider}))
+	if token != nil {
+		header = token.Header
+	}
+	if header == nil {
+		claims = nil
+	}
+	if parseErr != nil || !token.Valid {
+		return false, header, claims, parseError(parseErr)
+	}
+	return true, header, claims, nil
+}
+
+func validate(ctx context.Context, tokenStr string, opts Options) (jwt.MapClaims, *AuthError) {
+	var claims jwt.MapClaims
+	err := withValidationTimeout(ctx, opts, func(ctx context.Context) *AuthError {
+		var err *AuthError
+		if claims, err = verifiedClaims(ctx, tokenStr, opts); err != nil {
+			return err
+		}
+		return checkRevocation(ctx, claims, opts)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// validateTyped is validate for claims types other than jwt.MapClaims, which
+// bypass the TokenCache. The RevocationChecker receives the claims decoded
+// from their JSON form into jwt.MapClaims.
+func validateTyped(ctx context.Context, tokenStr string, claims jwt.Claims, opts Options) *AuthError {
+	return withValidationTimeout(ctx, opts, func(ctx context.Context) *AuthError {
+		if err := parseToken(tokenStr, claims, opts); err != nil {
+			return err
+		}
+		if opts.Revocation == nil {
+			return nil
+		}
+
+		raw, err := json.Marshal(claims)
+		if err != nil {
+			return ErrRevocationFailed.wrap(err)
+		}
+		var m jwt.MapClaims
+		if err := json.Unmarshal(raw, &m); err != nil {
+			return ErrRevocationFailed.wrap(err)
+		}
+		return checkRevocation(ctx, m, opts)
+	})
+}
+
+// withValidationTimeout runs fn bounded by opts.ValidationTimeout and reports
+// an error caused by the deadline as ErrValidationTimeout.
+func withValidationTimeout(ctx context.Context, opts Options, fn func(ctx context.Context) *AuthError) *AuthError {
+	if opts.ValidationTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.ValidationTimeout)
+		defer cancel()
+	}
+
+	err := fn(ctx)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return ErrValidationTimeout.wrap(ctx.Err())
+	}
+	return err
+}
+
+// verifiedClaims returns the claims of a valid token, from the TokenCache
+// when possible.
+func verifiedClaims(ctx context.Context, tokenStr string, opts Options) (jwt.MapClaims, *AuthError) {
+	if opts.Provider == nil {
+		return nil, ErrNoKeyProvider
+	}
+	if err := checkTokenSize(tokenStr, opts); err != nil {
+		return nil, err
+	}
+
+	var key string
+	if opts.TokenCache != nil {
+		key = cacheKey(tokenStr, opts)
+		if claims, ok, err := opts.TokenCache.Get(ctx, key); err == nil && ok && cachedValid(tokenStr, claims, opts) {
+			return claims, checkClaims(claims, opts)
+		}
+	}
+
+	claims := jwt.MapClaims{}
+	if err := parseToken(tokenStr, claims, opts); err != nil {
+		return nil, err
+	}
+	if err := checkClaims(claims, opts); err != nil {
+		return nil, err
+	}
+
+	if opts.TokenCache != nil {
+		if ttl := cacheTTL(claims, opts); ttl > 0 {
+			if indexer, ok := opts.TokenCache.(SubjectIndexer); ok {
+				_ = indexer.SetSubject(ctx, key, subjectOf(claims, opts), claims, ttl)
+			} else {
+				_ = opts.TokenCache.Set(ctx, key, claims, ttl)
+			}
+		}
+	}
+	return claims, nil
+}
+
+// cachedValid re-runs, on a TokenCache hit, the checks that depend on the
+// clock and on the current keys: exp, nbf, iat, aud and iss, and that the
+// header still resolves to a key of the provider, so a key removed from the
+// JWKS or no longer pinned stops matching at once. The header of a JWE is
+// only visible after decryption, so those entries rely on CacheTTL. A false
+// result falls back to a full parse, which reports the precise error.
+func cachedValid(tokenStr string, claims jwt.MapClaims, opts Options) bool {
+	if validateClaims(claims, opts) != nil {
+		return false
+	}
+	if opts.Decrypter != nil && strings.Count(tokenStr, ".") == 4 {
+		return true
+	}
+
+	header, err := decodeHeader(tokenStr)
+	if err != nil {
+		return false
+	}
+	alg, _ := header["alg"].(string)
+	method := jwt.GetSigningMethod(alg)
+	if method == nil {
+		return false
+	}
+	_, err = keyfunc(opts)(&jwt.Token{Raw: tokenStr, Header: header, Method: method, Claims: claims})
+	return err == nil
+}
+
+// parseToken decrypts and verifies tokenStr into claims, independent of the
+// claims type.
+func parseToken(tokenStr string, claims jwt.Claims, opts Options) *AuthError {
+	if err := checkTokenSize(tokenStr, opts); err != nil {
+		return err
+	}
+
+	jws, authErr := decrypt(tokenStr, opts)
+	if authErr != nil {
+		return authErr
+	}
+
+	if opts.AllowUnencodedPayload && unencodedPayload(jws) {
+		if err := parseUnencoded(jws, claims, opts); err != nil {
+			return err
+		}
+		return checkTokenAge(claims, opts)
+	}
+
+	parserOpts := parserOptions(opts)
+	deferValidation := opts.NotBeforeLeeway > 0 || opts.ClaimPrecedence != PayloadOnly || opts.LenientNumericDates || opts.claimsUnchecked
+	if deferValidation {
+		parserOpts = append(parserOpts, jwt.WithoutClaimsValidation())
+	}
+	token, err := jwt.ParseWithClaims(jws, claims, keyfunc(opts), parserOpts...)
+	if err != nil || !token.Valid {
+		return parseError(err)
+	}
+	if deferValidation {
+		if err := mergeHeaderClaims(token.Header, claims, opts); err != nil {
+			return err
+		}
+		if err := validateClaims(claims, opts); err != nil {
+			return err
+		}
+	}
+
+	return checkTokenAge(claims, opts)
+}
+
+// transformClaims applies opts.ClaimsTransform to a shallow copy of claims,
+// so entries shared with the TokenCache are never modified.
+func transformClaims(claims jwt.MapClaims, opts Options) (jwt.MapClaims, *AuthError) {
+	if opts.ClaimsTransform == nil {
+		return claims, nil
+	}
+	if claims = opts.ClaimsTransform(maps.Clone(claims)); claims == nil {
+		return nil, ErrClaimsRejected
+	}
+	return claims, nil
+}
+
+// validateClaims runs the exp, nbf, iat, aud and iss checks of the parser
+// on already verified claims, with nbf loosened by NotBeforeLeeway.
+func validateClaims(claims jwt.Claims, opts Options) *AuthError {
+	if opts.LenientNumericDates {
+		if err := coerceNumericDates(claims); err != nil {
+			return err
+		}
+	}
+	if opts.claimsUnchecked {
+		return nil
+	}
+	if opts.NotBeforeLeeway > 0 {
+		claims = earlyClaims{Claims: claims, leeway: opts.NotBeforeLeeway}
+	}
+	if err := jwt.NewValidator(parserOptions(opts)...).Validate(claims); err != nil {
+		return parseError(err)
+	}
+	return nil
+}
+
+// earlyClaims moves nbf back by leeway so that the validator loosens the nbf
+// check alone.
+type earlyClaims struct {
+	jwt.Claims
+	leeway time.Duration
+}
+
+func (c earlyClaims) GetNotBefore() (*jwt.NumericDate, error) {
+	nbf, err := c.Claims.GetNotBefore()
+	if nbf == nil || err != nil {
+		return nbf, err
+	}
+	return &jwt.NumericDate{Time: nbf.Add(-c.leeway)}, nil
+}
+
+func (c earlyClaims) Validate() error {
+	if v, ok := c.Claims.(jwt.ClaimsValidator); ok {
+		return v.Validate()
+	}
+	return nil
+}
+
+func checkTokenSize(tokenStr string, opts Options) *AuthError {
+	limit := opts.MaxTokenBytes
+	if limit == 0 {
+		limit = DefaultMaxTokenBytes
+	}
+	if limit > 0 && len(tokenStr) > limit {
+		return ErrTokenTooLarge
+	}
+	return nil
+}
+
+func checkClaims(claims jwt.MapClaims, opts Options) *AuthError {
+	if err := checkTokenAge(claims, opts); err != nil {
+		return err
+	}
+
+	for _, name := range opts.RequiredClaims {
+		if claimString(claims[name]) == "" {
+			missing := *ErrMissingRequiredClaim
+			missing.Message += ": " + name
+			return &missing
+		}
+	}
+
+	if opts.Validator != nil {
+		if err := opts.Validator(claims); err != nil {
+			var authErr *AuthError
+			if errors.As(err, &authErr) {
+				return authErr
+			}
+			return ErrClaimsRejected.wrap(err)
+		}
+	}
+	return nil
+}
+
+func keyfunc(opts Options) jwt.Keyfunc {
+	return func(t *jwt.Token) (interface{}, error) {
+		if err := checkCrit(t.Header, opts); err != nil {
+			return nil, err
+		}
+		if len(opts.Algorithms) > 0 && !containsAny([]string{t.Method.Alg()}, opts.Algorithms) {
+			return nil, ErrInvalidAlgorithm
+		}
+		if opts.RejectDeprecated && containsAny([]string{t.Method.Alg()}, opts.DeprecatedAlgorithms) {
+			return nil, ErrDeprecatedAlgorithm
+		}
+
+		key, err := opts.Provider.Key(t)
+		if errors.Is(err, crypto.ErrNotReady) {
+			return nil, ErrKeysNotReady
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !keyMatchesAlg(t.Method.Alg(), key) {
+			return nil, ErrAlgorithmKeyMismatch
+		}
+		if opts.SignatureVerifier != nil && t.Method != jwt.SigningMethodNone {
+			t.Method = verifierMethod{SigningMethod: t.Method, verifier: opts.SignatureVerifier}
+		}
+		return key, nil
+	}
+}
+
+// checkCrit enforces the crit header of RFC 7515 section 4.1.11: every
+// listed parameter must be understood, i.e. b64 with AllowUnencodedPayload
+// or one of AllowedCriticalHeaders, and present in the header. Registered
+// header names may not be listed.
+func checkCrit(header map[string]interface{}, opts Options) *AuthError {
+	raw, ok := header["crit"]
+	if !ok {
+		return nil
+	}
+
+	list, ok := raw.([]interface{})
+	if !ok || len(list) == 0 {
+		return ErrCriticalHeader.wrap(errors.New("crit must be a non-empty array"))
+	}
+	for _, v := range list {
+		name, _ := v.(string)
+		understood := name == "b64" && opts.AllowUnencodedPayload || containsAny([]string{name}, opts.AllowedCriticalHeaders)
+		if !understood || registeredHeaders[name] {
+			return ErrCriticalHeader.wrap(errors.New("unsupported critical header " + strconv.Quote(name)))
+		}
+		if _, present := header[name]; !present {
+			return ErrCriticalHeader.wrap(errors.New("critical header " + strconv.Quote(name) + " is missing"))
+		}
+	}
+	return nil
+}
+
+var registeredHeaders = map[string]bool{
+	"alg": true, "jku": true, "jwk": true, "kid": true, "x5u": true, "x5c": true,
+	"x5t": true, "x5t#S256": true, "typ": true, "cty": true, "crit": true,
+}
+
+// keyMatchesAlg rejects tokens whose alg belongs to a different key family
+// than the resolved key, e.g. an ES256 token routed to an RSA key. Both RS*
+// and PS* (RSA-PSS) verify against RSA keys. Algorithms outside the standard
+// families are left to their signing method.
+func keyMatchesAlg(alg string, key interface{}) bool {
+	if set, ok := key.(jwt.VerificationKeySet); ok {
+		for _, k := range set.Keys {
+			if !keyMatchesAlg(alg, k) {
+				return false
+			}
+		}
+		return len(set.Keys) > 0
+	}
+
+	switch {
+	case strings.HasPrefix(alg, "RS"), strings.HasPrefix(alg, "PS"):
+		_, ok := key.(*rsa.PublicKey)
+		return ok
+	case strings.HasPrefix(alg, "ES"):
+		pub, ok := key.(*ecdsa.PublicKey)
+		return ok && pub.Curve.Params().BitSize == esCurveBits[alg]
+	case alg == "EdDSA":
+		_, ok := key.(ed25519.PublicKey)
+		return ok
+	case strings.HasPrefix(alg, "HS"):
+		_, ok := key.([]byte)
+		return ok
+	}
+	return true
+}
+
+var esCurveBits = map[string]int{"ES256": 256, "ES384": 384, "ES512": 521}
+
+func parserOptions(opts Options) []jwt.ParserOption {
+	var parserOpts []jwt.ParserOption
+	if len(opts.Audience) > 0 {
+		parserOpts = append(parserOpts, jwt.WithAudience(opts.Audience...))
+	}
+	if opts.Issuer != "" {
+		parserOpts = append(parserOpts, jwt.WithIssuer(opts.Issuer))
+	}
+	if opts.Leeway > 0 {
+		parserOpts = append(parserOpts, jwt.WithLeeway(opts.Leeway))
+	}
+	return append(parserOpts, opts.ParserOptions...)
+}
+
+// decrypt returns the inner JWS of a compact JWE, which has five segments
+// instead of the three of a JWS.
+func decrypt(tokenStr string, opts Options) (string, *AuthError) {
+	if opts.Decrypter == nil || strings.Count(tokenStr, ".") != 4 {
+		return tokenStr, nil
+	}
+
+	jws, err := opts.Decrypter.Decrypt(tokenStr)
+	if err != nil {
+		return "", ErrDecryptFailed.wrap(err)
+	}
+	return jws, nil
+}
+
+func parseError(err error) *AuthError {
+	var authErr *AuthError
+	if errors.As(err, &authErr) {
+		return authErr
+	}
+
+	sentinel := ErrInvalidToken
+	switch {
+	case errors.Is(err, jwt.ErrTokenMalformed):
+		sentinel = ErrMalformedToken
+	case errors.Is(err, jwt.ErrTokenUnverifiable):
+		sentinel = ErrUnverifiableToken
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid):
+		sentinel = ErrInvalidSignature
+	case errors.Is(err, jwt.ErrTokenExpired):
+		sentinel = ErrTokenExpired
+	case errors.Is(err, jwt.ErrTokenNotValidYet):
+		sentinel = ErrTokenNotValidYet
+	case errors.Is(err, jwt.ErrTokenInvalidAudience):
+		sentinel = ErrInvalidAudience
+	case errors.Is(err, jwt.ErrTokenInvalidIssuer):
+		sentinel = ErrInvalidIssuer
+	}
+	return sentinel.wrap(err)
+}
+
+func checkTokenAge(claims jwt.Claims, opts Options) *AuthError {
+	if opts.MaxTokenAge <= 0 || opts.claimsUnchecked {
+		return nil
+	}
+
+	iat, err := claims.GetIssuedAt()
+	if err != nil {
+		return ErrInvalidToken.wrap(err)
+	}
+	if iat == nil {
+		if opts.AllowMissingIssuedAt {
+			return nil
+		}
+		return ErrMissingIssuedAt
+	}
+
+	if time.Since(iat.Time) > opts.MaxTokenAge {
+		return ErrTokenTooOld
+	}
+	return nil
+}
+
+// coercedDates remembers the issuer and claim pairs already reported by
+// coerceNumericDates, so a misbehaving issuer is logged once, not per token.
+var coercedDates sync.Map
+
+// coerceNumericDates replaces string exp, nbf and iat values of MapClaims
+// with their number, for LenientNumericDates. A string that is not a
+// number is rejected as ErrMalformedToken.
+func coerceNumericDates(claims jwt.Claims) *AuthError {
+	m, ok := claims.(jwt.MapClaims)
+	if !ok {
+		return nil
+	}
+	for _, name := range []string{"exp", "nbf", "iat"} {
+		s, ok := m[name].(string)
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			return ErrMalformedToken.wrap(errors.New(name + " is not a numeric date"))
+		}
+		m[name] = n
+		iss, _ := m["iss"].(string)
+		if _, seen := coercedDates.LoadOrStore(iss+"\x00"+name, true); !seen {
+			log.Printf("[go-middle] WARNING: issuer %q sends %s as a string, accepted by LenientNumericDates", iss, name)
+		}
+	}
+	return nil
+}
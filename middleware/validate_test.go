@@ -0,0 +1,451 @@
+package middleware
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// expectErr validates tokenStr with opts and checks the error against want,
+// nil meaning the token must be accepted.
+func expectErr(t *testing.T, name, tokenStr string, opts Options, want *AuthError) {
+	t.Helper()
+	_, err := Validate(context.Background(), tokenStr, opts)
+	switch {
+	case want == nil && err != nil:
+		t.Errorf("%s: rejected with %v", name, err)
+	case want != nil && !errors.Is(err, want):
+		t.Errorf("%s: err = %v, want %s", name, err, want.Code)
+	}
+}
+
+func ago(d time.Duration) int64 {
+	return time.Now().Add(-d).Unix()
+}
+
+func TestMaxTokenAge(t *testing.T) {
+	opts := Options{Provider: newTestKeys(), MaxTokenAge: time.Hour}
+
+	for _, tc := range []struct {
+		name   string
+		claims jwt.MapClaims
+		want   *AuthError
+	}{
+		{"fresh", jwt.MapClaims{"iat": ago(time.Minute)}, nil},
+		{"just inside", jwt.MapClaims{"iat": ago(time.Hour - 5*time.Second)}, nil},
+		{"just outside", jwt.MapClaims{"iat": ago(time.Hour + 5*time.Second)}, ErrTokenTooOld},
+		{"without iat", jwt.MapClaims{}, ErrMissingIssuedAt},
+		{"malformed iat", jwt.MapClaims{"iat": "yesterday"}, ErrInvalidToken},
+	} {
+		tc.claims["sub"] = "alice"
+		expectErr(t, tc.name, sign(t, tc.claims), opts, tc.want)
+	}
+}
+
+func TestMaxTokenAgeIgnoresLongExp(t *testing.T) {
+	opts := Options{Provider: newTestKeys(), MaxTokenAge: time.Hour}
+	tokenStr := sign(t, jwt.MapClaims{"iat": ago(2 * time.Hour), "exp": time.Now().Add(24 * time.Hour).Unix()})
+	expectErr(t, "long-lived", tokenStr, opts, ErrTokenTooOld)
+}
+
+func TestAllowMissingIssuedAt(t *testing.T) {
+	opts := Options{Provider: newTestKeys(), MaxTokenAge: time.Hour, AllowMissingIssuedAt: true}
+	expectErr(t, "without iat", sign(t, jwt.MapClaims{"sub": "alice"}), opts, nil)
+	expectErr(t, "old iat", sign(t, jwt.MapClaims{"iat": ago(2 * time.Hour)}), opts, ErrTokenTooOld)
+}
+
+func TestMaxTokenAgeAppliesToCacheHits(t *testing.T) {
+	keys, cache := newTestKeys(), NewMemoryCache(0)
+	tokenStr := sign(t, jwt.MapClaims{"iat": ago(30 * time.Minute)})
+	opts := Options{Provider: keys, TokenCache: cache, MaxTokenAge: time.Hour}
+	expectErr(t, "first", tokenStr, opts, nil)
+
+	opts.MaxTokenAge = 10 * time.Minute
+	expectErr(t, "cached", tokenStr, opts, ErrTokenTooOld)
+}
+
+func TestValidateWithoutProvider(t *testing.T) {
+	expectErr(t, "no provider", sign(t, jwt.MapClaims{}), Options{}, ErrNoKeyProvider)
+}
+
+func in(d time.Duration) int64 {
+	return time.Now().Add(d).Unix()
+}
+
+func TestLeeway(t *testing.T) {
+	opts := Options{Provider: newTestKeys(), Leeway: time.Minute}
+
+	for _, tc := range []struct {
+		name   string
+		claims jwt.MapClaims
+		want   *AuthError
+	}{
+		{"exp within leeway", jwt.MapClaims{"exp": ago(50 * time.Second)}, nil},
+		{"exp past leeway", jwt.MapClaims{"exp": ago(70 * time.Second)}, ErrTokenExpired},
+		{"nbf within leeway", jwt.MapClaims{"nbf": in(50 * time.Second)}, nil},
+		{"nbf past leeway", jwt.MapClaims{"nbf": in(70 * time.Second)}, ErrTokenNotValidYet},
+	} {
+		expectErr(t, tc.name, sign(t, tc.claims), opts, tc.want)
+	}
+}
+
+func TestNotBeforeLeeway(t *testing.T) {
+	opts := Options{Provider: newTestKeys(), NotBeforeLeeway: 10 * time.Second}
+
+	for _, tc := range []struct {
+		name   string
+		claims jwt.MapClaims
+		want   *AuthError
+	}{
+		{"nbf just ahead", jwt.MapClaims{"nbf": in(5 * time.Second)}, nil},
+		{"nbf too far ahead", jwt.MapClaims{"nbf": in(20 * time.Second)}, ErrTokenNotValidYet},
+		{"just expired", jwt.MapClaims{"exp": ago(5 * time.Second)}, ErrTokenExpired},
+	} {
+		expectErr(t, tc.name, sign(t, tc.claims), opts, tc.want)
+	}
+}
+
+func TestNotBeforeLeewayAddsToLeeway(t *testing.T) {
+	opts := Options{Provider: newTestKeys(), Leeway: 10 * time.Second, NotBeforeLeeway: 10 * time.Second}
+	expectErr(t, "combined", sign(t, jwt.MapClaims{"nbf": in(15 * time.Second)}), opts, nil)
+	expectErr(t, "past both", sign(t, jwt.MapClaims{"nbf": in(30 * time.Second)}), opts, ErrTokenNotValidYet)
+}
+
+func TestNotBeforeLeewayWithTypedClaims(t *testing.T) {
+	opts := Options{Provider: newTestKeys(), NotBeforeLeeway: 10 * time.Second}
+	tokenStr := sign(t, jwt.MapClaims{"nbf": in(5 * time.Second)})
+
+	var claims jwt.RegisteredClaims
+	if err := validateTyped(context.Background(), tokenStr, &claims, opts); err != nil {
+		t.Fatalf("rejected with %v", err)
+	}
+}
+
+// fixedKey is a KeyProvider resolving every token to key.
+type fixedKey struct{ key interface{} }
+
+func (k fixedKey) Key(*jwt.Token) (interface{}, error) { return k.key, nil }
+
+func signWith(t *testing.T, method jwt.SigningMethod, key interface{}) string {
+	t.Helper()
+	tokenStr, err := jwt.NewWithClaims(method, jwt.MapClaims{"sub": "alice"}).SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tokenStr
+}
+
+func TestAlgorithmKeyMismatch(t *testing.T) {
+	p256, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	p384, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	edPub, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	algs := []string{"RS256", "PS256", "ES256", "ES384", "HS256", "EdDSA"}
+
+	for _, tc := range []struct {
+		name     string
+		tokenStr string
+		key      interface{}
+		want     *AuthError
+	}{
+		{"ES256 token, RSA key", signWith(t, jwt.SigningMethodES256, p256), &testKey.PublicKey, ErrAlgorithmKeyMismatch},
+		{"HS256 token, RSA key", signWith(t, jwt.SigningMethodHS256, secret), &testKey.PublicKey, ErrAlgorithmKeyMismatch},
+		{"RS256 token, EC key", signWith(t, jwt.SigningMethodRS256, testKey), &p256.PublicKey, ErrAlgorithmKeyMismatch},
+		{"ES384 token, P-256 key", signWith(t, jwt.SigningMethodES384, p384), &p256.PublicKey, ErrAlgorithmKeyMismatch},
+		{"EdDSA token, EC key", signWith(t, jwt.SigningMethodEdDSA, edKey), &p256.PublicKey, ErrAlgorithmKeyMismatch},
+		{"mixed key set", signWith(t, jwt.SigningMethodRS256, testKey), jwt.VerificationKeySet{Keys: []jwt.VerificationKey{&testKey.PublicKey, &p256.PublicKey}}, ErrAlgorithmKeyMismatch},
+		{"RS256", signWith(t, jwt.SigningMethodRS256, testKey), &testKey.PublicKey, nil},
+		{"PS256", signWith(t, jwt.SigningMethodPS256, testKey), &testKey.PublicKey, nil},
+		{"ES256", signWith(t, jwt.SigningMethodES256, p256), &p256.PublicKey, nil},
+		{"ES384", signWith(t, jwt.SigningMethodES384, p384), &p384.PublicKey, nil},
+		{"HS256", signWith(t, jwt.SigningMethodHS256, secret), secret, nil},
+		{"EdDSA", signWith(t, jwt.SigningMethodEdDSA, edKey), edPub, nil},
+	} {
+		expectErr(t, tc.name, tc.tokenStr, Options{Provider: fixedKey{tc.key}, Algorithms: algs}, tc.want)
+	}
+}
+
+func TestAlgorithmsAllowlist(t *testing.T) {
+	opts := Options{Provider: newTestKeys(), Algorithms: []string{"ES256"}}
+	expectErr(t, "RS256 not allowed", sign(t, jwt.MapClaims{}), opts, ErrInvalidAlgorithm)
+}
+
+func TestAudience(t *testing.T) {
+	opts := Options{Provider: newTestKeys(), Audience: []string{"api", "admin"}}
+	expectErr(t, "listed", sign(t, jwt.MapClaims{"aud": "api"}), opts, nil)
+	expectErr(t, "one of many", sign(t, jwt.MapClaims{"aud": []string{"web", "admin"}}), opts, nil)
+	expectErr(t, "unlisted", sign(t, jwt.MapClaims{"aud": "web"}), opts, ErrInvalidAudience)
+	expectErr(t, "missing", sign(t, jwt.MapClaims{}), opts, ErrInvalidToken)
+}
+
+func TestValidate(t *testing.T) {
+	claims, err := Validate(context.Background(), sign(t, jwt.MapClaims{"sub": "alice"}), Options{Provider: newTestKeys()})
+	if err != nil || claims["sub"] != "alice" {
+		t.Fatalf("claims = %v, err = %v", claims, err)
+	}
+
+	for name, tokenStr := range map[string]string{
+		"malformed": "not-a-token",
+		"unsigned":  sign(t, jwt.MapClaims{"sub": "alice"})[:10],
+	} {
+		_, err := Validate(context.Background(), tokenStr, Options{Provider: newTestKeys()})
+		var authErr *AuthError
+		if !errors.As(err, &authErr) {
+			t.Errorf("%s: err = %#v, want an *AuthError", name, err)
+		}
+	}
+}
+
+func TestValidateIgnoresEnv(t *testing.T) {
+	t.Setenv("JWT_AUDIENCE", "api")
+	t.Setenv("JWT_ISSUER", "https://auth.example.com")
+	expectErr(t, "env", sign(t, jwt.MapClaims{"sub": "alice"}), Options{Provider: newTestKeys()}, nil)
+}
+
+func TestMaxTokenBytes(t *testing.T) {
+	tokenStr := sign(t, jwt.MapClaims{"sub": "alice", "pad": strings.Repeat("x", DefaultMaxTokenBytes)})
+	small := sign(t, jwt.MapClaims{"sub": "alice"})
+
+	expectErr(t, "default limit", tokenStr, Options{Provider: newTestKeys()}, ErrTokenTooLarge)
+	expectErr(t, "raised limit", tokenStr, Options{Provider: newTestKeys(), MaxTokenBytes: 2 * DefaultMaxTokenBytes}, nil)
+	expectErr(t, "disabled", tokenStr, Options{Provider: newTestKeys(), MaxTokenBytes: -1}, nil)
+	expectErr(t, "at the limit", small, Options{Provider: newTestKeys(), MaxTokenBytes: len(small)}, nil)
+	expectErr(t, "one over", small, Options{Provider: newTestKeys(), MaxTokenBytes: len(small) - 1}, ErrTokenTooLarge)
+}
+
+func TestTokenTooLargeStatus(t *testing.T) {
+	verify := VerifyTokenWithOptions(Options{Provider: newTestKeys(), MaxTokenBytes: 16})
+	if w := serve(sign(t, jwt.MapClaims{"sub": "alice"}), verify); w.Code != http.StatusBadRequest {
+		t.Fatalf("status %d, want 400", w.Code)
+	}
+}
+
+func TestRSAPSS(t *testing.T) {
+	provider := fixedKey{&testKey.PublicKey}
+	for _, method := range []jwt.SigningMethod{jwt.SigningMethodPS256, jwt.SigningMethodPS384, jwt.SigningMethodPS512} {
+		expectErr(t, method.Alg(), signWith(t, method, testKey), Options{Provider: provider}, nil)
+	}
+
+	psOnly := Options{Provider: provider, Algorithms: []string{"PS256"}}
+	expectErr(t, "PS256 only, PS256", signWith(t, jwt.SigningMethodPS256, testKey), psOnly, nil)
+	expectErr(t, "PS256 only, RS256", signWith(t, jwt.SigningMethodRS256, testKey), psOnly, ErrInvalidAlgorithm)
+	expectErr(t, "PS256 other key", signWith(t, jwt.SigningMethodPS256, otherKey), psOnly, ErrInvalidSignature)
+}
+
+func TestDebugToken(t *testing.T) {
+	valid, header, claims, err := DebugToken(sign(t, jwt.MapClaims{"sub": "alice"}), newTestKeys())
+	if !valid || err != nil || header["kid"] != "k1" || claims["sub"] != "alice" {
+		t.Fatalf("valid token: %v, %v, %v, %v", valid, header, claims, err)
+	}
+
+	valid, header, claims, err = DebugToken(sign(t, jwt.MapClaims{"sub": "alice", "exp": ago(time.Hour)}), newTestKeys())
+	if valid || !errors.Is(err, ErrTokenExpired) || header["alg"] != "RS256" || claims["sub"] != "alice" {
+		t.Fatalf("expired token: %v, %v, %v, %v", valid, header, claims, err)
+	}
+
+	valid, _, claims, err = DebugToken(signWith(t, jwt.SigningMethodRS256, otherKey), fixedKey{&testKey.PublicKey})
+	if valid || !errors.Is(err, ErrInvalidSignature) || claims["sub"] != "alice" {
+		t.Fatalf("bad signature: %v, %v, %v", valid, claims, err)
+	}
+
+	valid, header, claims, err = DebugToken("not-a-token", newTestKeys())
+	if valid || !errors.Is(err, ErrMalformedToken) || header != nil || claims != nil {
+		t.Fatalf("garbage: %v, %v, %v, %v", valid, header, claims, err)
+	}
+
+	if _, _, _, err := DebugToken("x", nil); !errors.Is(err, ErrNoKeyProvider) {
+		t.Fatalf("nil provider: err = %v", err)
+	}
+}
+
+func TestValidateBatch(t *testing.T) {
+	tokens := make([]string, 20)
+	for i := range tokens {
+		tokens[i] = sign(t, jwt.MapClaims{"sub": strconv.Itoa(i)})
+	}
+	tokens[7] = "not-a-token"
+
+	results := ValidateBatch(context.Background(), tokens, Options{Provider: newTestKeys()})
+	if len(results) != len(tokens) {
+		t.Fatalf("%d results for %d tokens", len(results), len(tokens))
+	}
+	for i, r := range results {
+		switch {
+		case i == 7 && !errors.Is(r.Err, ErrMalformedToken):
+			t.Errorf("result 7: err = %v, want ErrMalformedToken", r.Err)
+		case i != 7 && (r.Err != nil || r.Claims["sub"] != strconv.Itoa(i)):
+			t.Errorf("result %d: claims = %v, err = %v", i, r.Claims, r.Err)
+		}
+	}
+}
+
+func TestValidateBatchCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	results := ValidateBatch(ctx, []string{sign(t, jwt.MapClaims{}), sign(t, jwt.MapClaims{})}, Options{Provider: newTestKeys()})
+	for i, r := range results {
+		if !errors.Is(r.Err, context.Canceled) {
+			t.Errorf("result %d: err = %v, want context.Canceled", i, r.Err)
+		}
+	}
+}
+
+func TestValidateBatchEmpty(t *testing.T) {
+	if results := ValidateBatch(context.Background(), nil, Options{Provider: newTestKeys()}); len(results) != 0 {
+		t.Fatalf("results = %v", results)
+	}
+}
+
+func TestRequiredClaims(t *testing.T) {
+	opts := Options{Provider: newTestKeys(), RequiredClaims: []string{"sub", "jti"}}
+	expectErr(t, "present", sign(t, jwt.MapClaims{"sub": "alice", "jti": "1"}), opts, nil)
+	expectErr(t, "missing", sign(t, jwt.MapClaims{"sub": "alice"}), opts, ErrMissingRequiredClaim)
+	expectErr(t, "empty", sign(t, jwt.MapClaims{"sub": "", "jti": "1"}), opts, ErrMissingRequiredClaim)
+	expectErr(t, "empty array", sign(t, jwt.MapClaims{"sub": "alice", "jti": []string{}}), opts, ErrMissingRequiredClaim)
+}
+
+func TestRequiredClaimsNamesMissingClaim(t *testing.T) {
+	verify := VerifyTokenWithOptions(Options{Provider: newTestKeys(), RequiredClaims: []string{"sub", "jti"}})
+	w := serve(sign(t, jwt.MapClaims{"sub": "alice"}), verify)
+
+	got := body(t, w.Body.Bytes())
+	if got["code"] != ErrMissingRequiredClaim.Code || got["error"] != "missing required claim: jti" {
+		t.Fatalf("body = %v", got)
+	}
+	if ErrMissingRequiredClaim.Message != "missing required claim" {
+		t.Fatalf("sentinel message changed to %q", ErrMissingRequiredClaim.Message)
+	}
+}
+
+func TestValidationTimeout(t *testing.T) {
+	slow := RevocationFunc(func(ctx context.Context, claims jwt.MapClaims) (bool, error) {
+		<-ctx.Done()
+		return false, ctx.Err()
+	})
+	opts := Options{Provider: newTestKeys(), Revocation: slow, ValidationTimeout: 10 * time.Millisecond}
+
+	start := time.Now()
+	expectErr(t, "slow revocation", sign(t, jwt.MapClaims{"sub": "alice"}), opts, ErrValidationTimeout)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("validation took %v", elapsed)
+	}
+}
+
+// signHeader signs a token for alice with the extra header parameters.
+func signHeader(t *testing.T, header map[string]any) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{"sub": "alice", "exp": in(time.Hour)})
+	token.Header["kid"] = "k1"
+	for k, v := range header {
+		token.Header[k] = v
+	}
+	tokenStr, err := token.SignedString(testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tokenStr
+}
+
+func TestCriticalHeaders(t *testing.T) {
+	opts := Options{Provider: newTestKeys(), AllowedCriticalHeaders: []string{"urn:example:policy"}}
+
+	for _, tc := range []struct {
+		name   string
+		header map[string]any
+		want   *AuthError
+	}{
+		{"no crit", nil, nil},
+		{"allowlisted", map[string]any{"crit": []string{"urn:example:policy"}, "urn:example:policy": "p1"}, nil},
+		{"unknown", map[string]any{"crit": []string{"exp"}, "exp": 1}, ErrCriticalHeader},
+		{"one unknown of two", map[string]any{"crit": []string{"urn:example:policy", "urn:other"}, "urn:example:policy": "p1", "urn:other": true}, ErrCriticalHeader},
+		{"listed but absent", map[string]any{"crit": []string{"urn:example:policy"}}, ErrCriticalHeader},
+		{"registered name", map[string]any{"crit": []string{"kid"}}, ErrCriticalHeader},
+		{"empty", map[string]any{"crit": []string{}}, ErrCriticalHeader},
+		{"not an array", map[string]any{"crit": "urn:example:policy", "urn:example:policy": "p1"}, ErrCriticalHeader},
+		{"b64 without AllowUnencodedPayload", map[string]any{"crit": []string{"b64"}, "b64": true}, ErrCriticalHeader},
+	} {
+		expectErr(t, tc.name, signHeader(t, tc.header), opts, tc.want)
+	}
+
+	opts.AllowUnencodedPayload = true
+	expectErr(t, "b64 with AllowUnencodedPayload", signHeader(t, map[string]any{"crit": []string{"b64"}, "b64": true}), opts, nil)
+}
+
+func TestLenientNumericDates(t *testing.T) {
+	opts := Options{Provider: newTestKeys(), LenientNumericDates: true, MaxTokenAge: time.Hour}
+	str := func(unix int64) string { return strconv.FormatInt(unix, 10) }
+
+	for _, tc := range []struct {
+		name     string
+		claims   jwt.MapClaims
+		want     *AuthError
+		strictOK bool
+	}{
+		{"numeric", jwt.MapClaims{"exp": in(time.Hour)}, nil, true},
+		{"string exp", jwt.MapClaims{"exp": str(in(time.Hour))}, nil, false},
+		{"padded string", jwt.MapClaims{"exp": " " + str(in(time.Hour)) + " "}, nil, false},
+		{"fractional string", jwt.MapClaims{"exp": str(in(time.Hour)) + ".5"}, nil, false},
+		{"expired string", jwt.MapClaims{"exp": str(ago(time.Hour))}, ErrTokenExpired, false},
+		{"future nbf string", jwt.MapClaims{"nbf": str(in(time.Hour))}, ErrTokenNotValidYet, false},
+		{"fresh iat string", jwt.MapClaims{"iat": str(ago(time.Minute))}, nil, false},
+		{"old iat string", jwt.MapClaims{"iat": str(ago(2 * time.Hour))}, ErrTokenTooOld, false},
+		{"not a number", jwt.MapClaims{"exp": "tomorrow"}, ErrMalformedToken, false},
+	} {
+		tc.claims["sub"] = "alice"
+		if _, ok := tc.claims["iat"]; !ok {
+			tc.claims["iat"] = ago(time.Minute)
+		}
+		tokenStr := sign(t, tc.claims)
+		expectErr(t, tc.name, tokenStr, opts, tc.want)
+
+		strict := opts
+		strict.LenientNumericDates = false
+		if _, err := Validate(context.Background(), tokenStr, strict); (err == nil) != tc.strictOK {
+			t.Errorf("%s without LenientNumericDates: err = %v", tc.name, err)
+		}
+	}
+}
+
+func TestLenientNumericDatesStoresNumbers(t *testing.T) {
+	exp := in(time.Hour)
+	claims, err := Validate(context.Background(), sign(t, jwt.MapClaims{"sub": "alice", "exp": strconv.FormatInt(exp, 10)}),
+		Options{Provider: newTestKeys(), LenientNumericDates: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := claims.GetExpirationTime(); err != nil || got.Unix() != exp {
+		t.Fatalf("exp = %v, %v, want %d", got, err, exp)
+	}
+}
+
+func TestLenientNumericDatesLogsOnce(t *testing.T) {
+	var buf strings.Builder
+	prev := log.Writer()
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(prev) })
+
+	// Warnings are remembered per process, so every run needs a new issuer.
+	issuer := "https://lenient.example.com/" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	opts := Options{Provider: newTestKeys(), LenientNumericDates: true}
+	for range 3 {
+		tokenStr := sign(t, jwt.MapClaims{"sub": "alice", "iss": issuer, "exp": strconv.FormatInt(in(time.Hour), 10)})
+		if _, err := Validate(context.Background(), tokenStr, opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := strings.Count(buf.String(), strconv.Quote(issuer)+" sends exp"); n != 1 {
+		t.Fatalf("logged %d times, want once:\n%s", n, buf.String())
+	}
+}
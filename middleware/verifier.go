@@ -0,0 +1,32 @@
+package middleware
+
+import "github.com/golang-jwt/jwt/v5"
+
+// SignatureVerifier checks a JWS signature in place of the jwt signing
+// method named by alg, for Options.SignatureVerifier. signingInput is the
+// encoded header and payload joined by a dot, sig the decoded signature and
+// key the value returned by the Provider, already checked against alg; for a
+// jwt.VerificationKeySet Verify is called once per key until one succeeds.
+// A nil error accepts the signature. Verify is called concurrently.
+type SignatureVerifier interface {
+	Verify(alg, signingInput string, sig []byte, key interface{}) error
+}
+
+// SignatureVerifierFunc adapts a function to SignatureVerifier.
+type SignatureVerifierFunc func(alg, signingInput string, sig []byte, key interface{}) error
+
+func (f SignatureVerifierFunc) Verify(alg, signingInput string, sig []byte, key interface{}) error {
+	return f(alg, signingInput, sig, key)
+}
+
+// verifierMethod routes the signature check of a parsed token to a
+// SignatureVerifier. keyfunc swaps it in for the token's signing method,
+// which the parser consults only after the key is resolved.
+type verifierMethod struct {
+	jwt.SigningMethod
+	verifier SignatureVerifier
+}
+
+func (m verifierMethod) Verify(signingInput string, sig []byte, key interface{}) error {
+	return m.verifier.Verify(m.Alg(), signingInput, sig, key)
+}
@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// countingVerifier delegates to the jwt signing method of alg, recording
+// the calls and the last key it was given.
+type countingVerifier struct {
+	calls atomic.Int32
+	alg   atomic.Value
+}
+
+func (v *countingVerifier) Verify(alg, signingInput string, sig []byte, key interface{}) error {
+	v.calls.Add(1)
+	v.alg.Store(alg)
+	return jwt.GetSigningMethod(alg).Verify(signingInput, sig, key)
+}
+
+func TestSignatureVerifier(t *testing.T) {
+	verifier := &countingVerifier{}
+	opts := Options{Provider: newTestKeys(), SignatureVerifier: verifier}
+	tokenStr := sign(t, jwt.MapClaims{"sub": "alice"})
+
+	claims, err := Validate(context.Background(), tokenStr, opts)
+	if err != nil || claims["sub"] != "alice" {
+		t.Fatalf("claims = %v, err = %v", claims, err)
+	}
+	if verifier.calls.Load() != 1 || verifier.alg.Load() != "RS256" {
+		t.Fatalf("calls = %d, alg = %v", verifier.calls.Load(), verifier.alg.Load())
+	}
+
+	tampered := tokenStr[:len(tokenStr)-4] + "AAAA"
+	expectErr(t, "tampered", tampered, opts, ErrInvalidSignature)
+	if verifier.calls.Load() != 2 {
+		t.Fatalf("calls = %d, want 2", verifier.calls.Load())
+	}
+}
+
+func TestSignatureVerifierDecides(t *testing.T) {
+	reject := SignatureVerifierFunc(func(string, string, []byte, interface{}) error { return errors.New("accelerator says no") })
+	expectErr(t, "rejecting verifier", sign(t, jwt.MapClaims{"sub": "alice"}), Options{Provider: newTestKeys(), SignatureVerifier: reject}, ErrInvalidSignature)
+}
+
+func TestSignatureVerifierAfterAlgorithmChecks(t *testing.T) {
+	verifier := &countingVerifier{}
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tokenStr := signWith(t, jwt.SigningMethodES256, ecKey)
+
+	expectErr(t, "ES256 token on RSA key", tokenStr, Options{Provider: fixedKey{&testKey.PublicKey}, SignatureVerifier: verifier}, ErrAlgorithmKeyMismatch)
+	if verifier.calls.Load() != 0 {
+		t.Fatalf("verifier called %d times for a mismatched key", verifier.calls.Load())
+	}
+}
+
+func TestSignatureVerifierKeySet(t *testing.T) {
+	verifier := &countingVerifier{}
+	set := jwt.VerificationKeySet{Keys: []jwt.VerificationKey{&otherKey.PublicKey, &testKey.PublicKey}}
+	expectErr(t, "second key", sign(t, jwt.MapClaims{"sub": "alice"}), Options{Provider: fixedKey{set}, SignatureVerifier: verifier}, nil)
+	if verifier.calls.Load() != 2 {
+		t.Fatalf("calls = %d, want one per key", verifier.calls.Load())
+	}
+}
+
+// The per-token cost is parsing and the signature check: the key is parsed
+// once by its provider, not per request.
+func BenchmarkValidate(b *testing.B) {
+	claims := jwt.MapClaims{"sub": "alice"}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "k1"
+	tokenStr, err := token.SignedString(testKey)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for name, opts := range map[string]Options{
+		"default":           {Provider: newTestKeys()},
+		"SignatureVerifier": {Provider: newTestKeys(), SignatureVerifier: &countingVerifier{}},
+	} {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for range b.N {
+				if _, err := Validate(context.Background(), tokenStr, opts); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -1,7 +1,10 @@
 package middleware
 
 import (
-	"net/http"
+	"errors"
+	"log"
+	"net"
+	"strconv"
 	"strings"
 	"time"
 
@@ -11,53 +14,543 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// StaleMode controls requests while the key provider reports stale keys.
+type StaleMode int
+
+const (
+	// StaleAllow keeps verifying with the last known keys.
+	StaleAllow StaleMode = iota
+	// StaleDegrade verifies as usual but marks the request with the
+	// X-Auth-Degraded header and, in Gin, the Degraded accessor.
+	StaleDegrade
+	// StaleReject responds 503 until the keys are refreshed.
+	StaleReject
+)
+
 type Options struct {
 	PublicKeyURL string
 	RefreshEvery time.Duration
-}
+	// BackgroundKeyLoad fetches the PublicKeyURL key in the background
+	// instead of failing construction when the key server is unreachable.
+	// Until the first fetch succeeds requests get ErrKeysNotReady (503)
+	// with Retry-After, as with any provider whose Key returns
+	// crypto.ErrNotReady.
+	BackgroundKeyLoad bool
+	// PinnedFingerprints restricts the PublicKeyURL key to these SHA-256
+	// fingerprints, see crypto.RemotePublicKeyOptions.
+	PinnedFingerprints []string
+	// Provider resolves verification keys; when set PublicKeyURL is ignored.
+	Provider crypto.KeyProvider
 
-func VerifyToken() gin.HandlerFunc {
+	// StaleMode applies when Provider implements crypto.StaleChecker and
+	// reports stale keys. Defaults to StaleAllow.
+	StaleMode StaleMode
 
-	utils.LoadEnv()
+	// EnvOverride lets PUBLIC_KEY_URL and JWT_* env values replace the
+	// options set here. By default options win and env only fills gaps.
+	// When Provider is set, env is only read with EnvOverride.
+	EnvOverride bool
 
-	publicKeyURL := utils.GetEnv("PUBLIC_KEY_URL")
-	if publicKeyURL == "" {
-		panic("[go-middle] PUBLIC_KEY_URL is required in .env")
-	}
+	// Algorithms restricts accepted alg header values, e.g. []string{"RS256"}.
+	Algorithms []string
+	// DeprecatedAlgorithms are still accepted but reported to AuditLogger as
+	// deprecated_algorithm events, to plan a migration such as RS256 to ES256.
+	// RejectDeprecated turns them into ErrDeprecatedAlgorithm rejections.
+	DeprecatedAlgorithms []string
+	RejectDeprecated     bool
+	// SignatureVerifier replaces the signature check of the jwt signing
+	// methods, e.g. to offload RSA verification to an accelerator. It runs
+	// after the algorithm checks with the key resolved by Provider.
+	SignatureVerifier SignatureVerifier
+	// Audience lists accepted aud values; a token matching any of them passes.
+	Audience []string
+	// Issuer is the required iss value.
+	Issuer string
 
-	remoteKey, err := crypto.NewRemotePublicKey(publicKeyURL, 5*time.Minute)
-	if err != nil {
-		panic("[go-middle] failed loading remote public key: " + err.Error())
-	}
+	// Leeway tolerates clock skew on exp, nbf and iat.
+	Leeway time.Duration
+	// NotBeforeLeeway is added to Leeway for the nbf check only, to accept
+	// tokens from an issuer whose clock runs ahead without relaxing exp.
+	NotBeforeLeeway time.Duration
+	// LenientNumericDates accepts exp, nbf and iat sent as JSON strings such
+	// as "1700000000", which RFC 7519 does not allow, converting them before
+	// the time checks and logging each issuer and claim once. Only supported
+	// with jwt.MapClaims.
+	LenientNumericDates bool
+	// GraceLeeway is added to Leeway for requests whose method is listed in
+	// GraceMethods, e.g. to accept just-expired tokens on GET but not POST.
+	GraceLeeway  time.Duration
+	GraceMethods []string
+
+	// MaxTokenBytes rejects larger tokens before parsing. Defaults to
+	// DefaultMaxTokenBytes; a negative value disables the limit.
+	MaxTokenBytes int
+
+	// MaxTokenAge rejects tokens whose iat is older than this, regardless of exp.
+	MaxTokenAge time.Duration
+	// AllowMissingIssuedAt accepts tokens without iat when MaxTokenAge is set.
+	AllowMissingIssuedAt bool
+
+	// SubjectClaim names the claim holding the user ID, e.g. "oid" or
+	// "user_id". It feeds Subject, RateLimitBySubject, the "sub" entry of
+	// InjectIdentityHeaders and audit events. Defaults to "sub".
+	SubjectClaim string
+
+	// RequiredScopes and RequiredRoles are enforced by Protect after
+	// verification, see RequireScopes and RequireRoles.
+	RequiredScopes []string
+	RequiredRoles  []string
+
+	// RequiredClaims lists claims that must be present and non-empty, e.g.
+	// []string{"sub", "iat", "exp"}. The first missing one is named in the
+	// missing_required_claim error.
+	RequiredClaims []string
+
+	// Validator runs on verified jwt.MapClaims. Returning an *AuthError uses
+	// that error in the response, any other error is reported as
+	// ErrClaimsRejected.
+	Validator func(claims jwt.MapClaims) error
+
+	// ClaimsTransform normalizes provider specific claims into a canonical
+	// shape, e.g. emails[0] into email, before they are stored in the
+	// context, so handlers and the Require* middlewares see the same keys.
+	// It runs on already verified claims and receives a copy it may modify;
+	// returning nil rejects the request with ErrClaimsRejected.
+	ClaimsTransform func(claims jwt.MapClaims) jwt.MapClaims
+
+	// Revocation is consulted for every verified token, including cached
+	// ones. A checker error rejects the request with 503 unless
+	// RevocationBreaker decides otherwise.
+	Revocation        RevocationChecker
+	RevocationBreaker *CircuitBreaker
+	// ValidationTimeout bounds the whole validation, including cache and
+	// revocation lookups; exceeding it responds 503 with code "timeout".
+	ValidationTimeout time.Duration
+
+	// DPoP requires sender-constrained tokens (RFC 9449): every token must
+	// carry cnf.jkt and come with a matching DPoP proof header. Both the
+	// "DPoP" and "Bearer" authorization schemes are accepted.
+	DPoP bool
+	// DPoPProofMaxAge bounds how far the proof iat may be from now.
+	// Defaults to 5 minutes.
+	DPoPProofMaxAge time.Duration
+
+	// MTLSBound requires certificate-bound tokens (RFC 8705): the token
+	// cnf.x5t#S256 must match the client certificate of the TLS connection.
+	// TLS must be terminated by this server for the certificate to be seen.
+	MTLSBound bool
+
+	// UserResolver maps verified claims to a domain object stored under the
+	// "user" context key, see User. An error rejects the request with 403.
+	UserResolver func(claims jwt.MapClaims) (any, error)
+
+	// TokenLookup lists where the token is read from, tried in order until a
+	// source has a value, e.g. "header:Authorization,cookie:access_token".
+	// Sources are header:<name>, cookie:<name> and query:<name>. The first
+	// non-empty source wins even if its token is invalid. Defaults to the
+	// Authorization header.
+	TokenLookup string
+
+	// CSRFClaim enables the double submit check for tokens read from a
+	// cookie: on unsafe methods the CSRFHeader value (default
+	// DefaultCSRFHeader) must equal this claim of the token, otherwise the
+	// request is rejected with ErrCSRFMismatch (403).
+	CSRFClaim  string
+	CSRFHeader string
+
+	// ContextPrefix namespaces the gin context keys ("claims", "subject",
+	// "user", "auth_degraded"), e.g. "auth." stores claims under
+	// "auth.claims". Accessors such as User and Subject follow it.
+	ContextPrefix string
+
+	// StripAuthHeader removes the Authorization header once the token is
+	// verified, so downstream handlers only see the claims.
+	StripAuthHeader bool
+
+	// SkipPaths bypasses verification for matching request paths, e.g.
+	// "/healthz" or "/public/*".
+	SkipPaths []string
+	// SkipIgnoreTrailingSlash treats "/healthz/" and "/healthz" as the same path.
+	SkipIgnoreTrailingSlash bool
+
+	// PreValidate runs before token extraction. skip=true bypasses
+	// verification; a non-nil error rejects the request.
+	PreValidate func(c *gin.Context) (skip bool, err error)
+	// ErrorHandler replaces the default JSON error response. The request is
+	// aborted after it returns.
+	ErrorHandler func(c *gin.Context, err error)
+	// MarshalError encodes error response bodies, e.g. with sonic or
+	// jsoniter. Falls back to the default encoder when nil or on error.
+	MarshalError func(v any) ([]byte, error)
+	// VerboseErrors adds the cause of token parse and validation errors as
+	// "detail" to error responses. Errors returned by hooks such as
+	// PreValidate or Validator are never shown. Meant for development; a
+	// warning is logged when it is set.
+	VerboseErrors bool
+	// DebugHeaders sets X-Auth-Subject and X-Auth-Scopes on the response of
+	// every authenticated request, for debugging proxies and test harnesses.
+	// NEVER enable it in production: it exposes identity data to anything
+	// that sees the response.
+	DebugHeaders bool
+
+	// AuditLogger receives an event for every rejected request, and for
+	// would-be rejections in DryRun mode.
+	AuditLogger func(e AuditEvent)
+	// ClientIPResolver returns the client address recorded in audit events.
+	// Defaults to gin's ClientIP, which depends on the engine trusted proxies.
+	ClientIPResolver func(c *gin.Context) string
+	// TrustedProxies lists proxy IPs or CIDRs whose X-Forwarded-For and
+	// X-Real-IP headers are believed, unless ClientIPResolver is set, and
+	// whose X-Forwarded-Proto is used for the DPoP htu check.
+	TrustedProxies []string
+	// MinTLSVersion, e.g. tls.VersionTLS12, rejects requests over older TLS
+	// or plain HTTP with ErrInsecureTransport (403) before the token is
+	// verified. RejectInsecureCiphers does the same for the cipher suites of
+	// tls.InsecureCipherSuites. Only meaningful when TLS terminates in the
+	// application.
+	MinTLSVersion         uint16
+	RejectInsecureCiphers bool
+	// AllowedCIDRs rejects authenticated requests whose client IP, resolved
+	// as for audit events, is outside every listed IP or CIDR, with
+	// ErrIPNotAllowed (403).
+	AllowedCIDRs []string
+	// DryRun runs every check but only audits claim failures, such as exp,
+	// aud or RequiredClaims: requests whose token signature is valid continue
+	// with their claims set. Tokens that are missing, too large, fail
+	// signature verification or revocation, or fail the DPoP, mTLS, CSRF or
+	// AllowedCIDRs checks are still rejected.
+	DryRun bool
+
+	// OnAuthSuccess and OnAuthFailure are metrics hooks, called once per
+	// request that goes through verification, before the response is written
+	// or the next handler runs. Skipped requests trigger neither, but call
+	// OnAuthSkipped before the next handler runs.
+	OnAuthSuccess func(c *gin.Context)
+	OnAuthFailure func(c *gin.Context, err error)
+	OnAuthSkipped func(c *gin.Context)
+	// OnAuthenticated is a business hook, e.g. to update a "last seen"
+	// timestamp. It runs synchronously after claims and user are set and
+	// before the next handler, so it should return quickly; hand slow work to
+	// a goroutine.
+	OnAuthenticated func(c *gin.Context, claims jwt.MapClaims)
+	// OnRefreshSuccess and OnRefreshFailure report the duration and size of
+	// each key fetch. They only apply to the provider built from
+	// PublicKeyURL; set them on the provider options otherwise.
+	OnRefreshSuccess func(stats crypto.RefreshStats)
+	OnRefreshFailure func(stats crypto.RefreshStats, err error)
+
+	// Decrypter unwraps JWE tokens before the inner JWS is verified. Tokens
+	// that are plain JWS are verified as usual.
+	Decrypter Decrypter
+
+	// TokenCache stores validated claims so repeated tokens skip parsing.
+	// Caching is enabled when TokenCache is set or CacheTTL is positive, in
+	// which case a MemoryCache is used by default.
+	TokenCache TokenCache
+	// CacheTTL caps how long a validated token stays cached; entries never
+	// outlive the token exp.
+	CacheTTL time.Duration
+
+	// AllowUnencodedPayload accepts JWS with "b64": false (RFC 7797), whose
+	// payload is the raw claims JSON instead of base64url. "b64" must be
+	// listed in crit. See VerifyDetached for payloads sent separately.
+	AllowUnencodedPayload bool
+	// AllowedCriticalHeaders lists crit header parameters the application
+	// processes itself, e.g. in a Validator. Tokens listing any other
+	// parameter in crit are rejected with ErrCriticalHeader, as RFC 7515
+	// requires.
+	AllowedCriticalHeaders []string
+	// ClaimPrecedence decides how claims replicated in the JWS header combine
+	// with the payload. The default PayloadOnly ignores them. Subject,
+	// scopes, roles and every other check read the combined claims, and
+	// after that the result of ClaimsTransform.
+	ClaimPrecedence ClaimPrecedence
 
+	// ParserOptions are appended after the options derived from the fields above.
+	ParserOptions []jwt.ParserOption
+
+	tokenLookup    []tokenSource
+	allowedNets    []*net.IPNet
+	trustedProxies []*net.IPNet
+	// dedicatedKey makes prepareOptions create an unshared provider that
+	// loads in the background, for NewAuthenticator.
+	dedicatedKey bool
+	// cacheScope is the TokenCache key suffix, computed once by
+	// prepareOptions.
+	cacheScope string
+	// claimsUnchecked makes parseToken skip the exp, nbf, iat, aud, iss and
+	// MaxTokenAge checks, for dryRunClaims.
+	claimsUnchecked bool
+}
+
+const DefaultMaxTokenBytes = 8 << 10
+
+func VerifyToken() gin.HandlerFunc {
+	return VerifyTokenWithOptions(Options{})
+}
+
+func VerifyTokenWithOptions(opts Options) gin.HandlerFunc {
+	return verifyHandler(resolveOptions(opts))
+}
+
+func verifyHandler(opts Options) gin.HandlerFunc {
 	return func(c *gin.Context) {
 
-		auth := c.GetHeader("Authorization")
-		if auth == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing authorization header"})
+		if skipPath(c.Request.URL.Path, opts) {
+			skipVerification(c, opts)
 			return
 		}
 
-		parts := strings.Split(auth, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid authorization format"})
+		if opts.PreValidate != nil {
+			skip, err := opts.PreValidate(c)
+			if err != nil {
+				fail(c, opts, err)
+				return
+			}
+			if skip {
+				skipVerification(c, opts)
+				return
+			}
+		}
+
+		tokenStr, source, authErr := extractToken(c.Request, opts)
+		if authErr == nil {
+			authErr = checkTransport(c.Request, opts)
+		}
+		if authErr != nil {
+			fail(c, opts, authErr)
 			return
 		}
 
-		tokenStr := parts[1]
+		if opts.StaleMode != StaleAllow && isStale(opts.Provider) {
+			if opts.StaleMode == StaleReject {
+				fail(c, opts, ErrKeyStale)
+				return
+			}
+			setValue(c, opts.ContextPrefix, "auth_degraded", true)
+			c.Header("X-Auth-Degraded", "true")
+		}
 
-		token, err := jwt.Parse(tokenStr, func(t *jwt.Token) (interface{}, error) {
-			return remoteKey.Get(), nil
-		})
+		validateOpts := methodOptions(c.Request.Method, opts)
+		claims, authErr := validate(c.Request.Context(), tokenStr, validateOpts)
+		wouldReject := authErr
+		if authErr != nil {
+			if errors.Is(authErr, ErrKeysNotReady) {
+				c.Header("Retry-After", warmupRetryAfter)
+			}
+			if claims, authErr = dryRunClaims(c.Request.Context(), tokenStr, authErr, validateOpts); authErr != nil {
+				fail(c, opts, authErr)
+				return
+			}
+		}
+		if authErr = checkBinding(c, tokenStr, source, claims, opts); authErr != nil {
+			fail(c, opts, authErr)
+			return
+		}
+		if wouldReject != nil {
+			audit(c, opts, AuditWouldReject, wouldReject, claims)
+		}
 
-		if err != nil || !token.Valid {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired token"})
+		auditDeprecated(c, tokenStr, claims, opts)
+
+		if claims, authErr = transformClaims(claims, opts); authErr != nil {
+			fail(c, opts, authErr)
 			return
 		}
 
-		claims := token.Claims.(jwt.MapClaims)
-		c.Set("claims", claims)
+		setValue(c, opts.ContextPrefix, "claims", claims)
+		setValue(c, opts.ContextPrefix, "subject", subjectOf(claims, opts))
+		if opts.DebugHeaders {
+			setDebugHeaders(c.Writer.Header(), subjectOf(claims, opts), tokenScopes(claims))
+		}
+		if opts.StripAuthHeader {
+			c.Request.Header.Del("Authorization")
+		}
+
+		if opts.UserResolver != nil {
+			user, err := opts.UserResolver(claims)
+			if err != nil {
+				fail(c, opts, ErrUserResolution.wrap(err))
+				return
+			}
+			setValue(c, opts.ContextPrefix, "user", user)
+		}
+
+		if opts.OnAuthenticated != nil {
+			opts.OnAuthenticated(c, claims)
+		}
+
+		if opts.OnAuthSuccess != nil {
+			opts.OnAuthSuccess(c)
+		}
 
 		c.Next()
 	}
 }
+
+// checkBinding runs the checks tying a verified token to the request: DPoP,
+// mTLS, CSRF and AllowedCIDRs. DryRun does not relax them.
+func checkBinding(c *gin.Context, tokenStr, source string, claims jwt.MapClaims, opts Options) *AuthError {
+	if opts.DPoP {
+		if err := checkDPoP(c.Request, tokenStr, claims, opts); err != nil {
+			return err
+		}
+	}
+	if opts.MTLSBound {
+		if err := checkMTLS(c.Request, claims); err != nil {
+			return err
+		}
+	}
+	if opts.CSRFClaim != "" && source == "cookie" {
+		if err := checkCSRF(c.Request, claims, opts); err != nil {
+			return err
+		}
+	}
+	if len(opts.allowedNets) > 0 && !containsIP(opts.allowedNets, clientIP(c, opts)) {
+		return ErrIPNotAllowed
+	}
+	return nil
+}
+
+// skipVerification lets a request skipped by SkipPaths or PreValidate
+// through, marking it for Protect.
+func skipVerification(c *gin.Context, opts Options) {
+	c.Set(skippedKey{}, true)
+	if opts.OnAuthSkipped != nil {
+		opts.OnAuthSkipped(c)
+	}
+	c.Next()
+}
+
+func resolveOptions(opts Options) Options {
+	opts, err := prepareOptions(opts)
+	if err != nil {
+		panic("[go-middle] " + err.Error())
+	}
+	return opts
+}
+
+func prepareOptions(opts Options) (Options, error) {
+
+	// A caller supplied Provider makes construction purely local: no .env
+	// loading, no env lookups and no background refresh, unless env is
+	// explicitly asked for with EnvOverride.
+	if opts.Provider == nil || opts.EnvOverride {
+		utils.LoadEnv()
+		opts = applyEnv(opts)
+	}
+
+	if opts.TokenLookup != "" {
+		sources, err := parseTokenLookup(opts.TokenLookup)
+		if err != nil {
+			return opts, err
+		}
+		opts.tokenLookup = sources
+	}
+
+	if len(opts.TrustedProxies) > 0 {
+		nets, err := parseCIDRs(opts.TrustedProxies, "trusted proxy")
+		if err != nil {
+			return opts, err
+		}
+		opts.trustedProxies = nets
+		if opts.ClientIPResolver == nil {
+			opts.ClientIPResolver = trustedProxyResolver(nets)
+		}
+	}
+
+	if len(opts.AllowedCIDRs) > 0 {
+		nets, err := parseCIDRs(opts.AllowedCIDRs, "allowed CIDR")
+		if err != nil {
+			return opts, err
+		}
+		opts.allowedNets = nets
+	}
+
+	if opts.TokenCache == nil && opts.CacheTTL > 0 {
+		opts.TokenCache = NewMemoryCache(0)
+	}
+
+	if opts.Provider == nil {
+		if opts.PublicKeyURL == "" {
+			return opts, errors.New("PUBLIC_KEY_URL is required in .env")
+		}
+		if opts.RefreshEvery <= 0 {
+			opts.RefreshEvery = 5 * time.Minute
+		}
+
+		keyOpts := crypto.RemotePublicKeyOptions{
+			RefreshEvery:       opts.RefreshEvery,
+			Background:         opts.BackgroundKeyLoad || opts.dedicatedKey,
+			PinnedFingerprints: opts.PinnedFingerprints,
+			OnRefreshSuccess:   opts.OnRefreshSuccess,
+			OnRefreshFailure:   opts.OnRefreshFailure,
+		}
+		var remoteKey crypto.KeyProvider
+		var err error
+		if opts.dedicatedKey {
+			remoteKey, err = crypto.NewRemotePublicKeyWithOptions(opts.PublicKeyURL, keyOpts)
+		} else {
+			remoteKey, err = crypto.SharedRemotePublicKey(opts.PublicKeyURL, keyOpts)
+		}
+		if err != nil {
+			return opts, errors.New("failed loading remote public key: " + err.Error())
+		}
+		opts.Provider = remoteKey
+	}
+
+	if opts.TokenCache != nil {
+		opts.cacheScope = cacheScope(opts)
+	}
+	if opts.VerboseErrors {
+		log.Printf("[go-middle] WARNING: VerboseErrors adds token validation errors to responses, disable it in production")
+	}
+	return opts, nil
+}
+
+func subjectOf(claims jwt.MapClaims, opts Options) string {
+	name := opts.SubjectClaim
+	if name == "" {
+		name = "sub"
+	}
+	return claimString(claims[name])
+}
+
+// warmupRetryAfter is the Retry-After, in seconds, sent with ErrKeysNotReady.
+var warmupRetryAfter = strconv.Itoa(int(crypto.InitialRetryEvery / time.Second))
+
+func isStale(provider crypto.KeyProvider) bool {
+	checker, ok := provider.(crypto.StaleChecker)
+	return ok && checker.IsStale()
+}
+
+func methodOptions(method string, opts Options) Options {
+	if opts.GraceLeeway > 0 && containsAny([]string{method}, opts.GraceMethods) {
+		opts.Leeway += opts.GraceLeeway
+	}
+	return opts
+}
+
+// BearerToken returns the token of an Authorization value of the form
+// "Bearer <token>", for transports other than net/http such as gRPC
+// metadata. The error is ErrMissingAuthorization or ErrInvalidFormat.
+func BearerToken(auth string) (string, error) {
+	tokenStr, err := bearerToken(auth, Options{})
+	if err != nil {
+		return "", err
+	}
+	return tokenStr, nil
+}
+
+func bearerToken(auth string, opts Options) (string, *AuthError) {
+	if auth == "" {
+		return "", ErrMissingAuthorization
+	}
+
+	parts := strings.Split(auth, " ")
+	if len(parts) != 2 || parts[0] != "Bearer" && !(opts.DPoP && parts[0] == "DPoP") {
+		return "", ErrInvalidFormat
+	}
+
+	return parts[1], nil
+}
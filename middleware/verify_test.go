@@ -0,0 +1,375 @@
+package middleware
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/digitcodestudiotech/go-middle/crypto"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestGraceLeeway(t *testing.T) {
+	verify := VerifyTokenWithOptions(Options{
+		Provider:     newTestKeys(),
+		GraceLeeway:  time.Minute,
+		GraceMethods: []string{http.MethodGet, http.MethodHead},
+	})
+	justExpired := sign(t, jwt.MapClaims{"sub": "alice", "exp": ago(30 * time.Second)})
+	longExpired := sign(t, jwt.MapClaims{"sub": "alice", "exp": ago(2 * time.Minute)})
+
+	for _, tc := range []struct {
+		method   string
+		tokenStr string
+		want     int
+	}{
+		{http.MethodGet, justExpired, http.StatusOK},
+		{http.MethodHead, justExpired, http.StatusOK},
+		{http.MethodPost, justExpired, http.StatusUnauthorized},
+		{http.MethodGet, longExpired, http.StatusUnauthorized},
+	} {
+		if w := serveMethod(tc.method, tc.tokenStr, verify); w.Code != tc.want {
+			t.Errorf("%s: status %d, want %d", tc.method, w.Code, tc.want)
+		}
+	}
+}
+
+func TestGraceLeewayAddsToLeeway(t *testing.T) {
+	verify := VerifyTokenWithOptions(Options{
+		Provider:     newTestKeys(),
+		Leeway:       30 * time.Second,
+		GraceLeeway:  30 * time.Second,
+		GraceMethods: []string{http.MethodGet},
+	})
+	tokenStr := sign(t, jwt.MapClaims{"sub": "alice", "exp": ago(45 * time.Second)})
+
+	if w := serveMethod(http.MethodGet, tokenStr, verify); w.Code != http.StatusOK {
+		t.Errorf("GET: status %d, want 200", w.Code)
+	}
+	if w := serveMethod(http.MethodPost, tokenStr, verify); w.Code != http.StatusUnauthorized {
+		t.Errorf("POST: status %d, want 401", w.Code)
+	}
+}
+
+func TestGraceLeewayWithoutMethods(t *testing.T) {
+	verify := VerifyTokenWithOptions(Options{Provider: newTestKeys(), GraceLeeway: time.Minute})
+	tokenStr := sign(t, jwt.MapClaims{"sub": "alice", "exp": ago(30 * time.Second)})
+
+	if w := serve(tokenStr, verify); w.Code != http.StatusUnauthorized {
+		t.Fatalf("status %d, want 401", w.Code)
+	}
+}
+
+func TestPreValidate(t *testing.T) {
+	tokenStr := sign(t, jwt.MapClaims{"sub": "alice"})
+
+	for _, tc := range []struct {
+		name     string
+		hook     func(c *gin.Context) (bool, error)
+		tokenStr string
+		want     int
+	}{
+		{"skip", func(*gin.Context) (bool, error) { return true, nil }, "", http.StatusOK},
+		{"continue", func(*gin.Context) (bool, error) { return false, nil }, tokenStr, http.StatusOK},
+		{"continue without token", func(*gin.Context) (bool, error) { return false, nil }, "", http.StatusUnauthorized},
+		{"plain error", func(*gin.Context) (bool, error) { return true, errors.New("blocked") }, tokenStr, ErrRequestRejected.Status},
+		{"auth error", func(*gin.Context) (bool, error) { return false, ErrIPNotAllowed }, tokenStr, ErrIPNotAllowed.Status},
+		{"mutate request", func(c *gin.Context) (bool, error) {
+			c.Request.Header.Set("Authorization", "Bearer "+tokenStr)
+			return false, nil
+		}, "", http.StatusOK},
+	} {
+		verify := VerifyTokenWithOptions(Options{Provider: newTestKeys(), PreValidate: tc.hook})
+		if w := serve(tc.tokenStr, verify); w.Code != tc.want {
+			t.Errorf("%s: status %d, want %d", tc.name, w.Code, tc.want)
+		}
+	}
+}
+
+type user struct{ ID string }
+
+func TestUserResolver(t *testing.T) {
+	var got user
+	var ok bool
+	verify := VerifyTokenWithOptions(Options{
+		Provider: newTestKeys(),
+		UserResolver: func(claims jwt.MapClaims) (any, error) {
+			if claims["sub"] == "mallory" {
+				return nil, errors.New("banned")
+			}
+			return user{ID: claims["sub"].(string)}, nil
+		},
+	})
+	read := func(c *gin.Context) { got, ok = User[user](c) }
+
+	if w := serve(sign(t, jwt.MapClaims{"sub": "alice"}), verify, read); w.Code != http.StatusOK || !ok || got.ID != "alice" {
+		t.Fatalf("status %d, user = %+v, %v", w.Code, got, ok)
+	}
+	if w := serve(sign(t, jwt.MapClaims{"sub": "mallory"}), verify); w.Code != http.StatusForbidden {
+		t.Fatalf("resolver error: status %d, want 403", w.Code)
+	}
+}
+
+func TestUserWrongType(t *testing.T) {
+	verify := VerifyTokenWithOptions(Options{
+		Provider:     newTestKeys(),
+		UserResolver: func(jwt.MapClaims) (any, error) { return user{ID: "alice"}, nil },
+	})
+	var ok bool
+	serve(sign(t, jwt.MapClaims{"sub": "alice"}), verify, func(c *gin.Context) { _, ok = User[*user](c) })
+	if ok {
+		t.Fatal("User returned a value of another type")
+	}
+}
+
+type staleKeys struct {
+	*testKeys
+	stale bool
+}
+
+func (s *staleKeys) IsStale() bool { return s.stale }
+
+func TestStaleMode(t *testing.T) {
+	tokenStr := sign(t, jwt.MapClaims{"sub": "alice"})
+
+	for _, tc := range []struct {
+		name     string
+		mode     StaleMode
+		stale    bool
+		want     int
+		degraded bool
+	}{
+		{"allow", StaleAllow, true, http.StatusOK, false},
+		{"degrade", StaleDegrade, true, http.StatusOK, true},
+		{"reject", StaleReject, true, http.StatusServiceUnavailable, false},
+		{"degrade fresh", StaleDegrade, false, http.StatusOK, false},
+		{"reject fresh", StaleReject, false, http.StatusOK, false},
+	} {
+		var degraded bool
+		verify := VerifyTokenWithOptions(Options{Provider: &staleKeys{newTestKeys(), tc.stale}, StaleMode: tc.mode})
+		w := serve(tokenStr, verify, func(c *gin.Context) { degraded = Degraded(c) })
+
+		if w.Code != tc.want || degraded != tc.degraded || (w.Header().Get("X-Auth-Degraded") == "true") != tc.degraded {
+			t.Errorf("%s: status %d, degraded %v, header %q", tc.name, w.Code, degraded, w.Header().Get("X-Auth-Degraded"))
+		}
+	}
+}
+
+func TestStaleDegradeStillVerifies(t *testing.T) {
+	verify := VerifyTokenWithOptions(Options{Provider: &staleKeys{newTestKeys(), true}, StaleMode: StaleDegrade})
+	if w := serve("not-a-token", verify); w.Code != http.StatusUnauthorized {
+		t.Fatalf("status %d, want 401", w.Code)
+	}
+}
+
+func TestStripAuthHeader(t *testing.T) {
+	tokenStr := sign(t, jwt.MapClaims{"sub": "alice"})
+
+	for _, strip := range []bool{false, true} {
+		var seen string
+		verify := VerifyTokenWithOptions(Options{Provider: newTestKeys(), StripAuthHeader: strip})
+		w := serve(tokenStr, verify, func(c *gin.Context) { seen = c.GetHeader("Authorization") })
+
+		if w.Code != http.StatusOK || (seen == "") != strip {
+			t.Errorf("strip %v: status %d, downstream Authorization %q", strip, w.Code, seen)
+		}
+	}
+}
+
+func TestOnAuthenticated(t *testing.T) {
+	var order []string
+	verify := VerifyTokenWithOptions(Options{
+		Provider: newTestKeys(),
+		UserResolver: func(jwt.MapClaims) (any, error) {
+			order = append(order, "resolve")
+			return user{ID: "alice"}, nil
+		},
+		OnAuthenticated: func(c *gin.Context, claims jwt.MapClaims) {
+			if _, ok := User[user](c); ok && claims["sub"] == "alice" {
+				order = append(order, "authenticated")
+			}
+		},
+	})
+	serve(sign(t, jwt.MapClaims{"sub": "alice"}), verify, func(*gin.Context) { order = append(order, "handler") })
+
+	if len(order) != 3 || order[0] != "resolve" || order[1] != "authenticated" || order[2] != "handler" {
+		t.Fatalf("order = %v", order)
+	}
+}
+
+func TestOnAuthenticatedSkipsRejected(t *testing.T) {
+	called := false
+	verify := VerifyTokenWithOptions(Options{
+		Provider:        newTestKeys(),
+		OnAuthenticated: func(*gin.Context, jwt.MapClaims) { called = true },
+	})
+	if serve("not-a-token", verify); called {
+		t.Fatal("OnAuthenticated called for a rejected token")
+	}
+}
+
+func TestContextPrefix(t *testing.T) {
+	verify := VerifyTokenWithOptions(Options{
+		Provider:      newTestKeys(),
+		ContextPrefix: "auth.",
+		UserResolver:  func(jwt.MapClaims) (any, error) { return user{ID: "alice"}, nil },
+	})
+
+	var raw, unprefixed bool
+	var claims jwt.MapClaims
+	var u user
+	var subject string
+	w := serve(sign(t, jwt.MapClaims{"sub": "alice", "scope": "read"}), verify, RequireScopes("read"), func(c *gin.Context) {
+		_, raw = c.Get("auth.claims")
+		_, unprefixed = c.Get("claims")
+		claims, _ = Claims(c)
+		u, _ = User[user](c)
+		subject = Subject(c)
+	})
+
+	if w.Code != http.StatusOK || !raw || unprefixed {
+		t.Fatalf("status %d, auth.claims set %v, claims set %v", w.Code, raw, unprefixed)
+	}
+	if claims["sub"] != "alice" || u.ID != "alice" || subject != "alice" {
+		t.Fatalf("accessors: %v, %+v, %q", claims, u, subject)
+	}
+}
+
+type loadingKeys struct{}
+
+func (loadingKeys) Key(*jwt.Token) (interface{}, error) { return nil, crypto.ErrNotReady }
+
+func TestKeysNotReady(t *testing.T) {
+	tokenStr := sign(t, jwt.MapClaims{"sub": "alice"})
+
+	w := serve(tokenStr, VerifyTokenWithOptions(Options{Provider: loadingKeys{}}))
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != warmupRetryAfter {
+		t.Fatalf("gin: status %d, Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+	if got := body(t, w.Body.Bytes())["code"]; got != ErrKeysNotReady.Code {
+		t.Fatalf("gin: code %v", got)
+	}
+
+	hw := serveHTTP(Verify[jwt.MapClaims](Options{Provider: loadingKeys{}}), tokenStr)
+	if hw.Code != http.StatusServiceUnavailable || hw.Header().Get("Retry-After") != warmupRetryAfter {
+		t.Fatalf("net/http: status %d, Retry-After %q", hw.Code, hw.Header().Get("Retry-After"))
+	}
+}
+
+func TestBackgroundJWKSWarmup(t *testing.T) {
+	pub := &testKey.PublicKey
+	set := fmt.Sprintf(`{"keys":[{"kty":"RSA","kid":"k1","n":%q,"e":"AQAB"}]}`,
+		base64.RawURLEncoding.EncodeToString(pub.N.Bytes()))
+	ready := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-ready
+		w.Write([]byte(set))
+	}))
+	defer srv.Close()
+	load := sync.OnceFunc(func() { close(ready) })
+	defer load()
+
+	jwks, err := crypto.NewRemoteJWKS(srv.URL, crypto.JWKSOptions{Background: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jwks.Close()
+	verify := VerifyTokenWithOptions(Options{Provider: jwks})
+	tokenStr := sign(t, jwt.MapClaims{"sub": "alice"})
+
+	if w := serve(tokenStr, verify); w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("before load: status %d, Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+	load()
+	for deadline := time.Now().Add(5 * time.Second); !jwks.Ready(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("keys never loaded")
+		}
+	}
+	if w := serve(tokenStr, verify); w.Code != http.StatusOK {
+		t.Fatalf("after load: status %d, want 200", w.Code)
+	}
+}
+
+func TestClaimsTransform(t *testing.T) {
+	var calls int
+	verify := VerifyTokenWithOptions(Options{
+		Provider: newTestKeys(),
+		CacheTTL: time.Minute,
+		ClaimsTransform: func(claims jwt.MapClaims) jwt.MapClaims {
+			calls++
+			if emails, ok := claims["emails"].([]interface{}); ok && len(emails) > 0 {
+				claims["email"] = emails[0]
+				delete(claims, "emails")
+			}
+			claims["roles"], claims["groups"] = claims["groups"], nil
+			return claims
+		},
+	})
+	tokenStr := sign(t, jwt.MapClaims{"sub": "alice", "emails": []string{"alice@example.com"}, "groups": []string{"admin"}})
+
+	// The second request is a cache hit and must see the untransformed claims.
+	for i := range 2 {
+		var got jwt.MapClaims
+		w := serve(tokenStr, verify, RequireRoles("admin"), func(c *gin.Context) { got, _ = Claims(c) })
+		if w.Code != http.StatusOK {
+			t.Fatalf("request %d: status %d, want 200", i, w.Code)
+		}
+		if got["email"] != "alice@example.com" || got["emails"] != nil {
+			t.Fatalf("request %d: claims = %v", i, got)
+		}
+	}
+	if calls != 2 {
+		t.Fatalf("transform ran %d times, want 2", calls)
+	}
+}
+
+func TestClaimsTransformRejects(t *testing.T) {
+	verify := VerifyTokenWithOptions(Options{
+		Provider:        newTestKeys(),
+		ClaimsTransform: func(jwt.MapClaims) jwt.MapClaims { return nil },
+	})
+	w := serve(sign(t, jwt.MapClaims{"sub": "alice"}), verify)
+	if w.Code != ErrClaimsRejected.Status || body(t, w.Body.Bytes())["code"] != ErrClaimsRejected.Code {
+		t.Fatalf("status %d, body %s", w.Code, w.Body)
+	}
+}
+
+func TestRevocationListOnCacheHits(t *testing.T) {
+	var list atomic.Value
+	list.Store(`[]`)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(list.Load().(string)))
+	}))
+	defer srv.Close()
+	revocations, err := crypto.NewRevocationList(srv.URL, crypto.RevocationListOptions{RefreshEvery: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer revocations.Close()
+
+	verify := VerifyTokenWithOptions(Options{Provider: newTestKeys(), CacheTTL: time.Minute, Revocation: revocations})
+	tokenStr := sign(t, jwt.MapClaims{"sub": "alice", "jti": "j1"})
+	if w := serve(tokenStr, verify); w.Code != http.StatusOK {
+		t.Fatalf("before revocation: status %d, want 200", w.Code)
+	}
+
+	list.Store(`["j1"]`)
+	if err := revocations.ForceRefresh(); err != nil {
+		t.Fatal(err)
+	}
+	w := serve(tokenStr, verify)
+	if w.Code != http.StatusUnauthorized || body(t, w.Body.Bytes())["code"] != ErrTokenRevoked.Code {
+		t.Fatalf("cached revoked token: status %d, body %s", w.Code, w.Body)
+	}
+	if w := serve(sign(t, jwt.MapClaims{"sub": "alice", "jti": "j2"}), verify); w.Code != http.StatusOK {
+		t.Fatalf("other jti: status %d, want 200", w.Code)
+	}
+}
@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"maps"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type WhoAmIOptions struct {
+	// Redact lists top-level claims whose value is replaced by "[redacted]"
+	// in the response, e.g. "email" or "cnf". The subject field is always
+	// shown.
+	Redact []string
+	// Body replaces the default response body. It receives the claims after
+	// redaction.
+	Body func(c *gin.Context, claims jwt.MapClaims) any
+}
+
+// WhoAmI responds with the subject, scopes and claims of the verified
+// token, for smoke tests of the middleware setup. Mount it after
+// VerifyToken, on a route that only integrators can reach.
+func WhoAmI() gin.HandlerFunc {
+	return WhoAmIWithOptions(WhoAmIOptions{})
+}
+
+func WhoAmIWithOptions(opts WhoAmIOptions) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, authErr := claimsFrom(c)
+		if authErr != nil {
+			abort(c, authErr)
+			return
+		}
+
+		if len(opts.Redact) > 0 {
+			claims = maps.Clone(claims)
+			for _, name := range opts.Redact {
+				if _, ok := claims[name]; ok {
+					claims[name] = "[redacted]"
+				}
+			}
+		}
+
+		if opts.Body != nil {
+			c.JSON(http.StatusOK, opts.Body(c, claims))
+			return
+		}
+		scopes := tokenScopes(claims)
+		if scopes == nil {
+			scopes = []string{}
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"subject": Subject(c),
+			"scopes":  scopes,
+			"claims":  claims,
+		})
+	}
+}
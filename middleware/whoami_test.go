@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// whoami mounts handlers behind the verification middleware and returns
+// the response to a request carrying tokenStr.
+func whoami(t *testing.T, opts Options, tokenStr string, handlers ...gin.HandlerFunc) *httptest.ResponseRecorder {
+	t.Helper()
+	opts.Provider = newTestKeys()
+	r := gin.New()
+	r.GET("/whoami", append([]gin.HandlerFunc{VerifyTokenWithOptions(opts)}, handlers...)...)
+	req := httptest.NewRequest(http.MethodGet, "/whoami", nil)
+	if tokenStr != "" {
+		req.Header.Set("Authorization", "Bearer "+tokenStr)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestWhoAmI(t *testing.T) {
+	tokenStr := sign(t, jwt.MapClaims{"sub": "alice", "scope": "read write", "email": "alice@example.com"})
+
+	w := whoami(t, Options{}, tokenStr, WhoAmI())
+	got := body(t, w.Body.Bytes())
+	if w.Code != http.StatusOK || got["subject"] != "alice" {
+		t.Fatalf("status %d, body %v", w.Code, got)
+	}
+	if scopes := got["scopes"]; !reflect.DeepEqual(scopes, []any{"read", "write"}) {
+		t.Fatalf("scopes = %v", scopes)
+	}
+	if claims, _ := got["claims"].(map[string]any); claims["email"] != "alice@example.com" {
+		t.Fatalf("claims = %v", got["claims"])
+	}
+}
+
+func TestWhoAmINoScopes(t *testing.T) {
+	w := whoami(t, Options{SubjectClaim: "uid"}, sign(t, jwt.MapClaims{"sub": "alice", "uid": "u-1"}), WhoAmI())
+	got := body(t, w.Body.Bytes())
+	if got["subject"] != "u-1" || !reflect.DeepEqual(got["scopes"], []any{}) {
+		t.Fatalf("body = %v", got)
+	}
+}
+
+func TestWhoAmIRedact(t *testing.T) {
+	tokenStr := sign(t, jwt.MapClaims{"sub": "alice", "email": "alice@example.com", "cnf": map[string]any{"jkt": "abc"}})
+	var stored jwt.MapClaims
+	w := whoami(t, Options{}, tokenStr,
+		func(c *gin.Context) { c.Next(); stored, _ = Claims(c) },
+		WhoAmIWithOptions(WhoAmIOptions{Redact: []string{"email", "cnf", "sub", "phone"}}))
+
+	got := body(t, w.Body.Bytes())
+	claims, _ := got["claims"].(map[string]any)
+	if claims["email"] != "[redacted]" || claims["cnf"] != "[redacted]" {
+		t.Fatalf("claims = %v", claims)
+	}
+	if _, ok := claims["phone"]; ok {
+		t.Fatal("absent claim added by redaction")
+	}
+	if got["subject"] != "alice" {
+		t.Fatalf("subject = %v, want it shown", got["subject"])
+	}
+	if stored["email"] != "alice@example.com" {
+		t.Fatalf("redaction changed the context claims: %v", stored)
+	}
+}
+
+func TestWhoAmIBody(t *testing.T) {
+	w := whoami(t, Options{}, sign(t, jwt.MapClaims{"sub": "alice", "email": "alice@example.com"}),
+		WhoAmIWithOptions(WhoAmIOptions{
+			Redact: []string{"email"},
+			Body: func(c *gin.Context, claims jwt.MapClaims) any {
+				return gin.H{"user": claims["sub"], "email": claims["email"]}
+			},
+		}))
+	if got := body(t, w.Body.Bytes()); got["user"] != "alice" || got["email"] != "[redacted]" || len(got) != 2 {
+		t.Fatalf("body = %v", got)
+	}
+}
+
+func TestWhoAmIRejected(t *testing.T) {
+	if w := whoami(t, Options{}, "", WhoAmI()); w.Code != http.StatusUnauthorized {
+		t.Fatalf("status %d, want 401", w.Code)
+	}
+	if w := serve("", WhoAmI()); w.Code != ErrMissingClaims.Status {
+		t.Fatalf("without VerifyToken: status %d, want %d", w.Code, ErrMissingClaims.Status)
+	}
+}
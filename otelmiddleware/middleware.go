@@ -0,0 +1,125 @@
+package otelmiddleware
+
+import (
+	"context"
+	"errors"
+
+	"github.com/digitcodestudiotech/go-middle/middleware"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	instrumentationName = "github.com/digitcodestudiotech/go-middle/otelmiddleware"
+	spanName            = "go-middle.VerifyToken"
+	stateKey            = "go-middle.otel"
+)
+
+type config struct {
+	tracerProvider trace.TracerProvider
+	propagator     propagation.TextMapPropagator
+}
+
+type Option func(*config)
+
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(c *config) { c.tracerProvider = tp }
+}
+
+func WithPropagator(p propagation.TextMapPropagator) Option {
+	return func(c *config) { c.propagator = p }
+}
+
+type spanState struct {
+	span   trace.Span
+	parent context.Context
+	ended  bool
+}
+
+// VerifyToken wraps middleware.VerifyTokenWithOptions in a span covering
+// token validation only. Downstream handlers continue in the incoming trace,
+// not under the auth span, including requests skipped by SkipPaths or
+// PreValidate. Existing OnAuthSuccess, OnAuthFailure and OnAuthSkipped hooks
+// in opts are still called.
+func VerifyToken(opts middleware.Options, options ...Option) gin.HandlerFunc {
+	cfg := config{
+		tracerProvider: otel.GetTracerProvider(),
+		propagator:     otel.GetTextMapPropagator(),
+	}
+	for _, o := range options {
+		o(&cfg)
+	}
+	tracer := cfg.tracerProvider.Tracer(instrumentationName)
+
+	onSuccess, onFailure, onSkipped := opts.OnAuthSuccess, opts.OnAuthFailure, opts.OnAuthSkipped
+
+	opts.OnAuthSuccess = func(c *gin.Context) {
+		end(c, attribute.String("auth.outcome", "success"))
+		if onSuccess != nil {
+			onSuccess(c)
+		}
+	}
+	opts.OnAuthFailure = func(c *gin.Context, err error) {
+		attrs := []attribute.KeyValue{attribute.String("auth.outcome", "failure")}
+		var authErr *middleware.AuthError
+		if errors.As(err, &authErr) {
+			attrs = append(attrs, attribute.String("auth.failure_reason", authErr.Code))
+		}
+		if s, ok := state(c); ok {
+			s.span.RecordError(err)
+			s.span.SetStatus(codes.Error, err.Error())
+		}
+		end(c, attrs...)
+		if onFailure != nil {
+			onFailure(c, err)
+		}
+	}
+
+	opts.OnAuthSkipped = func(c *gin.Context) {
+		end(c, attribute.String("auth.outcome", "skipped"))
+		if onSkipped != nil {
+			onSkipped(c)
+		}
+	}
+
+	verify := middleware.VerifyTokenWithOptions(opts)
+
+	return func(c *gin.Context) {
+		parent := c.Request.Context()
+		if !trace.SpanContextFromContext(parent).IsValid() {
+			parent = cfg.propagator.Extract(parent, propagation.HeaderCarrier(c.Request.Header))
+		}
+
+		ctx, span := tracer.Start(parent, spanName, trace.WithSpanKind(trace.SpanKindInternal))
+		c.Request = c.Request.WithContext(ctx)
+		c.Set(stateKey, &spanState{span: span, parent: parent})
+
+		verify(c)
+
+		end(c, attribute.String("auth.outcome", "skipped"))
+	}
+}
+
+func state(c *gin.Context) (*spanState, bool) {
+	v, ok := c.Get(stateKey)
+	if !ok {
+		return nil, false
+	}
+	s, ok := v.(*spanState)
+	return s, ok && !s.ended
+}
+
+func end(c *gin.Context, attrs ...attribute.KeyValue) {
+	s, ok := state(c)
+	if !ok {
+		return
+	}
+	s.span.SetAttributes(attrs...)
+	s.span.End()
+	s.ended = true
+	c.Request = c.Request.WithContext(s.parent)
+}
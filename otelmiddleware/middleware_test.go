@@ -0,0 +1,131 @@
+package otelmiddleware
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/digitcodestudiotech/go-middle/middleware"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var testKey = func() *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}()
+
+type staticKey struct{}
+
+func (staticKey) Key(*jwt.Token) (interface{}, error) {
+	return &testKey.PublicKey, nil
+}
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// run serves path through VerifyToken and returns the finished spans and
+// whether the final handler saw a recording span in its request context.
+func run(t *testing.T, opts middleware.Options, path, tokenStr string) ([]sdktrace.ReadOnlySpan, int, bool) {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	opts.Provider = staticKey{}
+
+	var inSpan bool
+	r := gin.New()
+	r.Use(VerifyToken(opts, WithTracerProvider(tp)))
+	r.GET(path, func(c *gin.Context) {
+		inSpan = trace.SpanFromContext(c.Request.Context()).IsRecording()
+		c.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if tokenStr != "" {
+		req.Header.Set("Authorization", "Bearer "+tokenStr)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	return exporter.GetSpans().Snapshots(), w.Code, inSpan
+}
+
+func outcome(t *testing.T, spans []sdktrace.ReadOnlySpan) string {
+	t.Helper()
+	if len(spans) != 1 {
+		t.Fatalf("%d spans, want 1", len(spans))
+	}
+	for _, attr := range spans[0].Attributes() {
+		if attr.Key == "auth.outcome" {
+			return attr.Value.AsString()
+		}
+	}
+	return ""
+}
+
+func TestVerifyTokenSuccess(t *testing.T) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix()})
+	tokenStr, err := token.SignedString(testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spans, code, inSpan := run(t, middleware.Options{}, "/", tokenStr)
+	if code != http.StatusOK {
+		t.Fatalf("status %d, want 200", code)
+	}
+	if got := outcome(t, spans); got != "success" {
+		t.Fatalf("auth.outcome = %q, want success", got)
+	}
+	if inSpan {
+		t.Fatal("handler ran inside the auth span")
+	}
+}
+
+func TestVerifyTokenFailure(t *testing.T) {
+	spans, code, _ := run(t, middleware.Options{}, "/", "")
+	if code != http.StatusUnauthorized {
+		t.Fatalf("status %d, want 401", code)
+	}
+	if got := outcome(t, spans); got != "failure" {
+		t.Fatalf("auth.outcome = %q, want failure", got)
+	}
+	var reason attribute.Value
+	for _, attr := range spans[0].Attributes() {
+		if attr.Key == "auth.failure_reason" {
+			reason = attr.Value
+		}
+	}
+	if reason.AsString() != middleware.ErrMissingAuthorization.Code {
+		t.Fatalf("auth.failure_reason = %q", reason.AsString())
+	}
+}
+
+func TestVerifyTokenSkippedEndsSpanFirst(t *testing.T) {
+	for name, opts := range map[string]middleware.Options{
+		"SkipPaths":   {SkipPaths: []string{"/health"}},
+		"PreValidate": {PreValidate: func(*gin.Context) (bool, error) { return true, nil }},
+	} {
+		spans, code, inSpan := run(t, opts, "/health", "")
+		if code != http.StatusOK {
+			t.Fatalf("%s: status %d, want 200", name, code)
+		}
+		if got := outcome(t, spans); got != "skipped" {
+			t.Fatalf("%s: auth.outcome = %q, want skipped", name, got)
+		}
+		if inSpan {
+			t.Fatalf("%s: skipped request ran inside the auth span", name)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package rediscache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/digitcodestudiotech/go-middle/middleware"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/redis/go-redis/v9"
+)
+
+// Cache implements middleware.TokenCache on top of Redis so validated
+// tokens are shared across replicas.
+type Cache struct {
+	client redis.Cmdable
+	prefix string
+}
+
+var (
+	_ middleware.TokenCache       = (*Cache)(nil)
+	_ middleware.CacheInvalidator = (*Cache)(nil)
+	_ middleware.SubjectIndexer   = (*Cache)(nil)
+)
+
+func New(client redis.Cmdable, prefix string) *Cache {
+	if prefix == "" {
+		prefix = "go-middle:token:"
+	}
+	return &Cache{client: client, prefix: prefix}
+}
+
+func (c *Cache) Get(ctx context.Context, key string) (jwt.MapClaims, bool, error) {
+	raw, err := c.client.Get(ctx, c.prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	var claims jwt.MapClaims
+	if err := json.Unmarshal(raw, &claims); err != nil {
+		return nil, false, err
+	}
+	return claims, true, nil
+}
+
+func (c *Cache) Set(ctx context.Context, key string, claims jwt.MapClaims, ttl time.Duration) error {
+	sub, _ := claims.GetSubject()
+	return c.SetSubject(ctx, key, sub, claims, ttl)
+}
+
+// SetSubject stores claims and adds key to the token index and, unless sub is
+// empty, to the index of sub.
+func (c *Cache) SetSubject(ctx context.Context, key, sub string, claims jwt.MapClaims, ttl time.Duration) error {
+	raw, err := json.Marshal(claims)
+	if err != nil {
+		return err
+	}
+	if err := c.client.Set(ctx, c.prefix+key, raw, ttl).Err(); err != nil {
+		return err
+	}
+
+	if err := indexKey.Run(ctx, c.client, []string{c.tokenKey(middleware.CacheKeyToken(key))}, key, ttl.Milliseconds()).Err(); err != nil {
+		return err
+	}
+	if sub != "" {
+		return indexKey.Run(ctx, c.client, []string{c.subjectKey(sub)}, key, ttl.Milliseconds()).Err()
+	}
+	return nil
+}
+
+func (c *Cache) Delete(ctx context.Context, key string) error {
+	return c.client.Del(ctx, c.prefix+key).Err()
+}
+
+// InvalidateToken removes the entries of tokenStr under every set of
+// verifying options, using the per-token index maintained by Set.
+func (c *Cache) InvalidateToken(ctx context.Context, tokenStr string) error {
+	return c.invalidate(ctx, c.tokenKey(middleware.CacheKey(tokenStr)))
+}
+
+// InvalidateSubject removes every entry of sub on all replicas, using the
+// per-subject index maintained by Set.
+func (c *Cache) InvalidateSubject(ctx context.Context, sub string) error {
+	return c.invalidate(ctx, c.subjectKey(sub))
+}
+
+// invalidate deletes the index and the entries it lists.
+func (c *Cache) invalidate(ctx context.Context, index string) error {
+	keys, err := c.client.SMembers(ctx, index).Result()
+	if err != nil {
+		return err
+	}
+
+	del := []string{index}
+	for _, key := range keys {
+		del = append(del, c.prefix+key)
+	}
+	return c.client.Del(ctx, del...).Err()
+}
+
+func (c *Cache) subjectKey(sub string) string {
+	return c.prefix + "sub:" + sub
+}
+
+func (c *Cache) tokenKey(token string) string {
+	return c.prefix + "tok:" + token
+}
+
+// indexKey adds a cache key to a token or subject index and extends the
+// index TTL so it outlives its longest entry.
+var indexKey = redis.NewScript(`
+redis.call("SADD", KEYS[1], ARGV[1])
+if redis.call("PTTL", KEYS[1]) < tonumber(ARGV[2]) then
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 1
+`)
@@ -0,0 +1,106 @@
+package rediscache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/digitcodestudiotech/go-middle/middleware"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/redis/go-redis/v9"
+)
+
+func newCache(t *testing.T) (*Cache, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return New(client, ""), mr
+}
+
+func TestGetSet(t *testing.T) {
+	cache, mr := newCache(t)
+	ctx := context.Background()
+
+	if _, ok, err := cache.Get(ctx, "missing"); ok || err != nil {
+		t.Fatalf("Get(missing) = %v, %v", ok, err)
+	}
+	if err := cache.Set(ctx, "k", jwt.MapClaims{"sub": "alice"}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	claims, ok, err := cache.Get(ctx, "k")
+	if !ok || err != nil || claims["sub"] != "alice" {
+		t.Fatalf("Get = %v, %v, %v", claims, ok, err)
+	}
+
+	mr.FastForward(2 * time.Minute)
+	if _, ok, _ := cache.Get(ctx, "k"); ok {
+		t.Fatal("entry outlived its ttl")
+	}
+}
+
+func TestInvalidateToken(t *testing.T) {
+	cache, _ := newCache(t)
+	ctx := context.Background()
+	token := middleware.CacheKey("token")
+	for _, key := range []string{token + ":a", token + ":b", middleware.CacheKey("other") + ":a"} {
+		if err := cache.Set(ctx, key, jwt.MapClaims{"sub": "alice"}, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := cache.InvalidateToken(ctx, "token"); err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]bool{token + ":a": false, token + ":b": false, middleware.CacheKey("other") + ":a": true} {
+		if _, ok, _ := cache.Get(ctx, key); ok != want {
+			t.Errorf("%s cached = %v, want %v", key, ok, want)
+		}
+	}
+}
+
+func TestInvalidateSubject(t *testing.T) {
+	cache, _ := newCache(t)
+	ctx := context.Background()
+	_ = cache.Set(ctx, "a:1", jwt.MapClaims{"sub": "alice"}, time.Minute)
+	_ = cache.Set(ctx, "b:1", jwt.MapClaims{"sub": "alice"}, time.Minute)
+	_ = cache.Set(ctx, "c:1", jwt.MapClaims{"sub": "bob"}, time.Minute)
+
+	if err := cache.InvalidateSubject(ctx, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]bool{"a:1": false, "b:1": false, "c:1": true} {
+		if _, ok, _ := cache.Get(ctx, key); ok != want {
+			t.Errorf("%s cached = %v, want %v", key, ok, want)
+		}
+	}
+}
+
+func TestIndexOutlivesEntries(t *testing.T) {
+	cache, mr := newCache(t)
+	ctx := context.Background()
+	_ = cache.Set(ctx, "a:1", jwt.MapClaims{"sub": "alice"}, time.Hour)
+	_ = cache.Set(ctx, "b:1", jwt.MapClaims{"sub": "alice"}, time.Minute)
+
+	if ttl := mr.TTL(cache.subjectKey("alice")); ttl < time.Hour-time.Second {
+		t.Fatalf("subject index ttl = %v, want about 1h", ttl)
+	}
+}
+
+func TestSetSubjectIndexesGivenSubject(t *testing.T) {
+	cache, _ := newCache(t)
+	ctx := context.Background()
+	if err := cache.SetSubject(ctx, "a:1", "user-1", jwt.MapClaims{"sub": "pairwise-123"}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	_ = cache.InvalidateSubject(ctx, "pairwise-123")
+	if _, ok, _ := cache.Get(ctx, "a:1"); !ok {
+		t.Fatal("entry removed by its sub claim")
+	}
+	_ = cache.InvalidateSubject(ctx, "user-1")
+	if _, ok, _ := cache.Get(ctx, "a:1"); ok {
+		t.Fatal("entry not removed by its indexed subject")
+	}
+}
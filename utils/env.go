@@ -3,6 +3,8 @@ package utils
 import (
 	"log"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -21,3 +23,30 @@ func GetEnv(key string) string {
 	}
 	return value
 }
+
+func GetEnvSlice(key string) []string {
+	var values []string
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+func GetEnvOptional(key string) string {
+	return os.Getenv(key)
+}
+
+func GetEnvDuration(key string) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("[go-middle] WARNING: env %s is not a valid duration: %s\n", key, value)
+		return 0
+	}
+	return d
+}
@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGetEnvSlice(t *testing.T) {
+	for _, tc := range []struct {
+		value string
+		want  []string
+	}{
+		{"", nil},
+		{"api", []string{"api"}},
+		{"api, admin ,,web", []string{"api", "admin", "web"}},
+		{" , ", nil},
+	} {
+		t.Setenv("TEST_SLICE", tc.value)
+		if got := GetEnvSlice("TEST_SLICE"); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%q: got %q, want %q", tc.value, got, tc.want)
+		}
+	}
+}
+
+func TestGetEnvDuration(t *testing.T) {
+	for value, want := range map[string]time.Duration{
+		"":      0,
+		"90s":   90 * time.Second,
+		"1h30m": 90 * time.Minute,
+		"5":     0,
+		"soon":  0,
+	} {
+		t.Setenv("TEST_DURATION", value)
+		if got := GetEnvDuration("TEST_DURATION"); got != want {
+			t.Errorf("%q: got %v, want %v", value, got, want)
+		}
+	}
+}